@@ -1,47 +1,61 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/simondanielsson/apPRoved/cmd/bootstrap"
 	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
 	"github.com/simondanielsson/apPRoved/cmd/internal/middlewares"
 	"github.com/simondanielsson/apPRoved/cmd/internal/routes"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"github.com/simondanielsson/apPRoved/cmd/internal/workers"
 	"github.com/simondanielsson/apPRoved/pkg/utils"
 	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
 	"gorm.io/gorm"
 )
 
 type APIServer struct {
-	config       *config.ServerConfig
-	db           *gorm.DB
-	app          *fiber.App
-	queue        mq.MessageQueue
-	githubClient *utils.GithubClient
+	config   *config.Config
+	db       *gorm.DB
+	app      *fiber.App
+	bus      eventbus.Bus
+	queue    mq.MessageQueue
+	services *services.Services
+	workers  []workers.Worker
 }
 
 func (s *APIServer) Run() {
-	if err := s.app.Listen(":" + s.config.BindAddr); err != nil {
+	if err := s.app.Listen(":" + s.config.Server.BindAddr); err != nil {
 		log.Fatalf("could not start server %v\n", err)
 	}
-	log.Printf("API server listening on port %s", s.config.BindAddr)
+	log.Printf("API server listening on port %s", s.config.Server.BindAddr)
+}
+
+// RunWorkers starts the background workers. They stop when ctx is cancelled.
+func (s *APIServer) RunWorkers(ctx context.Context) {
+	for _, worker := range s.workers {
+		log.Printf("Starting %s", worker.Name())
+		go worker.Run(ctx)
+	}
 }
 
 func (s *APIServer) setupRoutes() {
 	apiV1 := s.app.Group("/api/v1")
 
-	repos := bootstrap.InitRepositories()
-	services := bootstrap.InitServices(repos)
-	controllers := bootstrap.InitControllers(services)
+	controllers := bootstrap.InitControllers(s.services)
 
-	opt_middlewares := middlewares.GetOptionalMiddlewares(s.db)
+	opt_middlewares := middlewares.GetOptionalMiddlewares(s.db, s.bus, s.config, s.services)
 	routes.RegisterRoutes(apiV1, controllers, opt_middlewares)
 }
 
 func (s *APIServer) Shutdown() error {
 	fmt.Println("Shutting down server...")
+	// open review streams only end when their subscriptions are dropped
+	s.bus.Close()
 	if err := s.app.Shutdown(); err != nil {
 		return err
 	}
@@ -49,17 +63,23 @@ func (s *APIServer) Shutdown() error {
 	return nil
 }
 
-func NewAPIServer(cfg *config.ServerConfig, db *gorm.DB, queue mq.MessageQueue, githubClient *utils.GithubClient) *APIServer {
+func NewAPIServer(cfg *config.Config, db *gorm.DB, queue mq.MessageQueue) *APIServer {
+	repos := bootstrap.InitRepositories()
+	bus := bootstrap.InitEventBus(cfg, db)
+	services := bootstrap.InitServices(cfg, repos, bus)
+
 	server := &APIServer{
-		config:       cfg,
-		db:           db,
-		app:          fiber.New(),
-		queue:        queue,
-		githubClient: githubClient,
+		config:   cfg,
+		db:       db,
+		app:      fiber.New(),
+		bus:      bus,
+		queue:    queue,
+		services: services,
+		workers:  bootstrap.InitWorkers(cfg, db, bus, queue, services),
 	}
 
 	utils.ConfigureSwagger(server.app)
-	middlewares.SetupMiddlewares(server.app, queue, githubClient)
+	middlewares.SetupMiddlewares(server.app)
 	server.setupRoutes()
 
 	return server
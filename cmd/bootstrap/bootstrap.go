@@ -1,30 +1,107 @@
 package bootstrap
 
 import (
+	"log"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
 	"github.com/simondanielsson/apPRoved/cmd/internal/controllers"
+	dbconn "github.com/simondanielsson/apPRoved/cmd/internal/db"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
 	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
 	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"github.com/simondanielsson/apPRoved/cmd/internal/workers"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
+	"gorm.io/gorm"
 )
 
 func InitRepositories() *repositories.Repositories {
 	return &repositories.Repositories{
-		ReviewsRepository: repositories.NewReviewsRepository(),
-		UserRepository:    repositories.NewUserRepository(),
+		ReviewsRepository:           repositories.NewReviewsRepository(),
+		UserRepository:              repositories.NewUserRepository(),
+		OutboxRepository:            repositories.NewOutboxRepository(),
+		AutoReviewRepository:        repositories.NewAutoReviewRepository(),
+		GithubPublicationRepository: repositories.NewGithubPublicationRepository(),
+		FeedbackRepository:          repositories.NewFeedbackRepository(),
+		TokenRepository:             repositories.NewTokenRepository(),
+		GithubCredentialRepository:  repositories.NewGithubCredentialRepository(),
+	}
+}
+
+// InitGithubCache creates the cache for conditional GitHub requests, or returns nil if caching is disabled
+func InitGithubCache(cfg *config.GithubCacheConfig, db *gorm.DB) utils.GithubCache {
+	switch cfg.Store {
+	case "":
+		return nil
+	case "memory":
+		return utils.NewMemoryGithubCache(cfg.MaxEntries, cfg.MaxBytes)
+	case "postgres":
+		return services.NewGithubCacheService(cfg, db, repositories.NewGithubCacheRepository())
+	default:
+		log.Printf("Unknown GitHub cache store %q, caching is disabled", cfg.Store)
+		return nil
+	}
+}
+
+// InitEventBus creates the bus that delivers review events to streaming clients. Unless it is the
+// postgres bus, events only reach the clients of the replica that recorded them.
+func InitEventBus(cfg *config.Config, db *gorm.DB) eventbus.Bus {
+	switch cfg.EventBus.Driver {
+	case "memory":
+		return eventbus.NewMemoryBus()
+	case "postgres":
+		return eventbus.NewPostgresBus(db, dbconn.NewListener(cfg.Database), cfg.EventBus.Channel)
+	default:
+		log.Printf("Unknown event bus driver %q, falling back to the in-memory bus", cfg.EventBus.Driver)
+		return eventbus.NewMemoryBus()
 	}
 }
 
-func InitServices(repos *repositories.Repositories) *services.Services {
+// InitServices creates the services
+func InitServices(cfg *config.Config, repos *repositories.Repositories, bus eventbus.Bus) *services.Services {
+	outboxService := services.NewOutboxService(repos.OutboxRepository, repos.ReviewsRepository)
+	authService := services.NewAuthService(cfg.JWT, repos.UserRepository, repos.TokenRepository)
+	githubClientService := services.NewGithubClientService(cfg.Github, repos.GithubCredentialRepository)
+	githubPublicationService := services.NewGithubPublicationService(cfg.GithubPublication, repos.GithubPublicationRepository, repos.ReviewsRepository, githubClientService)
+	reviewsService := services.NewReviewsService(cfg.Reviews, repos.ReviewsRepository, outboxService, githubPublicationService, githubClientService, bus)
+	autoReviewService := services.NewAutoReviewService(cfg.AutoReview, repos.AutoReviewRepository, repos.ReviewsRepository, reviewsService)
+	pullRequestsService := services.NewPullRequestsService(repos.ReviewsRepository, autoReviewService, githubClientService)
+
 	return &services.Services{
-		ReviewsService: services.NewReviewsService(repos.ReviewsRepository),
-		UserService:    services.NewUserService(repos.UserRepository),
-		AuthService:    services.NewAuthService(repos.UserRepository),
+		ReviewsService:           reviewsService,
+		UserService:              services.NewUserService(repos.UserRepository),
+		AuthService:              authService,
+		GithubAuthService:        services.NewGithubAuthService(cfg.Github, repos.UserRepository, repos.GithubCredentialRepository, authService),
+		OutboxService:            outboxService,
+		WebhooksService:          services.NewWebhooksService(repos.ReviewsRepository, pullRequestsService),
+		PullRequestsService:      pullRequestsService,
+		AutoReviewService:        autoReviewService,
+		GithubPublicationService: githubPublicationService,
+		GithubClientService:      githubClientService,
+		FeedbackService:          services.NewFeedbackService(repos.FeedbackRepository, repos.ReviewsRepository),
 	}
 }
 
 func InitControllers(services *services.Services) *controllers.Controllers {
 	return &controllers.Controllers{
-		ReviewsController: controllers.NewReviewsController(services.ReviewsService),
-		UserController:    controllers.NewUserController(services.UserService),
-		AuthController:    controllers.NewAuthController(services.AuthService, services.UserService),
+		ReviewsController:  controllers.NewReviewsController(services.ReviewsService, services.PullRequestsService, services.GithubPublicationService),
+		UserController:     controllers.NewUserController(services.UserService),
+		AuthController:     controllers.NewAuthController(services.AuthService, services.GithubAuthService, services.UserService),
+		WebhooksController: controllers.NewWebhooksController(services.WebhooksService),
+		FeedbackController: controllers.NewFeedbackController(services.FeedbackService),
+	}
+}
+
+func InitWorkers(cfg *config.Config, db *gorm.DB, bus eventbus.Bus, queue mq.MessageQueue, services *services.Services) []workers.Worker {
+	initialized := []workers.Worker{
+		workers.NewOutboxRelay(cfg.Outbox, db, bus, queue, services.OutboxService),
+		workers.NewReviewResultsConsumer(db, bus, queue, services.ReviewsService),
+		workers.NewAutoReviewScheduler(cfg.AutoReview, db, bus, services.AutoReviewService),
+		workers.NewGithubPublisher(cfg.GithubPublication, db, services.GithubPublicationService),
+		workers.NewReviewReaper(cfg.Reviews, db, bus, services.ReviewsService),
+	}
+	if postgresBus, ok := bus.(*eventbus.PostgresBus); ok {
+		initialized = append(initialized, workers.NewEventBusListener(cfg.EventBus, postgresBus))
 	}
+	return initialized
 }
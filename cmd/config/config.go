@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"time"
 
 	"github.com/joho/godotenv"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -28,7 +29,9 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret string `mapstructure:"secret"`
+	Secret          string        `mapstructure:"secret"`
+	AccessTokenTTL  time.Duration `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `mapstructure:"refresh_token_ttl"`
 }
 
 type RabbitMQQueueConfig struct {
@@ -45,17 +48,115 @@ type RabbitMQConfig struct {
 	Queues []RabbitMQQueueConfig `mapstructure:"queues"`
 }
 
+type PubSubSubscriptionConfig struct {
+	Topic        string `mapstructure:"topic"`
+	Subscription string `mapstructure:"subscription"`
+}
+
 type PubSubConfig struct {
-	ProjectID string   `mapstructure:"project_id"`
-	Topics    []string `mapstructure:"topics"`
+	ProjectID     string                     `mapstructure:"project_id"`
+	Topics        []string                   `mapstructure:"topics"`
+	Subscriptions []PubSubSubscriptionConfig `mapstructure:"subscriptions"`
+}
+
+type ServiceConfig struct {
+	Secret       string        `mapstructure:"secret"`
+	MaxClockSkew time.Duration `mapstructure:"max_clock_skew"`
+}
+
+type GithubConfig struct {
+	WebhookSecret string `mapstructure:"webhook_secret"`
+	// APIURL overrides the GitHub API URL, e.g. for GitHub Enterprise or a local fake server
+	APIURL             string `mapstructure:"api_url"`
+	ClientID           string `mapstructure:"client_id"`
+	ClientSecret       string `mapstructure:"client_secret"`
+	OAuthRedirectURL   string `mapstructure:"oauth_redirect_url"`
+	OAuthAuthURL       string `mapstructure:"oauth_auth_url"`
+	OAuthTokenURL      string `mapstructure:"oauth_token_url"`
+	TokenEncryptionKey string `mapstructure:"token_encryption_key"`
+	// AppID and the PEM encoded AppPrivateKey (or AppPrivateKeyPath) authenticate as a GitHub App
+	AppID             int64  `mapstructure:"app_id"`
+	AppPrivateKey     string `mapstructure:"app_private_key"`
+	AppPrivateKeyPath string `mapstructure:"app_private_key_path"`
+	// MaxConcurrentRequests bounds the GitHub requests in flight, and MaxRateLimitWait is how long a
+	// request may wait out a secondary rate limit before failing
+	MaxConcurrentRequests int           `mapstructure:"max_concurrent_requests"`
+	MaxRateLimitWait      time.Duration `mapstructure:"max_rate_limit_wait"`
+}
+
+type AutoReviewConfig struct {
+	PollInterval    time.Duration `mapstructure:"poll_interval"`
+	DefaultDebounce time.Duration `mapstructure:"default_debounce"`
+	RetryDelay      time.Duration `mapstructure:"retry_delay"`
+	MaxAttempts     int           `mapstructure:"max_attempts"`
+}
+
+type GithubPublicationConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	RetryDelay   time.Duration `mapstructure:"retry_delay"`
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+}
+
+// ReviewsConfig holds the default limits on the files of a pull request sent for review. Exclude holds
+// glob patterns of files never to review. Context is the default context sent along with the diffs, see
+// constants.ReviewContext, and the content limits bound the file contents fetched for it. Reviews that stay
+// queued for longer than QueuedTimeout, or make no progress for longer than ProcessingTimeout, time out.
+type ReviewsConfig struct {
+	MaxFiles            int      `mapstructure:"max_files"`
+	MaxPatchBytes       int      `mapstructure:"max_patch_bytes"`
+	Exclude             []string `mapstructure:"exclude"`
+	Context             string   `mapstructure:"context"`
+	ContextLines        int      `mapstructure:"context_lines"`
+	MaxFileContentBytes int      `mapstructure:"max_file_content_bytes"`
+	MaxContentBytes     int      `mapstructure:"max_content_bytes"`
+
+	QueuedTimeout     time.Duration `mapstructure:"queued_timeout"`
+	ProcessingTimeout time.Duration `mapstructure:"processing_timeout"`
+	ReaperInterval    time.Duration `mapstructure:"reaper_interval"`
+}
+
+type GithubCacheConfig struct {
+	// Store is where GitHub responses are cached for conditional requests: "memory", "postgres", or
+	// empty to disable caching
+	Store      string `mapstructure:"store"`
+	MaxEntries int    `mapstructure:"max_entries"`
+	// MaxBytes bounds the size of the responses held by the memory store
+	MaxBytes int           `mapstructure:"max_bytes"`
+	MaxAge   time.Duration `mapstructure:"max_age"`
+}
+
+type EventBusConfig struct {
+	// Driver is how review events reach streaming clients: "memory" within a single replica, or
+	// "postgres" to fan them out to all replicas with LISTEN/NOTIFY
+	Driver  string `mapstructure:"driver"`
+	Channel string `mapstructure:"channel"`
+	// ReconnectDelay is how long a replica waits before listening again after losing its connection
+	ReconnectDelay time.Duration `mapstructure:"reconnect_delay"`
+}
+
+// OutboxConfig configures the outbox relay. Messages that were published or given up on are deleted
+// once they are older than Retention, every PruneInterval.
+type OutboxConfig struct {
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+	Retention     time.Duration `mapstructure:"retention"`
+	PruneInterval time.Duration `mapstructure:"prune_interval"`
 }
 
 type Config struct {
-	Server   *ServerConfig   `mapstructure:"server"`
-	Database *DatabaseConfig `mapstructure:"database"`
-	JWT      *JWTConfig      `mapstructure:"jwt"`
-	MQ       *RabbitMQConfig `mapstructure:"mq"`
-	PubSub   *PubSubConfig   `mapstructure:"pubsub"`
+	Server            *ServerConfig            `mapstructure:"server"`
+	Database          *DatabaseConfig          `mapstructure:"database"`
+	JWT               *JWTConfig               `mapstructure:"jwt"`
+	MQ                *RabbitMQConfig          `mapstructure:"mq"`
+	PubSub            *PubSubConfig            `mapstructure:"pubsub"`
+	Outbox            *OutboxConfig            `mapstructure:"outbox"`
+	Service           *ServiceConfig           `mapstructure:"service"`
+	Github            *GithubConfig            `mapstructure:"github"`
+	AutoReview        *AutoReviewConfig        `mapstructure:"auto_review"`
+	GithubPublication *GithubPublicationConfig `mapstructure:"github_publication"`
+	GithubCache       *GithubCacheConfig       `mapstructure:"github_cache"`
+	Reviews           *ReviewsConfig           `mapstructure:"reviews"`
+	EventBus          *EventBusConfig          `mapstructure:"event_bus"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -100,6 +201,30 @@ func LoadConfig() (*Config, error) {
 	if cfg.PubSub == nil {
 		log.Fatalf("pubsub config is missing")
 	}
+	if cfg.Outbox == nil {
+		log.Fatalf("outbox config is missing")
+	}
+	if cfg.Service == nil {
+		log.Fatalf("service config is missing")
+	}
+	if cfg.Github == nil {
+		log.Fatalf("github config is missing")
+	}
+	if cfg.AutoReview == nil {
+		log.Fatalf("auto review config is missing")
+	}
+	if cfg.GithubPublication == nil {
+		log.Fatalf("github publication config is missing")
+	}
+	if cfg.GithubCache == nil {
+		log.Fatalf("github cache config is missing")
+	}
+	if cfg.Reviews == nil {
+		log.Fatalf("reviews config is missing")
+	}
+	if cfg.EventBus == nil {
+		log.Fatalf("event bus config is missing")
+	}
 
 	if err := ValidateRabbitMQConfig(cfg.MQ); err != nil {
 		log.Fatalf("configuration validation error: %v", err)
@@ -124,4 +249,15 @@ func parseEnvironmentVariables() {
 	customerrors.IgnoreError(viper.BindEnv("jwt.secret", "JWT_KEY"))
 	customerrors.IgnoreError(viper.BindEnv("mq.url", "AMQP_URL"))
 	customerrors.IgnoreError(viper.BindEnv("pubsub.project_id", "GCP_PROJECT_ID"))
+	customerrors.IgnoreError(viper.BindEnv("service.secret", "SERVICE_SECRET"))
+	customerrors.IgnoreError(viper.BindEnv("github.webhook_secret", "GITHUB_WEBHOOK_SECRET"))
+	customerrors.IgnoreError(viper.BindEnv("github.api_url", "GITHUB_API_URL"))
+	customerrors.IgnoreError(viper.BindEnv("github.client_id", "GITHUB_CLIENT_ID"))
+	customerrors.IgnoreError(viper.BindEnv("github.client_secret", "GITHUB_CLIENT_SECRET"))
+	customerrors.IgnoreError(viper.BindEnv("github.oauth_redirect_url", "GITHUB_OAUTH_REDIRECT_URL"))
+	customerrors.IgnoreError(viper.BindEnv("github.token_encryption_key", "GITHUB_TOKEN_ENCRYPTION_KEY"))
+	customerrors.IgnoreError(viper.BindEnv("github.app_id", "GITHUB_APP_ID"))
+	customerrors.IgnoreError(viper.BindEnv("github.app_private_key", "GITHUB_APP_PRIVATE_KEY"))
+	customerrors.IgnoreError(viper.BindEnv("github.app_private_key_path", "GITHUB_APP_PRIVATE_KEY_PATH"))
+	customerrors.IgnoreError(viper.BindEnv("github_cache.store", "GITHUB_CACHE_STORE"))
 }
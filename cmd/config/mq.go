@@ -5,11 +5,15 @@ import "fmt"
 type QueueName string
 
 const (
-	QueueFileDiffs QueueName = "review-file-diffs"
+	QueueFileDiffs           QueueName = "review-file-diffs"
+	QueueReviewResults       QueueName = "review-results"
+	QueueReviewCancellations QueueName = "review-cancellations"
 )
 
 var ValidQueueNames = map[string]QueueName{
-	string(QueueFileDiffs): QueueFileDiffs,
+	string(QueueFileDiffs):           QueueFileDiffs,
+	string(QueueReviewResults):       QueueReviewResults,
+	string(QueueReviewCancellations): QueueReviewCancellations,
 }
 
 // ValidateRabbitMQConfig validates that all queue names in the config are valid
@@ -10,6 +10,58 @@ const (
 	StatusProcessing ReviewStatus = "processing"
 	// StatusAvailable indicates that the review is available.
 	StatusAvailable ReviewStatus = "available"
+	// StatusFailed indicates that the review could not be sent to or was rejected by the review service.
+	StatusFailed ReviewStatus = "failed"
+	// StatusCancelled indicates that the review was cancelled before it completed.
+	StatusCancelled ReviewStatus = "cancelled"
+	// StatusTimedOut indicates that the review made no progress within its deadline.
+	StatusTimedOut ReviewStatus = "timed_out"
+)
+
+type ReviewMode string
+
+// Review Mode Constants
+const (
+	// ReviewModeFull reviews all files changed by the pull request.
+	ReviewModeFull ReviewMode = "full"
+	// ReviewModeIncremental only reviews the changes since the last completed review.
+	ReviewModeIncremental ReviewMode = "incremental"
+)
+
+type CommentSide string
+
+// Review Comment Side Constants, named like the sides of GitHub review comments
+const (
+	// CommentSideLeft anchors a comment to lines of the base version of a file.
+	CommentSideLeft CommentSide = "LEFT"
+	// CommentSideRight anchors a comment to lines of the head version of a file.
+	CommentSideRight CommentSide = "RIGHT"
+)
+
+type CommentSeverity string
+
+// Review Comment Severity Constants
+const (
+	// SeverityInfo is a remark that does not require changes.
+	SeverityInfo CommentSeverity = "info"
+	// SeverityMinor is an issue that should be fixed eventually.
+	SeverityMinor CommentSeverity = "minor"
+	// SeverityMajor is an issue that should be fixed before merging.
+	SeverityMajor CommentSeverity = "major"
+	// SeverityCritical is an issue that must be fixed before merging.
+	SeverityCritical CommentSeverity = "critical"
+)
+
+type FeedbackVote string
+
+// Feedback Vote Constants
+const (
+	// VoteUp marks a file review or comment as useful.
+	VoteUp FeedbackVote = "up"
+	// VoteDown marks a file review or comment as not useful.
+	VoteDown FeedbackVote = "down"
+	// VoteNone withdraws a vote.
+	VoteNone FeedbackVote = "none"
 )
 
 type PRState string
@@ -21,3 +73,75 @@ const (
 	// PRStateOpen indicates that the pull request is open.
 	PRStateOpen PRState = "open"
 )
+
+type ReviewResultType string
+
+// Review Result Message Type Constants
+const (
+	// ReviewResultProgress indicates a status or progress update from the review service.
+	ReviewResultProgress ReviewResultType = "progress"
+	// ReviewResultComplete indicates that the review service has finished reviewing all files.
+	ReviewResultComplete ReviewResultType = "complete"
+	// ReviewResultFailed indicates that the review service gave up on the review.
+	ReviewResultFailed ReviewResultType = "failed"
+)
+
+type SkipReason string
+
+// Skipped File Reason Constants
+const (
+	// SkipExcluded indicates that the file does not match the include rules or matches an exclude rule.
+	SkipExcluded SkipReason = "excluded"
+	// SkipGenerated indicates that the file is generated, e.g. a lockfile.
+	SkipGenerated SkipReason = "generated"
+	// SkipVendored indicates that the file is third-party code checked into the repository.
+	SkipVendored SkipReason = "vendored"
+	// SkipBinary indicates that the file is binary.
+	SkipBinary SkipReason = "binary"
+	// SkipEmptyDiff indicates that the file has no textual diff, e.g. because it was only renamed.
+	SkipEmptyDiff SkipReason = "empty_diff"
+	// SkipTooLarge indicates that the diff of the file exceeds the patch size limit.
+	SkipTooLarge SkipReason = "too_large"
+	// SkipFileLimit indicates that the review already reached its file limit.
+	SkipFileLimit SkipReason = "file_limit"
+	// SkipGithubLimit indicates that the file is past the files GitHub lists for a diff.
+	SkipGithubLimit SkipReason = "github_limit"
+)
+
+type ReviewContext string
+
+// Review Context Constants
+const (
+	// ContextNone only sends the diff of each file.
+	ContextNone ReviewContext = "none"
+	// ContextLines sends the lines of the head version of each file around the hunks of its diff.
+	ContextLines ReviewContext = "lines"
+	// ContextFull sends the full head and base versions of each file.
+	ContextFull ReviewContext = "full"
+)
+
+type ContentOmittedReason string
+
+// Content Omitted Reason Constants
+const (
+	// ContentTooLarge indicates that a version of the file exceeds the file content size limit.
+	ContentTooLarge ContentOmittedReason = "too_large"
+	// ContentBinary indicates that the file is binary.
+	ContentBinary ContentOmittedReason = "binary"
+	// ContentReviewLimit indicates that the review already reached its total content size limit.
+	ContentReviewLimit ContentOmittedReason = "review_limit"
+	// ContentUnavailable indicates that the file could not be fetched from GitHub.
+	ContentUnavailable ContentOmittedReason = "unavailable"
+)
+
+type ReviewActor string
+
+// Review Event Actor Constants
+const (
+	// ActorUser is a user acting on one of their reviews.
+	ActorUser ReviewActor = "user"
+	// ActorReviewService is the review service reporting on a review.
+	ActorReviewService ReviewActor = "review_service"
+	// ActorSystem is the API itself, e.g. an auto review, the outbox relay or the review reaper.
+	ActorSystem ReviewActor = "system"
+)
@@ -1,22 +1,33 @@
 package controllers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/simondanielsson/apPRoved/cmd/internal/db"
-	"github.com/simondanielsson/apPRoved/cmd/internal/dto/responses"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
+	"github.com/simondanielsson/apPRoved/cmd/internal/middlewares"
 	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
 )
 
+// githubStateCookie holds the OAuth state between the GitHub login redirect and the callback
+const githubStateCookie = "github_oauth_state"
+
 type AuthController struct {
-	authService *services.AuthService
-	userService *services.UserService
+	authService       *services.AuthService
+	githubAuthService *services.GithubAuthService
+	userService       *services.UserService
 }
 
 // NewAuthController creates a new auth controller
-func NewAuthController(authService *services.AuthService, userService *services.UserService) *AuthController {
+func NewAuthController(authService *services.AuthService, githubAuthService *services.GithubAuthService, userService *services.UserService) *AuthController {
 	return &AuthController{
-		authService: authService,
-		userService: userService,
+		authService:       authService,
+		githubAuthService: githubAuthService,
+		userService:       userService,
 	}
 }
 
@@ -28,7 +39,7 @@ func NewAuthController(authService *services.AuthService, userService *services.
 // @Produce json
 // @Param username formData string true "Username"
 // @Param password formData string true "Password"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} responses.LoginResponse
 // @Failure 400 {string} string "Unauthorized"
 // @Router       /api/v1/login [post]
 func (ac *AuthController) Login(c *fiber.Ctx) error {
@@ -40,12 +51,148 @@ func (ac *AuthController) Login(c *fiber.Ctx) error {
 	}
 
 	tx := db.GetDBTransaction(c)
-	token, err := ac.authService.AuthenticateUser(tx, username, password)
+	tokens, err := ac.authService.AuthenticateUser(tx, username, password)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials", "error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(responses.LoginResponse{Token: token})
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+// @Summary Refresh token
+// @Description Exchange a refresh token for a new access token and refresh token. Each refresh token can only be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refreshTokenRequest body requests.RefreshTokenRequest true "Refresh token request"
+// @Success 200 {object} responses.LoginResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router       /api/v1/token/refresh [post]
+func (ac *AuthController) RefreshToken(c *fiber.Ctx) error {
+	var req requests.RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Refresh token is required"})
+	}
+
+	tx := db.GetDBTransaction(c)
+	tokens, err := ac.authService.RefreshTokens(tx, req.RefreshToken)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			status = fiber.StatusUnauthorized
+		}
+		return c.Status(status).JSON(fiber.Map{"message": "Could not refresh token", "error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+// @Summary Logout
+// @Description Revoke the access token of the request, and the refresh token of the session if given
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param logoutRequest body requests.LogoutRequest false "Logout request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router       /api/v1/logout [post]
+func (ac *AuthController) Logout(c *fiber.Ctx) error {
+	var req requests.LogoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not parse request body"})
+		}
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+	tokenID, expiresAt := middlewares.GetAccessToken(c)
+
+	if err := ac.authService.Logout(tx, userID, tokenID, expiresAt, req.RefreshToken); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not log out", "error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Logged out"})
+}
+
+// @Summary Sign in with GitHub
+// @Description Redirect to GitHub to authorize the app. GitHub redirects back to the callback endpoint.
+// @Tags auth
+// @Success 302
+// @Failure 503 {object} map[string]interface{}
+// @Router       /api/v1/auth/github/login [get]
+func (ac *AuthController) GithubLogin(c *fiber.Ctx) error {
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not start GitHub sign in", "error": err.Error()})
+	}
+
+	authURL, err := ac.githubAuthService.AuthCodeURL(state)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"message": "Could not start GitHub sign in", "error": err.Error()})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     githubStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/github",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// @Summary GitHub sign in callback
+// @Description Complete signing in with GitHub and return our tokens. A GitHub account that is not linked yet is linked to the signed in user, if the request carries a session, and gets a new user otherwise. Accounts are never linked by email; if a user with the account's email exists, sign in as that user first.
+// @Security BearerAuth
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "OAuth state"
+// @Success 200 {object} responses.LoginResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router       /api/v1/auth/github/callback [get]
+func (ac *AuthController) GithubCallback(c *fiber.Ctx) error {
+	expectedState := c.Cookies(githubStateCookie)
+	c.ClearCookie(githubStateCookie)
+
+	state := c.Query("state")
+	if expectedState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expectedState)) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid OAuth state"})
+	}
+	if reason := c.Query("error"); reason != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "GitHub authorization failed", "error": reason})
+	}
+	code := c.Query("code")
+	if code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Authorization code is required"})
+	}
+
+	tx := db.GetDBTransaction(c)
+	tokens, err := ac.githubAuthService.Login(c.UserContext(), tx, code, middlewares.GetOptionalUserID(c))
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrGithubOAuthNotConfigured):
+			status = fiber.StatusServiceUnavailable
+		case errors.Is(err, services.ErrGithubOAuthFailed):
+			status = fiber.StatusUnauthorized
+		case errors.Is(err, services.ErrGithubAccountConflict):
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{"message": "Could not sign in with GitHub", "error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
 }
 
 // CreateUser godoc
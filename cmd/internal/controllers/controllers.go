@@ -1,7 +1,44 @@
 package controllers
 
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
 type Controllers struct {
-	ReviewsController *ReviewsController
-	UserController    *UserController
-	AuthController    *AuthController
+	ReviewsController  *ReviewsController
+	UserController     *UserController
+	AuthController     *AuthController
+	WebhooksController *WebhooksController
+	FeedbackController *FeedbackController
+}
+
+// errorStatus maps well-known service errors to an HTTP status code. Other errors map to fallback.
+// Rows that do not exist or are not owned by the user are reported as not found.
+func errorStatus(err error, fallback int) int {
+	var validationErr *customerrors.ValidationError
+	var rateLimitedErr *utils.RateLimitedError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fiber.StatusNotFound
+	case errors.As(err, &validationErr):
+		return fiber.StatusBadRequest
+	case errors.Is(err, utils.ErrPullRequestHeadMoved):
+		return fiber.StatusConflict
+	case errors.Is(err, services.ErrNoGithubCredential):
+		return fiber.StatusForbidden
+	case errors.As(err, &rateLimitedErr):
+		return fiber.StatusTooManyRequests
+	case errors.Is(err, services.ErrReviewCancelled), errors.Is(err, services.ErrIllegalTransition), errors.Is(err, services.ErrStaleAttempt):
+		return fiber.StatusConflict
+	case errors.Is(err, services.ErrReviewDeleted):
+		return fiber.StatusGone
+	default:
+		return fallback
+	}
 }
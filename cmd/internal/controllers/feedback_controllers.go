@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/internal/db"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
+	"github.com/simondanielsson/apPRoved/cmd/internal/middlewares"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
+
+// defaultFeedbackWeeks is how many weeks the feedback summary covers by default
+const defaultFeedbackWeeks = 12
+
+type FeedbackController struct {
+	feedbackService *services.FeedbackService
+}
+
+// NewFeedbackController creates a new feedback controller
+func NewFeedbackController(feedbackService *services.FeedbackService) *FeedbackController {
+	return &FeedbackController{feedbackService: feedbackService}
+}
+
+// @Summary Update file review feedback
+// @Description Upvote or downvote a file review, mark it as resolved, or dismiss it with a reason
+// @Tags feedback
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        prID          path  string  true  "Pull request ID"
+// @Param        reviewID      path  string  true  "Review ID"
+// @Param        fileReviewID  path  string  true  "File review ID"
+// @Param        updateFeedbackRequest  body  requests.UpdateFeedbackRequest  true  "Update feedback request"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/files/{fileReviewID}/feedback [put]
+func (fc *FeedbackController) UpdateFileReviewFeedback(c *fiber.Ctx) error {
+	return fc.updateFeedback(c, false)
+}
+
+// @Summary Update review comment feedback
+// @Description Upvote or downvote a review comment, mark it as resolved, or dismiss it with a reason
+// @Tags feedback
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        prID          path  string  true  "Pull request ID"
+// @Param        reviewID      path  string  true  "Review ID"
+// @Param        fileReviewID  path  string  true  "File review ID"
+// @Param        commentID     path  string  true  "Review comment ID"
+// @Param        updateFeedbackRequest  body  requests.UpdateFeedbackRequest  true  "Update feedback request"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/files/{fileReviewID}/comments/{commentID}/feedback [put]
+func (fc *FeedbackController) UpdateReviewCommentFeedback(c *fiber.Ctx) error {
+	return fc.updateFeedback(c, true)
+}
+
+func (fc *FeedbackController) updateFeedback(c *fiber.Ctx, onComment bool) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+	prID, err := utils.ReadUintPathParam(c, "prID")
+	if err != nil {
+		return err
+	}
+	reviewID, err := utils.ReadUintPathParam(c, "reviewID")
+	if err != nil {
+		return err
+	}
+	fileReviewID, err := utils.ReadUintPathParam(c, "fileReviewID")
+	if err != nil {
+		return err
+	}
+	var commentID uint
+	if onComment {
+		commentID, err = utils.ReadUintPathParam(c, "commentID")
+		if err != nil {
+			return err
+		}
+	}
+
+	var req requests.UpdateFeedbackRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not parse request body"})
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+
+	feedback, err := fc.feedbackService.UpdateFeedback(tx, userID, repoID, prID, reviewID, fileReviewID, commentID, &req)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not update feedback",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Feedback updated successfully",
+		"data":    feedback,
+	})
+}
+
+// @Summary Get feedback summary
+// @Description Get how useful the file reviews of a repository were, in total and per week of review creation
+// @Tags feedback
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path   string  true   "Repository ID"
+// @Param        weeks         query  int     false  "Number of weeks to cover (default 12)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/feedback [get]
+func (fc *FeedbackController) GetFeedbackSummary(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+
+	summary, err := fc.feedbackService.GetFeedbackSummary(tx, userID, repoID, c.QueryInt("weeks", defaultFeedbackWeeks))
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not get feedback summary",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Successfully fetched feedback summary",
+		"data":    summary,
+	})
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/internal/db"
+	"github.com/simondanielsson/apPRoved/cmd/internal/middlewares"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
+
+// streamKeepAliveInterval is how often an idle review stream is kept alive, so that proxies do not
+// close it
+const streamKeepAliveInterval = 15 * time.Second
+
+// Names of the messages of a review stream
+const (
+	// streamEventStatus carries the status of the review when the stream starts
+	streamEventStatus = "status"
+	// streamEventChange carries a status or progress change of the review
+	streamEventChange = "change"
+)
+
+// streamMessage is a message of a review stream over a WebSocket
+type streamMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// write swagger docs
+// @Summary Stream review progress
+// @Description Stream the status and progress changes of a review as Server-Sent Events, or as JSON messages over a WebSocket if the request is a WebSocket upgrade. The first message is the current status, each later message a change. The stream ends once the review is available, failed, cancelled or timed out.
+// @Tags reviews
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        prID          path  string  true  "Pull request ID"
+// @Param        reviewID  path  string  true  "Review ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/stream [get]
+func (rc *ReviewsController) StreamReview(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+	prID, err := utils.ReadUintPathParam(c, "prID")
+	if err != nil {
+		return err
+	}
+	reviewID, err := utils.ReadUintPathParam(c, "reviewID")
+	if err != nil {
+		return err
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+	watch, err := rc.reviewsService.WatchReview(tx, userID, repoID, prID, reviewID)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not stream review",
+			"error":   err.Error(),
+		})
+	}
+
+	// the stream is written after the handler returned and the transaction committed
+	if websocket.IsWebSocketUpgrade(c) {
+		if err := websocket.New(func(conn *websocket.Conn) {
+			streamReviewWebSocket(conn, watch)
+		})(c); err != nil {
+			watch.Close()
+			return err
+		}
+		return nil
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamReviewEvents(w, watch)
+	})
+	return nil
+}
+
+// streamReviewEvents writes a review stream as Server-Sent Events until the review finished or the
+// client went away
+func streamReviewEvents(w *bufio.Writer, watch *services.ReviewWatch) {
+	defer watch.Close()
+
+	if err := writeServerSentEvent(w, streamEventStatus, "", watch.Current); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-watch.Events():
+			if !ok {
+				return
+			}
+			if err := writeServerSentEvent(w, streamEventChange, fmt.Sprint(event.ID), event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			// writing to a closed connection is the only way to notice that the client went away
+			if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeServerSentEvent(w *bufio.Writer, event, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return w.Flush()
+}
+
+// streamReviewWebSocket writes a review stream as JSON messages over a WebSocket until the review
+// finished or the client went away
+func streamReviewWebSocket(conn *websocket.Conn, watch *services.ReviewWatch) {
+	defer watch.Close()
+
+	// clients do not send messages, reading only notices when they close the connection
+	// the reader keeps the underlying connection since conn is released once the handler returns
+	closed := make(chan struct{})
+	reader := conn.Conn
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := reader.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(streamMessage{Event: streamEventStatus, Data: watch.Current}); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-watch.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return
+			}
+			if err := conn.WriteJSON(streamMessage{Event: streamEventChange, Data: event}); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamKeepAliveInterval)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -10,16 +10,21 @@ import (
 	"github.com/simondanielsson/apPRoved/cmd/internal/middlewares"
 	"github.com/simondanielsson/apPRoved/cmd/internal/services"
 	"github.com/simondanielsson/apPRoved/pkg/utils"
-	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
 )
 
 type ReviewsController struct {
-	reviewsService *services.ReviewsService
+	reviewsService           *services.ReviewsService
+	pullRequestsService      *services.PullRequestsService
+	githubPublicationService *services.GithubPublicationService
 }
 
 // NewReviewsController creates a new reviews controller
-func NewReviewsController(reviewsService *services.ReviewsService) *ReviewsController {
-	return &ReviewsController{reviewsService: reviewsService}
+func NewReviewsController(reviewsService *services.ReviewsService, pullRequestsService *services.PullRequestsService, githubPublicationService *services.GithubPublicationService) *ReviewsController {
+	return &ReviewsController{
+		reviewsService:           reviewsService,
+		pullRequestsService:      pullRequestsService,
+		githubPublicationService: githubPublicationService,
+	}
 }
 
 // generate swagger docs
@@ -57,6 +62,7 @@ func (rc *ReviewsController) GetRepositories(c *fiber.Ctx) error {
 // @Param        createRepositoryRequest  body      requests.CreateRepositoryRequest  true  "Create repository request"
 // @Success      201  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      429  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories [post]
 func (rc *ReviewsController) RegisterRepository(c *fiber.Ctx) error {
@@ -69,14 +75,9 @@ func (rc *ReviewsController) RegisterRepository(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not parse request body"})
 	}
 
-	githubClient, ok := c.Locals("githubClient").(utils.GithubClient)
-	if !ok {
-		return fiber.NewError(fiber.StatusInternalServerError, "Github client not available")
-	}
-
-	repo, err := rc.reviewsService.RegisterRepository(ctx, tx, githubClient, userID, req.Name, req.Owner, req.URL)
+	repo, err := rc.reviewsService.RegisterRepository(ctx, tx, userID, req.Name, req.Owner, req.URL)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not create repository", "error": err.Error()})
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{"message": "Could not create repository", "error": err.Error()})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -94,6 +95,7 @@ func (rc *ReviewsController) RegisterRepository(c *fiber.Ctx) error {
 // @Param        repositoryID  path  string  true  "Repository ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID} [get]
 func (rc *ReviewsController) GetRepository(c *fiber.Ctx) error {
@@ -103,10 +105,11 @@ func (rc *ReviewsController) GetRepository(c *fiber.Ctx) error {
 	}
 
 	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
 
-	repo, err := rc.reviewsService.GetRepository(tx, repoID)
+	repo, err := rc.reviewsService.GetRepository(tx, userID, repoID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Repository not found", "error": err.Error(),
 		})
 	}
@@ -116,6 +119,78 @@ func (rc *ReviewsController) GetRepository(c *fiber.Ctx) error {
 	})
 }
 
+// @Summary Get repository settings
+// @Description Get the auto review and GitHub publishing settings of a repository
+// @Tags reviews
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/settings [get]
+func (rc *ReviewsController) GetRepositorySettings(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+
+	settings, err := rc.reviewsService.GetRepositorySettings(tx, userID, repoID)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not fetch repository settings", "error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Repository settings fetched successfully",
+		"data":    settings,
+	})
+}
+
+// @Summary Update repository settings
+// @Description Enable or disable automatic reviews of new commits and publishing of completed reviews to GitHub, and set how long to wait for further pushes before reviewing
+// @Tags reviews
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        updateRepositorySettingsRequest  body  requests.UpdateRepositorySettingsRequest  true  "Update repository settings request"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/settings [put]
+func (rc *ReviewsController) UpdateRepositorySettings(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+
+	var req requests.UpdateRepositorySettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not parse request body"})
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+
+	settings, err := rc.reviewsService.UpdateRepositorySettings(tx, userID, repoID, &req)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not update repository settings", "error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Repository settings updated successfully",
+		"data":    settings,
+	})
+}
+
 // generate swagger docs
 // @Summary Get pull requests
 // @Description Get all pull requests for repository
@@ -126,6 +201,7 @@ func (rc *ReviewsController) GetRepository(c *fiber.Ctx) error {
 // @Param        repositoryID  path  string  true  "Repository ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests [get]
 func (rc *ReviewsController) GetPullRequests(c *fiber.Ctx) error {
@@ -138,7 +214,7 @@ func (rc *ReviewsController) GetPullRequests(c *fiber.Ctx) error {
 	tx := db.GetDBTransaction(c)
 	prs, err := rc.reviewsService.GetPullRequests(tx, userID, repoID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not fetch pull requests",
 			"error":   err.Error(),
 		})
@@ -160,6 +236,8 @@ func (rc *ReviewsController) GetPullRequests(c *fiber.Ctx) error {
 // @Param        repositoryID  path  string  true  "Repository ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      429  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests [put]
 func (rc *ReviewsController) RefreshPullRequests(c *fiber.Ctx) error {
@@ -169,15 +247,10 @@ func (rc *ReviewsController) RefreshPullRequests(c *fiber.Ctx) error {
 	}
 	userID := middlewares.GetUserID(c)
 
-	githubClient, ok := c.Locals("githubClient").(utils.GithubClient)
-	if !ok {
-		return fiber.NewError(fiber.StatusInternalServerError, "Github client not available")
-	}
-
 	tx := db.GetDBTransaction(c)
 	ctx := context.Background()
-	if err := rc.reviewsService.RefreshPullRequests(ctx, tx, githubClient, userID, repoID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	if err := rc.pullRequestsService.Refresh(ctx, tx, userID, repoID); err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not update pull requests",
 			"error":   err.Error(),
 		})
@@ -198,6 +271,7 @@ func (rc *ReviewsController) RefreshPullRequests(c *fiber.Ctx) error {
 // @Param        prID          path  string  true  "Pull request ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID} [get]
 func (rc *ReviewsController) GetPullRequest(c *fiber.Ctx) error {
@@ -212,9 +286,10 @@ func (rc *ReviewsController) GetPullRequest(c *fiber.Ctx) error {
 	}
 
 	tx := db.GetDBTransaction(c)
-	pr, err := rc.reviewsService.GetPullRequest(tx, repoID, prID)
+	userID := middlewares.GetUserID(c)
+	pr, err := rc.reviewsService.GetPullRequest(tx, userID, repoID, prID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not fetch pull request",
 			"error":   err.Error(),
 		})
@@ -235,6 +310,7 @@ func (rc *ReviewsController) GetPullRequest(c *fiber.Ctx) error {
 // @Param        prID          path  string  true  "Pull request ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews [get]
 func (rc *ReviewsController) GetReviews(c *fiber.Ctx) error {
@@ -248,9 +324,10 @@ func (rc *ReviewsController) GetReviews(c *fiber.Ctx) error {
 	}
 
 	tx := db.GetDBTransaction(c)
-	reviewsResponse, err := rc.reviewsService.GetReviews(tx, repoID, prID)
+	userID := middlewares.GetUserID(c)
+	reviewsResponse, err := rc.reviewsService.GetReviews(tx, userID, repoID, prID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not fetch reviews",
 			"error":   err.Error(),
 		})
@@ -273,6 +350,7 @@ func (rc *ReviewsController) GetReviews(c *fiber.Ctx) error {
 // @Param        reviewID  path  string  true  "Review ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID} [get]
 func (rc *ReviewsController) GetReview(c *fiber.Ctx) error {
@@ -290,9 +368,10 @@ func (rc *ReviewsController) GetReview(c *fiber.Ctx) error {
 	}
 
 	tx := db.GetDBTransaction(c)
-	review, err := rc.reviewsService.GetReview(tx, repoID, prID, reviewID)
+	userID := middlewares.GetUserID(c)
+	review, err := rc.reviewsService.GetReview(tx, userID, repoID, prID, reviewID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not fetch review",
 			"error":   err.Error(),
 		})
@@ -316,18 +395,28 @@ func (rc *ReviewsController) GetReview(c *fiber.Ctx) error {
 // @Param        reviewID  path  string  true  "Review ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/files [get]
 func (rc *ReviewsController) GetFileReviews(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+	prID, err := utils.ReadUintPathParam(c, "prID")
+	if err != nil {
+		return err
+	}
 	reviewID, err := utils.ReadUintPathParam(c, "reviewID")
 	if err != nil {
 		return err
 	}
 
 	tx := db.GetDBTransaction(c)
-	reviewResponse, err := rc.reviewsService.GetFileReviews(tx, reviewID)
+	userID := middlewares.GetUserID(c)
+	reviewResponse, err := rc.reviewsService.GetFileReviews(tx, userID, repoID, prID, reviewID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not fetch review",
 			"error":   err.Error(),
 		})
@@ -341,7 +430,7 @@ func (rc *ReviewsController) GetFileReviews(c *fiber.Ctx) error {
 
 // generate swagger docs
 // @Summary Create review
-// @Description Create a review
+// @Description Create a review of the current head commit of a pull request. In incremental mode only the changes since the last completed review are reviewed.
 // @Tags reviews
 // @Security BearerAuth
 // @Accept json
@@ -351,6 +440,8 @@ func (rc *ReviewsController) GetFileReviews(c *fiber.Ctx) error {
 // @Param        createReviewRequest  body  requests.CreateReviewRequest  true  "Create review request"
 // @Success      201  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      429  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews [post]
 func (rc *ReviewsController) CreateReview(c *fiber.Ctx) error {
@@ -369,19 +460,11 @@ func (rc *ReviewsController) CreateReview(c *fiber.Ctx) error {
 
 	tx := db.GetDBTransaction(c)
 	userID := middlewares.GetUserID(c)
-	messageQueue, ok := c.Locals("messageQueue").(mq.MessageQueue)
-	if !ok {
-		return fiber.NewError(fiber.StatusInternalServerError, "Message queue not available")
-	}
-	githubClient, ok := c.Locals("githubClient").(utils.GithubClient)
-	if !ok {
-		return fiber.NewError(fiber.StatusInternalServerError, "Github client not available")
-	}
 
 	ctx := context.Background()
-	review, err := rc.reviewsService.CreateReview(tx, ctx, messageQueue, githubClient, repoID, prID, req.Name, userID)
+	review, err := rc.reviewsService.CreateReview(tx, ctx, repoID, prID, &req, userID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not create review",
 			"error":   err.Error(),
 		})
@@ -407,6 +490,7 @@ func (rc *ReviewsController) CreateReview(c *fiber.Ctx) error {
 // @Param        reviewID  path  string  true  "Review ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID} [delete]
 func (rc *ReviewsController) DeleteReview(c *fiber.Ctx) error {
@@ -424,8 +508,9 @@ func (rc *ReviewsController) DeleteReview(c *fiber.Ctx) error {
 	}
 
 	tx := db.GetDBTransaction(c)
-	if err := rc.reviewsService.DeleteReview(tx, repoID, prID, reviewID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	userID := middlewares.GetUserID(c)
+	if err := rc.reviewsService.DeleteReview(tx, userID, repoID, prID, reviewID); err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not delete review",
 			"error":   err.Error(),
 		})
@@ -436,14 +521,161 @@ func (rc *ReviewsController) DeleteReview(c *fiber.Ctx) error {
 	})
 }
 
+// @Summary Retry review
+// @Description Send a failed, cancelled or timed out review to the review service again, with the same file diffs.
+// @Tags reviews
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        prID          path  string  true  "Pull request ID"
+// @Param        reviewID  path  string  true  "Review ID"
+// @Success      202  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/retry [post]
+func (rc *ReviewsController) RetryReview(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+	prID, err := utils.ReadUintPathParam(c, "prID")
+	if err != nil {
+		return err
+	}
+	reviewID, err := utils.ReadUintPathParam(c, "reviewID")
+	if err != nil {
+		return err
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+
+	ctx := context.Background()
+	review, err := rc.reviewsService.RetryReview(tx, ctx, userID, repoID, prID, reviewID)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not retry review",
+			"error":   err.Error(),
+		})
+	}
+
+	c.Set("Location", fmt.Sprintf("/api/v1/repositories/%d/pull-requests/%d/reviews/%d/progress", repoID, prID, reviewID))
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Review queued again.",
+		"data":    review,
+	})
+}
+
+// @Summary Cancel review
+// @Description Cancel a queued or processing review. The review service is told to stop, and results it sends for the review afterwards are rejected.
+// @Tags reviews
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        prID          path  string  true  "Pull request ID"
+// @Param        reviewID  path  string  true  "Review ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/cancel [post]
+func (rc *ReviewsController) CancelReview(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+	prID, err := utils.ReadUintPathParam(c, "prID")
+	if err != nil {
+		return err
+	}
+	reviewID, err := utils.ReadUintPathParam(c, "reviewID")
+	if err != nil {
+		return err
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+	review, err := rc.reviewsService.CancelReview(tx, userID, repoID, prID, reviewID)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not cancel review",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Review cancelled.",
+		"data":    review,
+	})
+}
+
+// Generate swagger docs
+// @Summary Publish review
+// @Description Publish an available review to its pull request on GitHub. Publishing a review again updates the GitHub review instead of creating a new one.
+// @Tags reviews
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        prID          path  string  true  "Pull request ID"
+// @Param        reviewID  path  string  true  "Review ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      429  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/publish [post]
+func (rc *ReviewsController) PublishReview(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+	prID, err := utils.ReadUintPathParam(c, "prID")
+	if err != nil {
+		return err
+	}
+	reviewID, err := utils.ReadUintPathParam(c, "reviewID")
+	if err != nil {
+		return err
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+
+	ctx := context.Background()
+	publication, err := rc.githubPublicationService.PublishReview(ctx, tx, userID, repoID, prID, reviewID)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not publish review",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Review published to GitHub",
+		"data":    publication,
+	})
+}
+
 // @Summary Complete review
-// @Description Complete a review
+// @Description Complete a review. File reviews must be of files sent for review, and their line comments must refer to lines of a single hunk of the diff that was sent. Results for cancelled reviews or abandoned attempts are rejected with 409, results for deleted reviews with 410.
 // @Tags reviews
+// @Security ServiceSignature
 // @Accept json
 // @Produce json
 // @Param        completeReviewRequest  body  requests.CompleteReviewRequest  true  "Update review status request"
 // @Success      201  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Failure      410  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/reviews/complete [post]
 func (rc *ReviewsController) CompleteReview(c *fiber.Ctx) error {
@@ -451,12 +683,15 @@ func (rc *ReviewsController) CompleteReview(c *fiber.Ctx) error {
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not parse request body"})
 	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body", "error": err.Error()})
+	}
 
 	tx := db.GetDBTransaction(c)
 	if err := rc.reviewsService.CompleteReview(tx, &req); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not complete review",
-			"error":   err.Error,
+			"error":   err.Error(),
 		})
 	}
 
@@ -465,6 +700,50 @@ func (rc *ReviewsController) CompleteReview(c *fiber.Ctx) error {
 	})
 }
 
+// @Summary Get review events
+// @Description Get the history of status and progress changes of a review, along with how long the latest attempt waited in the queue and was processed.
+// @Tags reviews
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param        repositoryID  path  string  true  "Repository ID"
+// @Param        prID          path  string  true  "Pull request ID"
+// @Param        reviewID  path  string  true  "Review ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/events [get]
+func (rc *ReviewsController) GetReviewEvents(c *fiber.Ctx) error {
+	repoID, err := utils.ReadUintPathParam(c, "repositoryID")
+	if err != nil {
+		return err
+	}
+	prID, err := utils.ReadUintPathParam(c, "prID")
+	if err != nil {
+		return err
+	}
+	reviewID, err := utils.ReadUintPathParam(c, "reviewID")
+	if err != nil {
+		return err
+	}
+
+	tx := db.GetDBTransaction(c)
+	userID := middlewares.GetUserID(c)
+	events, err := rc.reviewsService.GetReviewEvents(tx, userID, repoID, prID, reviewID)
+	if err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"message": "Could not get review events",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Fetched review events successfully.",
+		"data":    events,
+	})
+}
+
 // write swagger docs
 // @Summary Get review progress
 // @Description Get review progress
@@ -477,6 +756,7 @@ func (rc *ReviewsController) CompleteReview(c *fiber.Ctx) error {
 // @Param        reviewID  path  string  true  "Review ID"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/repositories/{repositoryID}/pull-requests/{prID}/reviews/{reviewID}/progress [get]
 func (rc *ReviewsController) GetReviewProgress(c *fiber.Ctx) error {
@@ -494,9 +774,10 @@ func (rc *ReviewsController) GetReviewProgress(c *fiber.Ctx) error {
 	}
 
 	tx := db.GetDBTransaction(c)
-	reviewStatus, err := rc.reviewsService.GetReviewStatus(tx, repoID, prID, reviewID)
+	userID := middlewares.GetUserID(c)
+	reviewStatus, err := rc.reviewsService.GetReviewStatus(tx, userID, repoID, prID, reviewID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not get review progress",
 			"error":   err.Error(),
 		})
@@ -509,21 +790,24 @@ func (rc *ReviewsController) GetReviewProgress(c *fiber.Ctx) error {
 		"data": fiber.Map{
 			"status":   reviewStatus.Status,
 			"progress": reviewStatus.Progress,
+			"error":    reviewStatus.Error,
 		},
 	})
 }
 
 // generate swagger docs
 // @Summary Update review progress
-// @Description Update review progress
+// @Description Update review progress. Updates for cancelled reviews, abandoned attempts and illegal status transitions, e.g. from available back to queued, are rejected with 409. Updates for deleted reviews are rejected with 410.
 // @Tags reviews
-// @Security BearerAuth
+// @Security ServiceSignature
 // @Accept json
 // @Produce json
 // @Param        reviewStatusID  path  string  true  "Review Status ID"
 // @Param        updateReviewRequest  body  requests.UpdateReviewRequest  true  "Update review progress request"
 // @Success      200  {object}  map[string]interface{}
 // @Failure      400  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Failure      410  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
 // @Router       /api/v1/review-status/{reviewStatusID} [put]
 func (rc *ReviewsController) UpdateReviewProgress(c *fiber.Ctx) error {
@@ -535,10 +819,13 @@ func (rc *ReviewsController) UpdateReviewProgress(c *fiber.Ctx) error {
 	if err := c.BodyParser(&request); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not parse request body"})
 	}
+	if err := utils.ValidateStruct(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body", "error": err.Error()})
+	}
 
 	tx := db.GetDBTransaction(c)
-	if err := rc.reviewsService.UpdateReviewStatus(tx, reviewStatusID, request.Status, request.Progress); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	if err := rc.reviewsService.UpdateReviewStatus(tx, reviewStatusID, request.Attempt, request.Status, request.Progress, request.Error); err != nil {
+		return c.Status(errorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
 			"message": "Could not update review progress",
 			"error":   err.Error(),
 		})
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/internal/db"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
+
+type WebhooksController struct {
+	webhooksService *services.WebhooksService
+}
+
+// NewWebhooksController creates a new webhooks controller
+func NewWebhooksController(webhooksService *services.WebhooksService) *WebhooksController {
+	return &WebhooksController{webhooksService: webhooksService}
+}
+
+// @Summary GitHub webhook
+// @Description Receive pull request events from GitHub and sync the affected pull requests. Installation
+// @Description events of the GitHub App map the repositories of users linked to the installation account onto the installation used to access them.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param        X-GitHub-Event       header  string  true  "GitHub event type"
+// @Param        X-Hub-Signature-256  header  string  true  "HMAC-SHA256 signature of the payload"
+// @Success      200  {object}  map[string]interface{}
+// @Success      202  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /api/v1/webhooks/github [post]
+func (wc *WebhooksController) HandleGithubWebhook(c *fiber.Ctx) error {
+	eventType := c.Get(utils.GithubEventHeader)
+
+	switch eventType {
+	case "ping":
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "pong"})
+	case "pull_request":
+		event, err := utils.ParseGithubPullRequestEvent(c.Body())
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Could not parse event", "error": err.Error()})
+		}
+
+		tx := db.GetDBTransaction(c)
+		synced, err := wc.webhooksService.HandlePullRequestEvent(tx, event)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Could not sync pull request",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Pull request event processed",
+			"synced":  synced,
+		})
+	case "installation", "installation_repositories":
+		event, err := utils.ParseGithubInstallationEvent(eventType, c.Body())
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Could not parse event", "error": err.Error()})
+		}
+
+		tx := db.GetDBTransaction(c)
+		updated, err := wc.webhooksService.HandleInstallationEvent(tx, event)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Could not update repository installations",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Installation event processed",
+			"updated": updated,
+		})
+	default:
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Event ignored"})
+	}
+}
@@ -15,21 +15,7 @@ import (
 )
 
 func NewDB(cfg *config.DatabaseConfig) (*gorm.DB, error) {
-	var dsn string
-	switch cfg.DriverName {
-	case "pgx":
-		dsn = fmt.Sprintf("postgres://%s:%s@%s:%d/%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	case "cloudsqlpostgres":
-		var host string
-		if isIP(cfg.Host) {
-			host = fmt.Sprintf("[%s]", cfg.Host)
-		} else {
-			host = cfg.Host
-		}
-		dsn = fmt.Sprintf("host=%s user=%s dbname=%s password=%s sslmode=disable", host, cfg.User, cfg.DBName, cfg.Password)
-	default:
-		log.Fatalf("unsupported driver name: %s", cfg.DriverName)
-	}
+	dsn := dataSourceName(cfg)
 
 	log.Printf("connecting to database %s:%s\n", cfg.Host, cfg.DBName)
 
@@ -58,6 +44,24 @@ func NewDB(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 	return db, nil
 }
 
+func dataSourceName(cfg *config.DatabaseConfig) string {
+	switch cfg.DriverName {
+	case "pgx":
+		return fmt.Sprintf("postgres://%s:%s@%s:%d/%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	case "cloudsqlpostgres":
+		var host string
+		if isIP(cfg.Host) {
+			host = fmt.Sprintf("[%s]", cfg.Host)
+		} else {
+			host = cfg.Host
+		}
+		return fmt.Sprintf("host=%s user=%s dbname=%s password=%s sslmode=disable", host, cfg.User, cfg.DBName, cfg.Password)
+	default:
+		log.Fatalf("unsupported driver name: %s", cfg.DriverName)
+		return ""
+	}
+}
+
 func GetDBTransaction(c *fiber.Ctx) *gorm.DB {
 	tx, ok := c.Locals(string(middlewares.TxnKey)).(*gorm.DB)
 	if !ok {
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/proxy"
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+	"github.com/simondanielsson/apPRoved/cmd/config"
+)
+
+// Listener receives Postgres notifications. Each call to Listen opens a connection of its own, since
+// a pooled connection cannot wait for notifications.
+type Listener struct {
+	driverName string
+	dsn        string
+}
+
+// NewListener creates a listener that connects to the database the same way as NewDB
+func NewListener(cfg *config.DatabaseConfig) *Listener {
+	return &Listener{
+		driverName: cfg.DriverName,
+		dsn:        dataSourceName(cfg),
+	}
+}
+
+// Listen calls listening once it listens on channel, then hands the payload of every notification on
+// the channel to handle until ctx is done or the connection is lost
+func (l *Listener) Listen(ctx context.Context, channel string, listening func(), handle func(payload string)) error {
+	switch l.driverName {
+	case "pgx":
+		return l.listenPgx(ctx, channel, listening, handle)
+	case "cloudsqlpostgres":
+		return l.listenCloudSQL(ctx, channel, listening, handle)
+	default:
+		return fmt.Errorf("unsupported driver name: %s", l.driverName)
+	}
+}
+
+func (l *Listener) listenPgx(ctx context.Context, channel string, listening func(), handle func(payload string)) error {
+	conn, err := pgx.Connect(ctx, l.dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to listen on %s: %v", channel, err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", channel, err)
+	}
+	listening()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to wait for notifications on %s: %v", channel, err)
+		}
+		handle(notification.Payload)
+	}
+}
+
+// listenCloudSQL listens through the Cloud SQL proxy. The pq listener reconnects by itself, but
+// notifications sent while it was disconnected are lost, so a lost connection ends the listen.
+func (l *Listener) listenCloudSQL(ctx context.Context, channel string, listening func(), handle func(payload string)) error {
+	lost := make(chan error, 1)
+	listener := pq.NewDialListener(cloudSQLDialer{}, l.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if event != pq.ListenerEventDisconnected && event != pq.ListenerEventConnectionAttemptFailed {
+			return
+		}
+		select {
+		case lost <- err:
+		default:
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", channel, err)
+	}
+	listening()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-lost:
+			return fmt.Errorf("lost connection listening on %s: %v", channel, err)
+		case notification := <-listener.Notify:
+			// a nil notification follows a reconnect
+			if notification == nil {
+				return fmt.Errorf("lost connection listening on %s", channel)
+			}
+			handle(notification.Extra)
+		}
+	}
+}
+
+var cloudSQLInstanceRegexp = regexp.MustCompile(`^\[(.+)\]:[0-9]+$`)
+
+// cloudSQLDialer dials Cloud SQL instances through the proxy like the cloudsqlpostgres driver
+type cloudSQLDialer struct{}
+
+func (d cloudSQLDialer) Dial(network, addr string) (net.Conn, error) {
+	matches := cloudSQLInstanceRegexp.FindStringSubmatch(addr)
+	if len(matches) != 2 {
+		return nil, fmt.Errorf("failed to parse addr: %q. It should conform to the regular expression %q", addr, cloudSQLInstanceRegexp)
+	}
+	return proxy.Dial(matches[1])
+}
+
+func (d cloudSQLDialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	return nil, fmt.Errorf("timeout is not currently supported for cloudsqlpostgres dialer")
+}
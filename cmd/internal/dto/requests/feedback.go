@@ -0,0 +1,11 @@
+package requests
+
+import "github.com/simondanielsson/apPRoved/cmd/constants"
+
+// UpdateFeedbackRequest updates the caller's feedback. Fields missing from the request are left unchanged.
+type UpdateFeedbackRequest struct {
+	Vote          *constants.FeedbackVote `json:"vote" enums:"up,down,none"`
+	Resolved      *bool                   `json:"resolved"`
+	Dismissed     *bool                   `json:"dismissed"`
+	DismissReason *string                 `json:"dismiss_reason"`
+}
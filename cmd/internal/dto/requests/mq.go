@@ -1,9 +1,54 @@
 package requests
 
-import "github.com/simondanielsson/apPRoved/pkg/utils"
+import (
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
 
+// FileDiffReviewRequest is published on the file diffs queue for the review service. Context tells which
+// of the contents of the file diffs are filled in.
 type FileDiffReviewRequest struct {
-	ReviewID       uint                                  `json:"review_id" validate:"required"`
-	ReviewStatusID uint                                  `json:"review_status_id" validate:"required"`
-	FileDiffs      []*utils.GithubPullRequestFileChanges `json:"file_diffs" validate:"required"`
+	ReviewID       uint                    `json:"review_id" validate:"required"`
+	ReviewStatusID uint                    `json:"review_status_id" validate:"required"`
+	Attempt        int                     `json:"attempt" validate:"required,min=1"`
+	HeadSHA        string                  `json:"head_sha" validate:"required"`
+	BaseSHA        string                  `json:"base_sha"`
+	Mode           constants.ReviewMode    `json:"mode"`
+	SinceSHA       string                  `json:"since_sha,omitempty"`
+	Context        constants.ReviewContext `json:"context,omitempty"`
+	FileDiffs      []*FileDiff             `json:"file_diffs" validate:"required"`
+}
+
+// FileDiff is a file to review. In full context HeadContent and BaseContent hold the versions of the file
+// the diff compares, and are nil if the file was added or removed. In lines context Excerpts hold the lines
+// of the head version around the hunks. ContentOmitted tells why content was left out.
+type FileDiff struct {
+	*utils.GithubPullRequestFileChanges
+	HeadContent    *string                        `json:"head_content,omitempty"`
+	BaseContent    *string                        `json:"base_content,omitempty"`
+	Excerpts       []*utils.FileExcerpt           `json:"excerpts,omitempty"`
+	ContentOmitted constants.ContentOmittedReason `json:"content_omitted,omitempty"`
+}
+
+// ReviewCancellationMessage is published on the review cancellations queue when a review is cancelled or
+// deleted while the review service may be working on it. Results sent for the review afterwards are rejected.
+type ReviewCancellationMessage struct {
+	ReviewID       uint   `json:"review_id" validate:"required"`
+	ReviewStatusID uint   `json:"review_status_id" validate:"required"`
+	Attempt        int    `json:"attempt" validate:"required,min=1"`
+	Reason         string `json:"reason"`
+}
+
+// ReviewResultMessage is sent by the review service on the review results queue. Progress messages
+// carry Status and Progress, complete messages carry FileReviews and failed messages carry Error. Attempt
+// is the attempt of the file diffs message the results are for.
+type ReviewResultMessage struct {
+	Type           constants.ReviewResultType `json:"type" validate:"required,oneof=progress complete failed"`
+	ReviewID       uint                       `json:"review_id" validate:"required"`
+	ReviewStatusID uint                       `json:"review_status_id" validate:"required"`
+	Attempt        int                        `json:"attempt" validate:"required,min=1"`
+	Status         constants.ReviewStatus     `json:"status"`
+	Progress       int                        `json:"progress" validate:"min=0,max=100"`
+	Error          string                     `json:"error,omitempty"`
+	FileReviews    []FileReviewRequest        `json:"file_reviews" validate:"dive"`
 }
@@ -8,23 +8,61 @@ type CreateRepositoryRequest struct {
 	Owner string `json:"owner"`
 }
 
+type UpdateRepositorySettingsRequest struct {
+	AutoReview                *bool `json:"auto_review"`
+	AutoReviewDebounceSeconds *int  `json:"auto_review_debounce_seconds"`
+	PublishToGithub           *bool `json:"publish_to_github"`
+}
+
+// CreateReviewRequest requests a review of a pull request. The file limits override the server
+// defaults. Files matching an Include pattern are reviewed even if they are generated or vendored.
+// Context selects what is sent along with the diff of each file, with ContextLines lines around each
+// hunk in lines mode.
 type CreateReviewRequest struct {
-	Name string `json:"name"`
+	Name          string                  `json:"name"`
+	Mode          constants.ReviewMode    `json:"mode" enums:"full,incremental"`
+	MaxFiles      int                     `json:"max_files,omitempty"`
+	MaxPatchBytes int                     `json:"max_patch_bytes,omitempty"`
+	Include       []string                `json:"include,omitempty"`
+	Exclude       []string                `json:"exclude,omitempty"`
+	Context       constants.ReviewContext `json:"context,omitempty" enums:"none,lines,full"`
+	ContextLines  int                     `json:"context_lines,omitempty"`
 }
 
+// FileReviewRequest is the review of a file. The file metadata and patch are taken from the file diff
+// that was sent for review, so the review service only returns its findings.
 type FileReviewRequest struct {
-	Filename string `json:"filename"`
-	Content  string `json:"content"`
-	Patch    string `json:"patch"`
+	Filename string                 `json:"filename" validate:"required"`
+	Content  string                 `json:"content"`
+	Comments []ReviewCommentRequest `json:"comments" validate:"dive"`
+}
+
+// ReviewCommentRequest is a comment on lines of a file's diff. EndLine defaults to StartLine, Side to
+// RIGHT and Severity to info.
+type ReviewCommentRequest struct {
+	Side       constants.CommentSide     `json:"side" enums:"LEFT,RIGHT" validate:"omitempty,oneof=LEFT RIGHT"`
+	StartLine  int                       `json:"start_line" validate:"min=1"`
+	EndLine    int                       `json:"end_line" validate:"omitempty,gtefield=StartLine"`
+	Severity   constants.CommentSeverity `json:"severity" enums:"info,minor,major,critical" validate:"omitempty,oneof=info minor major critical"`
+	Category   string                    `json:"category"`
+	Body       string                    `json:"body" validate:"required"`
+	Suggestion *string                   `json:"suggestion"`
 }
 
+// CompleteReviewRequest holds the results of a review. Attempt is the attempt of the file diffs message
+// the results are for.
 type CompleteReviewRequest struct {
-	ReviewID       uint                `json:"review_id"`
-	ReviewStatusID uint                `json:"review_status_id"`
-	FileReviews    []FileReviewRequest `json:"file_reviews"`
+	ReviewID       uint                `json:"review_id" validate:"required"`
+	ReviewStatusID uint                `json:"review_status_id" validate:"required"`
+	Attempt        int                 `json:"attempt" validate:"required,min=1"`
+	FileReviews    []FileReviewRequest `json:"file_reviews" validate:"dive"`
 }
 
+// UpdateReviewRequest reports the progress of a review. Error tells why a review failed. Attempt is the
+// attempt of the file diffs message the update is for.
 type UpdateReviewRequest struct {
-	Progress int                    `json:"progress"`
-	Status   constants.ReviewStatus `json:"status"`
+	Attempt  int                    `json:"attempt" validate:"required,min=1"`
+	Progress int                    `json:"progress" validate:"min=0,max=100"`
+	Status   constants.ReviewStatus `json:"status" enums:"queued,processing,available,failed" validate:"required"`
+	Error    string                 `json:"error,omitempty"`
 }
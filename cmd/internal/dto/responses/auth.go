@@ -1,5 +1,10 @@
 package responses
 
+import "time"
+
 type LoginResponse struct {
-	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Token                 string    `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresAt             time.Time `json:"expires_at"`
+	RefreshToken          string    `json:"refresh_token" example:"b3BhcXVlLXJlZnJlc2gtdG9rZW4..."`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
 }
@@ -0,0 +1,36 @@
+package responses
+
+import (
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+)
+
+type GetFeedbackResponse struct {
+	FileReviewID    uint                   `json:"file_review_id"`
+	ReviewCommentID *uint                  `json:"review_comment_id,omitempty"`
+	Vote            constants.FeedbackVote `json:"vote"`
+	Resolved        bool                   `json:"resolved"`
+	Dismissed       bool                   `json:"dismissed"`
+	DismissReason   string                 `json:"dismiss_reason,omitempty"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+type GetFeedbackSummaryResponse struct {
+	RepositoryID uint                     `json:"repository_id"`
+	Since        time.Time                `json:"since"`
+	Total        *FeedbackStatsResponse   `json:"total"`
+	Weeks        []*FeedbackStatsResponse `json:"weeks"`
+}
+
+// FeedbackStatsResponse counts feedback on file reviews. Usefulness is the share of upvotes among all
+// votes, and is omitted when there are no votes.
+type FeedbackStatsResponse struct {
+	Week        *time.Time `json:"week,omitempty"`
+	FileReviews int        `json:"file_reviews"`
+	Upvotes     int        `json:"upvotes"`
+	Downvotes   int        `json:"downvotes"`
+	Resolved    int        `json:"resolved"`
+	Dismissed   int        `json:"dismissed"`
+	Usefulness  *float64   `json:"usefulness,omitempty"`
+}
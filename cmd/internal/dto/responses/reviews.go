@@ -7,12 +7,20 @@ import (
 )
 
 type GetRepositoriesResponse struct {
-	ID        uint      `json:"id"`
-	Name      string    `json:"name"`
-	Owner     string    `json:"owner"`
-	URL       string    `json:"url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	URL   string `json:"url"`
+	// InstallationID is the GitHub App installation used to access the repository, if any
+	InstallationID *int64    `json:"installation_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type GetRepositorySettingsResponse struct {
+	AutoReview                bool `json:"auto_review"`
+	AutoReviewDebounceSeconds int  `json:"auto_review_debounce_seconds"`
+	PublishToGithub           bool `json:"publish_to_github"`
 }
 
 type GetPullRequestResponse struct {
@@ -26,26 +34,94 @@ type GetPullRequestResponse struct {
 }
 
 type GetReviewsResponse struct {
-	ID        uint                   `json:"id"`
-	Title     string                 `json:"title"`
-	Status    constants.ReviewStatus `json:"status"`
-	Progress  int                    `json:"progress"`
-	CreatedAt time.Time              `json:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at"`
+	ID          uint                   `json:"id"`
+	Title       string                 `json:"title"`
+	Status      constants.ReviewStatus `json:"status"`
+	Progress    int                    `json:"progress"`
+	Error       string                 `json:"error,omitempty"`
+	HeadSHA     string                 `json:"head_sha"`
+	BaseSHA     string                 `json:"base_sha"`
+	Mode        string                 `json:"mode"`
+	SinceSHA    string                 `json:"since_sha,omitempty"`
+	Outdated    bool                   `json:"outdated"`
+	PublishedAt *time.Time             `json:"published_at,omitempty"`
+	// SkippedFiles counts the files left out of the review by reason
+	SkippedFiles map[constants.SkipReason]int `json:"skipped_files,omitempty"`
+	CreatedAt    time.Time                    `json:"created_at"`
+	UpdatedAt    time.Time                    `json:"updated_at"`
+}
+
+type PublishReviewResponse struct {
+	GithubReviewID int64     `json:"github_review_id"`
+	PublishedAt    time.Time `json:"published_at"`
 }
 
 type GetReviewResponse struct {
-	ID          uint                     `json:"id"`
-	FileReviews []*GetFileReviewResponse `json:"file_reviews"`
-	CreatedAt   time.Time                `json:"created_at"`
-	UpdatedAt   time.Time                `json:"updated_at"`
+	ID           uint                      `json:"id"`
+	FileReviews  []*GetFileReviewResponse  `json:"file_reviews"`
+	SkippedFiles []*GetSkippedFileResponse `json:"skipped_files"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	UpdatedAt    time.Time                 `json:"updated_at"`
 }
 
 type GetFileReviewResponse struct {
-	ID        uint      `json:"id"`
-	Filename  string    `json:"filename"`
-	Content   string    `json:"content"`
-	Patch     string    `json:"patch"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID               uint                        `json:"id"`
+	Filename         string                      `json:"filename"`
+	PreviousFilename string                      `json:"previous_filename,omitempty"`
+	Status           string                      `json:"status"`
+	SHA              string                      `json:"sha"`
+	RawURL           string                      `json:"raw_url"`
+	Language         string                      `json:"language"`
+	Class            string                      `json:"class"`
+	Content          string                      `json:"content"`
+	Patch            string                      `json:"patch"`
+	Comments         []*GetReviewCommentResponse `json:"comments"`
+	CreatedAt        time.Time                   `json:"created_at"`
+	UpdatedAt        time.Time                   `json:"updated_at"`
+}
+
+type GetSkippedFileResponse struct {
+	Filename  string               `json:"filename"`
+	Reason    constants.SkipReason `json:"reason"`
+	Additions int                  `json:"additions"`
+	Deletions int                  `json:"deletions"`
+}
+
+type GetReviewCommentResponse struct {
+	ID         uint                      `json:"id"`
+	Side       constants.CommentSide     `json:"side"`
+	StartLine  int                       `json:"start_line"`
+	EndLine    int                       `json:"end_line"`
+	Severity   constants.CommentSeverity `json:"severity"`
+	Category   string                    `json:"category"`
+	Body       string                    `json:"body"`
+	Suggestion *string                   `json:"suggestion,omitempty"`
+}
+
+// GetReviewEventsResponse is the history of a review. Attempts counts how often the review was queued.
+// The queue wait and processing time cover the latest attempt, the total time runs from the creation of
+// the review to the end of the latest attempt. Durations are in seconds and missing until they end.
+type GetReviewEventsResponse struct {
+	Events            []*GetReviewEventResponse `json:"events"`
+	Attempts          int                       `json:"attempts"`
+	QueueWaitSeconds  *float64                  `json:"queue_wait_seconds,omitempty"`
+	ProcessingSeconds *float64                  `json:"processing_seconds,omitempty"`
+	TotalSeconds      *float64                  `json:"total_seconds,omitempty"`
+}
+
+type GetReviewEventResponse struct {
+	ID        uint                   `json:"id"`
+	Status    constants.ReviewStatus `json:"status"`
+	Progress  int                    `json:"progress"`
+	Message   string                 `json:"message,omitempty"`
+	Actor     constants.ReviewActor  `json:"actor"`
+	UserID    *uint                  `json:"user_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// GetReviewProgressResponse is the status of a review when a client starts streaming its changes
+type GetReviewProgressResponse struct {
+	Status   constants.ReviewStatus `json:"status"`
+	Progress int                    `json:"progress"`
+	Error    string                 `json:"error,omitempty"`
 }
@@ -0,0 +1,210 @@
+package eventbus
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+)
+
+// subscriptionBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriptionBuffer = 64
+
+// Bus delivers review events to the subscribers of their reviews once the transactions that recorded
+// them have committed
+type Bus interface {
+	// Subscribe starts delivering the events of a review. The subscription must be closed when it is
+	// no longer used.
+	Subscribe(reviewID uint) *Subscription
+	// Publish delivers committed events to the subscribers of their reviews
+	Publish(ctx context.Context, events []*models.ReviewEvent) error
+	// Close drops all subscribers, which lets open streams end on shutdown
+	Close()
+}
+
+// Subscription receives the events of a single review
+type Subscription struct {
+	hub      *hub
+	reviewID uint
+	events   chan *models.ReviewEvent
+}
+
+// Events returns the events of the review. The channel is closed when the subscription is closed, when
+// the subscriber fell too far behind or may have missed events, or when the bus is closed. A subscription
+// opened while the bus cannot receive events is closed right away.
+func (s *Subscription) Events() <-chan *models.ReviewEvent {
+	return s.events
+}
+
+// Close stops the delivery of events to the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// hub keeps the subscribers of a single process and delivers events to them. Subscriptions are only
+// accepted while the hub is listening, i.e. receives all events published.
+type hub struct {
+	mu          sync.Mutex
+	closed      bool
+	listening   bool
+	subscribers map[uint]map[*Subscription]struct{}
+}
+
+func newHub(listening bool) *hub {
+	return &hub{
+		listening:   listening,
+		subscribers: make(map[uint]map[*Subscription]struct{}),
+	}
+}
+
+func (h *hub) subscribe(reviewID uint) *Subscription {
+	subscription := &Subscription{
+		hub:      h,
+		reviewID: reviewID,
+		events:   make(chan *models.ReviewEvent, subscriptionBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed || !h.listening {
+		close(subscription.events)
+		return subscription
+	}
+	if h.subscribers[reviewID] == nil {
+		h.subscribers[reviewID] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[reviewID][subscription] = struct{}{}
+	return subscription
+}
+
+// deliver hands events to the subscribers of their reviews. Subscribers that cannot keep up are dropped
+// rather than slowing down the publisher.
+func (h *hub) deliver(events []*models.ReviewEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, event := range events {
+		for subscription := range h.subscribers[event.ReviewID] {
+			select {
+			case subscription.events <- event:
+			default:
+				h.remove(subscription)
+			}
+		}
+	}
+}
+
+// listen starts accepting subscriptions once the hub receives all events published
+func (h *hub) listen() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listening = true
+}
+
+// stopListening drops all subscribers, since they may miss events, and closes later subscriptions right
+// away until the hub listens again
+func (h *hub) stopListening() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listening = false
+	h.removeAll()
+}
+
+// close drops all subscribers and closes later subscriptions right away
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	h.removeAll()
+}
+
+// removeAll drops all subscribers. The caller must hold the lock.
+func (h *hub) removeAll() {
+	for _, subscriptions := range h.subscribers {
+		for subscription := range subscriptions {
+			h.remove(subscription)
+		}
+	}
+}
+
+// remove drops a subscription. The caller must hold the lock.
+func (h *hub) remove(subscription *Subscription) {
+	subscriptions, ok := h.subscribers[subscription.reviewID]
+	if !ok {
+		return
+	}
+	if _, ok := subscriptions[subscription]; !ok {
+		return
+	}
+
+	delete(subscriptions, subscription)
+	if len(subscriptions) == 0 {
+		delete(h.subscribers, subscription.reviewID)
+	}
+	close(subscription.events)
+}
+
+type collectorKey struct{}
+
+// collector holds the events recorded in a transaction until it commits
+type collector struct {
+	mu     sync.Mutex
+	events []*models.ReviewEvent
+}
+
+// WithCollector returns a context that collects the events recorded in transactions started with it.
+// The collected events are published by PublishCollected once the transaction has committed.
+func WithCollector(ctx context.Context) context.Context {
+	return context.WithValue(ctx, collectorKey{}, &collector{})
+}
+
+// Collect queues events recorded in tx to be published once tx commits. Events recorded in a
+// transaction that was not started with WithCollector are not published.
+func Collect(tx *gorm.DB, events []*models.ReviewEvent) {
+	collector, ok := tx.Statement.Context.Value(collectorKey{}).(*collector)
+	if !ok {
+		return
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.events = append(collector.events, events...)
+}
+
+// PublishCollected publishes the events collected in ctx to bus. It must only be called once the
+// transaction has committed. The events are already stored, so a failure to publish them is only
+// logged; clients streaming the reviews see the change when they fetch the status again.
+func PublishCollected(ctx context.Context, bus Bus) {
+	collector, ok := ctx.Value(collectorKey{}).(*collector)
+	if !ok {
+		return
+	}
+
+	collector.mu.Lock()
+	events := collector.events
+	collector.events = nil
+	collector.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	if err := bus.Publish(ctx, events); err != nil {
+		log.Printf("Could not publish %d review events: %v", len(events), err)
+	}
+}
+
+// Transaction runs fn in a transaction like gorm.DB.Transaction, and publishes the events recorded in
+// it to bus once it has committed
+func Transaction(ctx context.Context, bus Bus, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	ctx = WithCollector(ctx)
+	if err := db.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+
+	PublishCollected(ctx, bus)
+	return nil
+}
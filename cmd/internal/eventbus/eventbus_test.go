@@ -0,0 +1,121 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+)
+
+// receive returns the next event of a subscription, or nil once its channel is closed
+func receive(t *testing.T, subscription *Subscription) *models.ReviewEvent {
+	t.Helper()
+	select {
+	case event := <-subscription.Events():
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event for review %d", subscription.reviewID)
+		return nil
+	}
+}
+
+func TestMemoryBusDeliversEventsOfSubscribedReviews(t *testing.T) {
+	bus := NewMemoryBus()
+	first := bus.Subscribe(1)
+	second := bus.Subscribe(1)
+	other := bus.Subscribe(2)
+
+	if err := bus.Publish(context.Background(), []*models.ReviewEvent{{ID: 10, ReviewID: 1}, {ID: 11, ReviewID: 3}}); err != nil {
+		t.Fatalf("could not publish events: %v", err)
+	}
+	for _, subscription := range []*Subscription{first, second} {
+		if event := receive(t, subscription); event == nil || event.ID != 10 {
+			t.Errorf("subscriber of review 1 received %+v, want event 10", event)
+		}
+	}
+	select {
+	case event := <-other.Events():
+		t.Errorf("subscriber of review 2 received %+v", event)
+	default:
+	}
+
+	first.Close()
+	first.Close()
+	if event := receive(t, first); event != nil {
+		t.Errorf("closed subscription received %+v", event)
+	}
+	if len(bus.hub.subscribers[1]) != 1 {
+		t.Errorf("review 1 has %d subscribers after one closed, want 1", len(bus.hub.subscribers[1]))
+	}
+}
+
+func TestMemoryBusDropsSlowSubscribers(t *testing.T) {
+	bus := NewMemoryBus()
+	subscription := bus.Subscribe(1)
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		_ = bus.Publish(context.Background(), []*models.ReviewEvent{{ID: uint(i), ReviewID: 1}})
+	}
+
+	for i := 0; i < subscriptionBuffer; i++ {
+		if event := receive(t, subscription); event == nil || event.ID != uint(i) {
+			t.Fatalf("received %+v, want event %d", event, i)
+		}
+	}
+	if event := receive(t, subscription); event != nil {
+		t.Errorf("subscriber that fell behind received %+v, want its channel closed", event)
+	}
+}
+
+func TestMemoryBusClose(t *testing.T) {
+	bus := NewMemoryBus()
+	subscription := bus.Subscribe(1)
+
+	bus.Close()
+	if event := receive(t, subscription); event != nil {
+		t.Errorf("subscription received %+v after the bus closed", event)
+	}
+	if event := receive(t, bus.Subscribe(1)); event != nil {
+		t.Errorf("subscription opened after the bus closed received %+v", event)
+	}
+}
+
+func TestPublishCollected(t *testing.T) {
+	bus := NewMemoryBus()
+	subscription := bus.Subscribe(1)
+
+	ctx := WithCollector(context.Background())
+	tx := &gorm.DB{Statement: &gorm.Statement{Context: ctx}}
+	Collect(tx, []*models.ReviewEvent{{ID: 1, ReviewID: 1}})
+	Collect(tx, []*models.ReviewEvent{{ID: 2, ReviewID: 1}})
+	select {
+	case event := <-subscription.Events():
+		t.Fatalf("received %+v before the events were published", event)
+	default:
+	}
+
+	PublishCollected(ctx, bus)
+	PublishCollected(ctx, bus)
+	for _, id := range []uint{1, 2} {
+		if event := receive(t, subscription); event == nil || event.ID != id {
+			t.Errorf("received %+v, want event %d", event, id)
+		}
+	}
+	select {
+	case event := <-subscription.Events():
+		t.Errorf("received %+v, want the events published only once", event)
+	default:
+	}
+
+	// events recorded outside of a collecting transaction are not published
+	tx = &gorm.DB{Statement: &gorm.Statement{Context: context.Background()}}
+	Collect(tx, []*models.ReviewEvent{{ID: 3, ReviewID: 1}})
+	PublishCollected(context.Background(), bus)
+	select {
+	case event := <-subscription.Events():
+		t.Errorf("received %+v recorded without a collector", event)
+	default:
+	}
+}
@@ -0,0 +1,32 @@
+package eventbus
+
+import (
+	"context"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+)
+
+// MemoryBus delivers events within a single process. It suits a single replica and tests.
+type MemoryBus struct {
+	hub *hub
+}
+
+// NewMemoryBus creates a new in-memory event bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		hub: newHub(true),
+	}
+}
+
+func (b *MemoryBus) Subscribe(reviewID uint) *Subscription {
+	return b.hub.subscribe(reviewID)
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, events []*models.ReviewEvent) error {
+	b.hub.deliver(events)
+	return nil
+}
+
+func (b *MemoryBus) Close() {
+	b.hub.close()
+}
@@ -0,0 +1,120 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxNotificationPayload is the largest payload Postgres accepts for a notification, in bytes
+const maxNotificationPayload = 7999
+
+// Listener receives the notifications sent on a Postgres channel over a dedicated connection
+type Listener interface {
+	// Listen calls listening once it listens on channel, then hands the payload of every notification
+	// on the channel to handle until ctx is done or the connection is lost
+	Listen(ctx context.Context, channel string, listening func(), handle func(payload string)) error
+}
+
+// PostgresBus fans events out to the subscribers of all replicas. Events are sent with pg_notify, and
+// every replica listens on the channel and delivers them to its own subscribers, including those of
+// the replica that published them. Subscriptions are closed right away while the replica does not listen.
+type PostgresBus struct {
+	hub      *hub
+	db       *gorm.DB
+	listener Listener
+	channel  string
+}
+
+// NewPostgresBus creates a new event bus that sends events on a Postgres notification channel
+func NewPostgresBus(db *gorm.DB, listener Listener, channel string) *PostgresBus {
+	return &PostgresBus{
+		hub:      newHub(false),
+		db:       db,
+		listener: listener,
+		channel:  channel,
+	}
+}
+
+func (b *PostgresBus) Subscribe(reviewID uint) *Subscription {
+	return b.hub.subscribe(reviewID)
+}
+
+// Publish sends each event in a notification of its own, since a notification is limited to 8000
+// bytes. Messages too long for a notification are shortened.
+func (b *PostgresBus) Publish(ctx context.Context, events []*models.ReviewEvent) error {
+	for _, event := range events {
+		payload, err := notificationPayload(event)
+		if err != nil {
+			return err
+		}
+		if err := b.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", b.channel, payload).Error; err != nil {
+			return fmt.Errorf("failed to notify review event %d: %v", event.ID, err)
+		}
+	}
+	return nil
+}
+
+func (b *PostgresBus) Close() {
+	b.hub.close()
+}
+
+// Listen delivers the events published by all replicas to the local subscribers until ctx is done or
+// the connection is lost. Subscriptions are accepted once it listens on the channel. Local subscribers
+// are dropped when it returns, since they may miss events until it listens again.
+func (b *PostgresBus) Listen(ctx context.Context) error {
+	defer b.hub.stopListening()
+
+	return b.listener.Listen(ctx, b.channel, b.hub.listen, func(payload string) {
+		var event models.ReviewEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			log.Printf("Could not parse review event notification: %v", err)
+			return
+		}
+		b.hub.deliver([]*models.ReviewEvent{&event})
+	})
+}
+
+func notificationPayload(event *models.ReviewEvent) (string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode review event %d: %v", event.ID, err)
+	}
+
+	if len(payload) <= maxNotificationPayload {
+		return string(payload), nil
+	}
+
+	shortened := *event
+	shortened.Message = ""
+	withoutMessage, err := json.Marshal(&shortened)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode review event %d: %v", event.ID, err)
+	}
+	room := maxNotificationPayload - len(withoutMessage)
+	if event.Message == "" || room <= 0 {
+		return "", fmt.Errorf("review event %d is too large for a notification", event.ID)
+	}
+
+	// escaped characters take more room in the payload than in the message, so the message is cut in
+	// proportion to its encoded length, and encoded again in case it still does not fit
+	encoded := len(payload) - len(withoutMessage)
+	shortened.Message = truncate(event.Message, len(event.Message)*room/encoded)
+	return notificationPayload(&shortened)
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
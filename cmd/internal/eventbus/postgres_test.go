@@ -0,0 +1,121 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+)
+
+// fakeListener hands the payloads sent on its channel to the bus. Closing payloads loses the connection.
+type fakeListener struct {
+	ready    chan struct{}
+	payloads chan string
+}
+
+func newFakeListener() *fakeListener {
+	return &fakeListener{
+		ready:    make(chan struct{}),
+		payloads: make(chan string),
+	}
+}
+
+func (l *fakeListener) Listen(ctx context.Context, channel string, listening func(), handle func(payload string)) error {
+	listening()
+	close(l.ready)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case payload, ok := <-l.payloads:
+			if !ok {
+				return errors.New("connection lost")
+			}
+			handle(payload)
+		}
+	}
+}
+
+func TestPostgresBusOnlySubscribesWhileListening(t *testing.T) {
+	listener := newFakeListener()
+	bus := NewPostgresBus(nil, listener, "review_events")
+
+	if event := receive(t, bus.Subscribe(1)); event != nil {
+		t.Errorf("subscription opened before listening received %+v", event)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- bus.Listen(context.Background())
+	}()
+	<-listener.ready
+
+	subscription := bus.Subscribe(1)
+	listener.payloads <- "not json"
+	listener.payloads <- `{"id": 7, "review_id": 2}`
+	listener.payloads <- `{"id": 8, "review_id": 1, "message": "processing"}`
+	if event := receive(t, subscription); event == nil || event.ID != 8 || event.Message != "processing" {
+		t.Errorf("received %+v, want event 8", event)
+	}
+
+	close(listener.payloads)
+	if err := <-done; err == nil {
+		t.Error("Listen() returned no error after the connection was lost")
+	}
+	if event := receive(t, subscription); event != nil {
+		t.Errorf("subscription received %+v after the listener stopped", event)
+	}
+	if event := receive(t, bus.Subscribe(1)); event != nil {
+		t.Errorf("subscription opened while not listening received %+v", event)
+	}
+}
+
+func TestNotificationPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		shortened bool
+	}{
+		{name: "short message", message: "review created"},
+		{name: "long message", message: strings.Repeat("a", 2*maxNotificationPayload), shortened: true},
+		{name: "escaped characters", message: strings.Repeat(`<"\>`, maxNotificationPayload), shortened: true},
+		{name: "multibyte characters", message: strings.Repeat("é€😀", maxNotificationPayload), shortened: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.ReviewEvent{ID: 1, ReviewID: 2, Status: "failed", Message: tt.message, CreatedAt: time.Now()}
+
+			payload, err := notificationPayload(event)
+			if err != nil {
+				t.Fatalf("notificationPayload() failed: %v", err)
+			}
+			if len(payload) > maxNotificationPayload {
+				t.Errorf("payload is %d bytes, want at most %d", len(payload), maxNotificationPayload)
+			}
+
+			var decoded models.ReviewEvent
+			if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+				t.Fatalf("could not decode payload: %v", err)
+			}
+			if decoded.ID != event.ID || decoded.ReviewID != event.ReviewID || decoded.Status != event.Status {
+				t.Errorf("decoded %+v, want event 1 of review 2", decoded)
+			}
+			if !utf8.ValidString(decoded.Message) || !strings.HasPrefix(tt.message, decoded.Message) {
+				t.Errorf("message was not cut at a character boundary")
+			}
+			if shortened := decoded.Message != tt.message; shortened != tt.shortened {
+				t.Errorf("message shortened is %v, want %v", shortened, tt.shortened)
+			}
+			if tt.shortened && len(payload) < maxNotificationPayload*9/10 {
+				t.Errorf("payload is %d bytes, want the message shortened no more than needed", len(payload))
+			}
+		})
+	}
+}
@@ -2,32 +2,77 @@ package middlewares
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
 	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
 )
 
-// AuthMiddleware is a middleware that checks if the request has a valid JWT token, and attaches the user ID to the context.
-func AuthMiddleware(c *fiber.Ctx) error {
+// GetAuthMiddleware returns a middleware that checks if the request has a valid JWT token that has not
+// been revoked, and attaches the user ID and token ID to the context.
+func GetAuthMiddleware(db *gorm.DB, authService *services.AuthService) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if status, message := authenticate(c, db, authService); status != fiber.StatusOK {
+			return c.Status(status).JSON(fiber.Map{"message": message})
+		}
+		return c.Next()
+	}
+}
+
+// GetOptionalAuthMiddleware returns a middleware that attaches the user ID and token ID to the context
+// if the request has a valid JWT token, and lets requests without one through as anonymous requests.
+func GetOptionalAuthMiddleware(db *gorm.DB, authService *services.AuthService) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if status, _ := authenticate(c, db, authService); status == fiber.StatusInternalServerError {
+			return c.Status(status).JSON(fiber.Map{"message": "Authorization failed"})
+		}
+		return c.Next()
+	}
+}
+
+// authenticate attaches the user ID and token ID of the request's JWT token to the context. It returns
+// the status and message to fail the request with if the request has no valid token.
+func authenticate(c *fiber.Ctx, db *gorm.DB, authService *services.AuthService) (int, string) {
 	var token string
 
 	authHeader := c.Get("Authorization")
 	if authHeader != "" {
-		token = authHeader[len("Bearer "):]
+		var ok bool
+		token, ok = strings.CutPrefix(authHeader, "Bearer ")
+		if !ok {
+			return fiber.StatusUnauthorized, "invalid authorization header"
+		}
 	} else {
 		token = c.Cookies("token")
 	}
 
 	if token == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Authorization failed"})
+		return fiber.StatusUnauthorized, "Authorization failed"
 	}
 
 	claims, err := utils.ParseJWTToken(token)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "invalid token"})
+		return fiber.StatusUnauthorized, "invalid token"
+	}
+
+	if claims.Id != "" {
+		revoked, err := authService.IsTokenRevoked(db.WithContext(c.UserContext()), claims.Id)
+		if err != nil {
+			log.Printf("Could not check revocation of token: %v", err)
+			return fiber.StatusInternalServerError, "Authorization failed"
+		}
+		if revoked {
+			return fiber.StatusUnauthorized, "token revoked"
+		}
 	}
+
 	c.Locals("userID", claims.UserID)
-	return c.Next()
+	c.Locals("tokenID", claims.Id)
+	c.Locals("tokenExpiresAt", time.Unix(claims.ExpiresAt, 0))
+	return fiber.StatusOK, ""
 }
 
 func GetUserID(c *fiber.Ctx) uint {
@@ -37,3 +82,20 @@ func GetUserID(c *fiber.Ctx) uint {
 	}
 	return userID
 }
+
+// GetOptionalUserID returns the ID of the signed in user, or nil for anonymous requests. Make sure to use
+// the OptionalAuthMiddleware before calling GetOptionalUserID.
+func GetOptionalUserID(c *fiber.Ctx) *uint {
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		return nil
+	}
+	return &userID
+}
+
+// GetAccessToken returns the ID and expiry of the access token of the request
+func GetAccessToken(c *fiber.Ctx) (string, time.Time) {
+	tokenID, _ := c.Locals("tokenID").(string)
+	expiresAt, _ := c.Locals("tokenExpiresAt").(time.Time)
+	return tokenID, expiresAt
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
+
+// GetGithubWebhookMiddleware returns a middleware that rejects webhook deliveries whose
+// X-Hub-Signature-256 does not match the configured webhook secret.
+func GetGithubWebhookMiddleware(cfg *config.GithubConfig) func(*fiber.Ctx) error {
+	if cfg.WebhookSecret == "" {
+		log.Println("github webhook secret is not set, all webhook deliveries will be rejected")
+	}
+
+	return func(c *fiber.Ctx) error {
+		if cfg.WebhookSecret == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Webhooks are not configured"})
+		}
+
+		signature := c.Get(utils.GithubSignatureHeader)
+		if err := utils.ValidateGithubWebhookSignature(signature, c.Body(), cfg.WebhookSecret); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid webhook signature"})
+		}
+
+		return c.Next()
+	}
+}
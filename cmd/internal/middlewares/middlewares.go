@@ -4,17 +4,21 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/simondanielsson/apPRoved/pkg/utils"
-	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
 	"gorm.io/gorm"
 )
 
 type OptionalMiddlewares struct {
-	Auth        func(*fiber.Ctx) error
-	Transaction func(*fiber.Ctx) error
+	Auth          func(*fiber.Ctx) error
+	OptionalAuth  func(*fiber.Ctx) error
+	Transaction   func(*fiber.Ctx) error
+	ServiceAuth   func(*fiber.Ctx) error
+	GithubWebhook func(*fiber.Ctx) error
 }
 
-func SetupMiddlewares(app *fiber.App, queue mq.MessageQueue, githubClient *utils.GithubClient) {
+func SetupMiddlewares(app *fiber.App) {
 	app.Use(cors.New())
 
 	app.Use(logger.New(logger.Config{
@@ -22,17 +26,14 @@ func SetupMiddlewares(app *fiber.App, queue mq.MessageQueue, githubClient *utils
 		TimeFormat: "2 Jan 2006 15:04:05",
 		TimeZone:   "local",
 	}))
-
-	app.Use(func(c *fiber.Ctx) error {
-		c.Locals("messageQueue", queue)
-		c.Locals("githubClient", *githubClient)
-		return c.Next()
-	})
 }
 
-func GetOptionalMiddlewares(db *gorm.DB) OptionalMiddlewares {
+func GetOptionalMiddlewares(db *gorm.DB, bus eventbus.Bus, cfg *config.Config, services *services.Services) OptionalMiddlewares {
 	return OptionalMiddlewares{
-		Transaction: GetTransactionMiddleware(db),
-		Auth:        AuthMiddleware,
+		Transaction:   GetTransactionMiddleware(db, bus),
+		Auth:          GetAuthMiddleware(db, services.AuthService),
+		OptionalAuth:  GetOptionalAuthMiddleware(db, services.AuthService),
+		ServiceAuth:   GetServiceAuthMiddleware(cfg.Service),
+		GithubWebhook: GetGithubWebhookMiddleware(cfg.Github),
 	}
 }
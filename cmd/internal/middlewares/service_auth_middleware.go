@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
+
+const (
+	// ServiceTimestampHeader holds the unix time at which the request was signed
+	ServiceTimestampHeader = "X-Approved-Timestamp"
+	// ServiceSignatureHeader holds the HMAC signature of the request, see utils.SignServiceRequest
+	ServiceSignatureHeader = "X-Approved-Signature"
+)
+
+// GetServiceAuthMiddleware returns a middleware that only lets through requests signed with the
+// shared service secret, such as callbacks from the LLM service. Requests signed too long ago are
+// rejected to prevent replays.
+func GetServiceAuthMiddleware(cfg *config.ServiceConfig) func(*fiber.Ctx) error {
+	if cfg.Secret == "" {
+		log.Println("service secret is not set, all service requests will be rejected")
+	}
+
+	return func(c *fiber.Ctx) error {
+		if cfg.Secret == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Service authentication is not configured"})
+		}
+
+		timestamp := c.Get(ServiceTimestampHeader)
+		signature := c.Get(ServiceSignatureHeader)
+		if timestamp == "" || signature == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Missing request signature"})
+		}
+
+		signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid request timestamp"})
+		}
+		skew := time.Since(time.Unix(signedAt, 0))
+		if skew < -cfg.MaxClockSkew || skew > cfg.MaxClockSkew {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Request signature expired"})
+		}
+
+		if !utils.VerifyServiceRequest(cfg.Secret, signature, timestamp, c.Method(), c.OriginalURL(), c.Body()) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid request signature"})
+		}
+
+		return c.Next()
+	}
+}
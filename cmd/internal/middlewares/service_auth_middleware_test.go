@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
+
+func TestServiceAuthMiddleware(t *testing.T) {
+	const (
+		secret = "secret"
+		path   = "/api/v1/reviews/1/complete"
+		body   = `{"review_id": 1}`
+	)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		noSecret   bool
+		unsigned   bool
+		signedAt   time.Time
+		signWith   string
+		signedPath string
+		signedBody string
+		timestamp  string
+		signature  string
+		wantStatus int
+	}{
+		{name: "signed", signedAt: now, wantStatus: fiber.StatusOK},
+		{name: "signed within the clock skew", signedAt: now.Add(-50 * time.Second), wantStatus: fiber.StatusOK},
+		{name: "signed ahead within the clock skew", signedAt: now.Add(50 * time.Second), wantStatus: fiber.StatusOK},
+		{name: "signed too long ago", signedAt: now.Add(-2 * time.Minute), wantStatus: fiber.StatusUnauthorized},
+		{name: "signed too far ahead", signedAt: now.Add(2 * time.Minute), wantStatus: fiber.StatusUnauthorized},
+		{name: "signed with another secret", signedAt: now, signWith: "other", wantStatus: fiber.StatusUnauthorized},
+		{name: "signed for another path", signedAt: now, signedPath: "/api/v1/reviews/2/complete", wantStatus: fiber.StatusUnauthorized},
+		{name: "body changed", signedAt: now, signedBody: `{"review_id": 2}`, wantStatus: fiber.StatusUnauthorized},
+		{name: "invalid timestamp", signedAt: now, timestamp: "yesterday", wantStatus: fiber.StatusUnauthorized},
+		{name: "signature without prefix", signedAt: now, signature: strings.Repeat("0", 64), wantStatus: fiber.StatusUnauthorized},
+		{name: "no signature", signedAt: now, unsigned: true, wantStatus: fiber.StatusUnauthorized},
+		{name: "no secret configured", noSecret: true, signedAt: now, wantStatus: fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.ServiceConfig{Secret: secret, MaxClockSkew: time.Minute}
+			if tt.noSecret {
+				cfg.Secret = ""
+			}
+			app := fiber.New()
+			app.Post(path, GetServiceAuthMiddleware(cfg), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			timestamp := strconv.FormatInt(tt.signedAt.Unix(), 10)
+			signWith, signedPath, signedBody := secret, path, body
+			if tt.signWith != "" {
+				signWith = tt.signWith
+			}
+			if tt.signedPath != "" {
+				signedPath = tt.signedPath
+			}
+			if tt.signedBody != "" {
+				signedBody = tt.signedBody
+			}
+			signature := utils.SignServiceRequest(signWith, timestamp, fiber.MethodPost, signedPath, []byte(signedBody))
+			if tt.timestamp != "" {
+				timestamp = tt.timestamp
+			}
+			if tt.signature != "" {
+				signature = tt.signature
+			}
+
+			req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(body))
+			req.Header.Set(ServiceTimestampHeader, timestamp)
+			if !tt.unsigned {
+				req.Header.Set(ServiceSignatureHeader, signature)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
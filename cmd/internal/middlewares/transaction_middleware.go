@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
 	"gorm.io/gorm"
 )
 
@@ -11,9 +12,12 @@ type ctxKey string
 // txnKey is a context key for database transactions
 const TxnKey ctxKey = "db_txn"
 
-func GetTransactionMiddleware(db *gorm.DB) func(*fiber.Ctx) error {
+// GetTransactionMiddleware wraps each request in a transaction. Review events recorded in the
+// transaction are published to the bus once it has committed.
+func GetTransactionMiddleware(db *gorm.DB, bus eventbus.Bus) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
-		tx := db.Begin()
+		ctx := eventbus.WithCollector(c.UserContext())
+		tx := db.WithContext(ctx).Begin()
 		if tx.Error != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "could not start transaction")
 		}
@@ -24,8 +28,8 @@ func GetTransactionMiddleware(db *gorm.DB) func(*fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil || c.Response().StatusCode() >= 400 {
 				tx.Rollback()
-			} else {
-				tx.Commit()
+			} else if tx.Commit().Error == nil {
+				eventbus.PublishCollected(ctx, bus)
 			}
 		}()
 
@@ -2,9 +2,21 @@ package models
 
 var Models = []interface{}{
 	&User{},
+	&RefreshToken{},
+	&RevokedToken{},
+	&GithubCredential{},
 	&Repository{},
 	&PullRequest{},
 	&Review{},
 	&FileReview{},
+	&SkippedFile{},
+	&ReviewFileDiff{},
+	&ReviewComment{},
+	&FileReviewFeedback{},
 	&ReviewStatus{},
+	&ReviewEvent{},
+	&OutboxMessage{},
+	&PendingAutoReview{},
+	&PendingGithubPublication{},
+	&GithubCacheEntry{},
 }
@@ -7,23 +7,66 @@ import (
 )
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `gorm:"uniqueIndex" json:"email"`
-	Password  string    `json:"-"`
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `gorm:"uniqueIndex" json:"email"`
+	Password    string    `json:"-"`
+	GithubID    *int64    `gorm:"uniqueIndex" json:"github_id"`
+	GithubLogin string    `json:"github_login"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GithubCredential is the GitHub access token of a user who signed in with GitHub. Tokens are
+// stored encrypted.
+type GithubCredential struct {
+	ID           uint       `gorm:"primary_key" json:"id"`
+	UserID       uint       `gorm:"uniqueIndex" json:"user_id"`
+	User         User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"user"`
+	AccessToken  string     `json:"-"`
+	RefreshToken string     `json:"-"`
+	TokenType    string     `json:"token_type"`
+	Scopes       string     `json:"scopes"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RefreshToken is a long-lived token to obtain new access tokens with. Only its hash is stored.
+// Refresh tokens are rotated: using one revokes it and issues a new one.
+type RefreshToken struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"user"`
+	TokenHash string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RevokedToken denies an access token by its ID (jti) until the token expires
+type RevokedToken struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	TokenID   string    `gorm:"uniqueIndex" json:"token_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Repository struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `json:"user_id"`
-	User      User      `gorm:"foreignKey:UserID" json:"user"`
-	Name      string    `json:"name"`
-	Owner     string    `json:"owner"`
-	URL       string    `json:"url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                        uint   `gorm:"primaryKey" json:"id"`
+	UserID                    uint   `json:"user_id"`
+	User                      User   `gorm:"foreignKey:UserID" json:"user"`
+	Name                      string `json:"name"`
+	Owner                     string `json:"owner"`
+	URL                       string `json:"url"`
+	AutoReview                bool   `json:"auto_review"`
+	AutoReviewDebounceSeconds int    `json:"auto_review_debounce_seconds"`
+	PublishToGithub           bool   `json:"publish_to_github"`
+	// InstallationID is the GitHub App installation with access to the repository, if any
+	InstallationID *int64    `gorm:"index" json:"installation_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 type PullRequest struct {
@@ -35,36 +78,194 @@ type PullRequest struct {
 	URL          string
 	State        string
 	LastCommit   string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	// GithubUpdatedAt is when GitHub last updated the pull request as of the latest applied event.
+	// Events about older versions of the pull request are ignored.
+	GithubUpdatedAt *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
 type Review struct {
-	ID            uint `gorm:"primary_key" json:"id"`
-	Name          string
-	PullRequestID uint         `json:"pull_request_id"`
-	PullRequest   PullRequest  `gorm:"foreignKey:PullRequestID" json:"pull_request"`
-	FileReviews   []FileReview `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"file_reviews"`
-	ReviewStatus  ReviewStatus `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"review_status"`
-	CreatedAt     time.Time    `json:"created_at"`
-	UpdatedAt     time.Time    `json:"updated_at"`
+	ID             uint `gorm:"primary_key" json:"id"`
+	Name           string
+	PullRequestID  uint             `json:"pull_request_id"`
+	PullRequest    PullRequest      `gorm:"foreignKey:PullRequestID" json:"pull_request"`
+	HeadSHA        string           `json:"head_sha"`
+	BaseSHA        string           `json:"base_sha"`
+	Mode           string           `json:"mode"`
+	SinceSHA       string           `json:"since_sha"`
+	GithubReviewID int64            `json:"github_review_id"`
+	PublishedAt    *time.Time       `json:"published_at"`
+	Context        string           `json:"context"`
+	ContextLines   int              `json:"context_lines"`
+	FileReviews    []FileReview     `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"file_reviews"`
+	SkippedFiles   []SkippedFile    `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"skipped_files"`
+	FileDiffs      []ReviewFileDiff `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"-"`
+	ReviewStatus   ReviewStatus     `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"review_status"`
+	Events         []ReviewEvent    `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"events"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// ReviewFileDiff is a file diff sent to the review service. The file contents sent along with it are not
+// kept, they are fetched again at the reviewed commits when the review is retried.
+type ReviewFileDiff struct {
+	ID               uint      `gorm:"primary_key" json:"id"`
+	ReviewID         uint      `gorm:"index" json:"review_id"`
+	Filename         string    `json:"filename"`
+	PreviousFilename string    `json:"previous_filename"`
+	Status           string    `json:"status"`
+	SHA              string    `json:"sha"`
+	RawURL           string    `json:"raw_url"`
+	Language         string    `json:"language"`
+	Class            string    `json:"class"`
+	Patch            string    `json:"patch"`
+	Additions        int       `json:"additions"`
+	Deletions        int       `json:"deletions"`
+	Changes          int       `json:"changes"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
+// FileReview is the review of a file. Status, PreviousFilename, SHA and RawURL describe the file as
+// GitHub reported it, Language and Class are derived from its path.
 type FileReview struct {
-	ID        uint      `gorm:"primary_key" json:"id"`
-	ReviewID  uint      `json:"review_id"`
-	Filename  string    `json:"filename"`
-	Content   string    `json:"content"`
-	Patch     string    `json:"patch"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID               uint            `gorm:"primary_key" json:"id"`
+	ReviewID         uint            `json:"review_id"`
+	Filename         string          `json:"filename"`
+	PreviousFilename string          `json:"previous_filename"`
+	Status           string          `json:"status"`
+	SHA              string          `json:"sha"`
+	RawURL           string          `json:"raw_url"`
+	Language         string          `json:"language"`
+	Class            string          `json:"class"`
+	Content          string          `json:"content"`
+	Patch            string          `json:"patch"`
+	Comments         []ReviewComment `gorm:"foreignKey:FileReviewID;constraint:OnDelete:CASCADE;" json:"comments"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// SkippedFile is a file changed by a pull request that was left out of a review
+type SkippedFile struct {
+	ID        uint                 `gorm:"primary_key" json:"id"`
+	ReviewID  uint                 `gorm:"index" json:"review_id"`
+	Filename  string               `json:"filename"`
+	Reason    constants.SkipReason `json:"reason"`
+	Additions int                  `json:"additions"`
+	Deletions int                  `json:"deletions"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// ReviewComment is a comment on a range of lines of one side of a file review's diff
+type ReviewComment struct {
+	ID           uint                      `gorm:"primary_key" json:"id"`
+	FileReviewID uint                      `gorm:"index" json:"file_review_id"`
+	Filename     string                    `json:"filename"`
+	Side         constants.CommentSide     `json:"side"`
+	StartLine    int                       `json:"start_line"`
+	EndLine      int                       `json:"end_line"`
+	Severity     constants.CommentSeverity `json:"severity"`
+	Category     string                    `json:"category"`
+	Body         string                    `json:"body"`
+	Suggestion   *string                   `json:"suggestion"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	UpdatedAt    time.Time                 `json:"updated_at"`
 }
 
+// ReviewStatus is the progress of a review. Error tells why a review failed or timed out. UpdatedAt is
+// refreshed by every status or progress update, so that stuck reviews can be told apart. Attempt counts
+// the times the review was sent to the review service; only results of the current attempt are accepted.
 type ReviewStatus struct {
 	ID        uint                   `gorm:"primary_key" json:"id"`
 	ReviewID  uint                   `json:"review_id"`
+	Attempt   int                    `gorm:"not null;default:1" json:"attempt"`
+	Status    constants.ReviewStatus `gorm:"index:idx_review_statuses_status_updated_at" json:"status"`
+	Progress  int                    `json:"progress"`
+	Error     string                 `json:"error"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `gorm:"index:idx_review_statuses_status_updated_at" json:"updated_at"`
+}
+
+// ReviewEvent is an entry of the append-only history of a review, recorded whenever its status or
+// progress changes. UserID is set for events of ActorUser.
+type ReviewEvent struct {
+	ID        uint                   `gorm:"primary_key" json:"id"`
+	ReviewID  uint                   `gorm:"index" json:"review_id"`
 	Status    constants.ReviewStatus `json:"status"`
 	Progress  int                    `json:"progress"`
+	Message   string                 `json:"message"`
+	Actor     constants.ReviewActor  `json:"actor"`
+	UserID    *uint                  `json:"user_id"`
 	CreatedAt time.Time              `json:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// OutboxMessage is a message waiting to be published to the message queue. It is written in the
+// same transaction as the rows it describes, and dispatched by the outbox relay after commit.
+type OutboxMessage struct {
+	ID            uint       `gorm:"primary_key" json:"id"`
+	ReviewID      uint       `gorm:"index" json:"review_id"`
+	Queue         string     `gorm:"index" json:"queue"`
+	Payload       []byte     `gorm:"type:jsonb" json:"payload"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	DispatchedAt  *time.Time `json:"dispatched_at"`
+	FailedAt      *time.Time `json:"failed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// PendingAutoReview is a review scheduled for the head commit of a pull request. New pushes within
+// the debounce window move DueAt forward, so that rapid pushes collapse into a single review.
+type PendingAutoReview struct {
+	ID            uint        `gorm:"primary_key" json:"id"`
+	PullRequestID uint        `gorm:"uniqueIndex" json:"pull_request_id"`
+	PullRequest   PullRequest `gorm:"foreignKey:PullRequestID" json:"pull_request"`
+	HeadSHA       string      `json:"head_sha"`
+	DueAt         time.Time   `gorm:"index" json:"due_at"`
+	Attempts      int         `json:"attempts"`
+	LastError     string      `json:"last_error"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// PendingGithubPublication is a completed review waiting to be published to its pull request on GitHub
+type PendingGithubPublication struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	ReviewID  uint      `gorm:"uniqueIndex" json:"review_id"`
+	Review    Review    `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE;" json:"review"`
+	DueAt     time.Time `gorm:"index" json:"due_at"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GithubCacheEntry is a GitHub response cached for conditional requests. Header holds the JSON encoded
+// response headers.
+type GithubCacheEntry struct {
+	Key          string    `gorm:"primaryKey" json:"key"`
+	ETag         string    `gorm:"column:etag" json:"etag"`
+	LastModified string    `json:"last_modified"`
+	StatusCode   int       `json:"status_code"`
+	Header       []byte    `json:"header"`
+	Body         []byte    `json:"body"`
+	UpdatedAt    time.Time `gorm:"index" json:"updated_at"`
+}
+
+// FileReviewFeedback is a user's feedback on a file review, or on one of its review comments if
+// ReviewCommentID is set
+type FileReviewFeedback struct {
+	ID              uint                   `gorm:"primary_key" json:"id"`
+	FileReviewID    uint                   `gorm:"uniqueIndex:idx_file_review_feedback_target" json:"file_review_id"`
+	FileReview      FileReview             `gorm:"foreignKey:FileReviewID;constraint:OnDelete:CASCADE;" json:"file_review"`
+	ReviewCommentID uint                   `gorm:"uniqueIndex:idx_file_review_feedback_target" json:"review_comment_id"`
+	UserID          uint                   `gorm:"uniqueIndex:idx_file_review_feedback_target" json:"user_id"`
+	User            User                   `gorm:"foreignKey:UserID" json:"user"`
+	Vote            constants.FeedbackVote `json:"vote"`
+	Resolved        bool                   `json:"resolved"`
+	Dismissed       bool                   `json:"dismissed"`
+	DismissReason   string                 `json:"dismiss_reason"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
 }
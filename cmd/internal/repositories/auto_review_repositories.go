@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AutoReviewRepository struct{}
+
+// NewAutoReviewRepository creates a new auto review repository
+func NewAutoReviewRepository() *AutoReviewRepository {
+	return &AutoReviewRepository{}
+}
+
+// UpsertPendingAutoReview schedules an auto review for a pull request, replacing the head commit and
+// due time of an already scheduled one
+func (r *AutoReviewRepository) UpsertPendingAutoReview(tx *gorm.DB, pending *models.PendingAutoReview) error {
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pull_request_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"head_sha", "due_at", "attempts", "last_error", "updated_at"}),
+	}).Create(pending).Error; err != nil {
+		return fmt.Errorf("failed to schedule auto review for pull request %d: %v", pending.PullRequestID, err)
+	}
+	return nil
+}
+
+// GetDuePendingAutoReview returns the next auto review that is due, locking it for the duration of
+// the transaction. Rows locked by another scheduler are skipped.
+func (r *AutoReviewRepository) GetDuePendingAutoReview(tx *gorm.DB) (*models.PendingAutoReview, error) {
+	var pending models.PendingAutoReview
+
+	if err := tx.Model(&models.PendingAutoReview{}).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Preload("PullRequest.Repository").
+		Where("due_at <= ?", time.Now()).
+		Order("due_at").
+		First(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
+
+// PostponePendingAutoReview records a failed attempt and moves the due time of an auto review
+func (r *AutoReviewRepository) PostponePendingAutoReview(tx *gorm.DB, pendingID uint, attempts int, dueAt time.Time, reason string) error {
+	if err := tx.Model(&models.PendingAutoReview{}).Where("id = ?", pendingID).Updates(map[string]interface{}{
+		"attempts":   attempts,
+		"due_at":     dueAt,
+		"last_error": reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to postpone auto review %d: %v", pendingID, err)
+	}
+	return nil
+}
+
+// DeletePendingAutoReview removes a scheduled auto review
+func (r *AutoReviewRepository) DeletePendingAutoReview(tx *gorm.DB, pendingID uint) error {
+	if err := tx.Delete(&models.PendingAutoReview{}, pendingID).Error; err != nil {
+		return fmt.Errorf("failed to delete auto review %d: %v", pendingID, err)
+	}
+	return nil
+}
+
+// DeletePendingAutoReviewsForPullRequest unschedules the auto review of a pull request, if any
+func (r *AutoReviewRepository) DeletePendingAutoReviewsForPullRequest(tx *gorm.DB, prID uint) error {
+	if err := tx.Where("pull_request_id = ?", prID).Delete(&models.PendingAutoReview{}).Error; err != nil {
+		return fmt.Errorf("failed to unschedule auto review for pull request %d: %v", prID, err)
+	}
+	return nil
+}
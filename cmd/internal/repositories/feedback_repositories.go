@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+)
+
+type FeedbackRepository struct{}
+
+// NewFeedbackRepository creates a new feedback repository
+func NewFeedbackRepository() *FeedbackRepository {
+	return &FeedbackRepository{}
+}
+
+// FeedbackStats counts the feedback on the file reviews of the reviews created in one week
+type FeedbackStats struct {
+	Week        time.Time
+	FileReviews int
+	Upvotes     int
+	Downvotes   int
+	Resolved    int
+	Dismissed   int
+}
+
+// GetFeedback returns the feedback of a user on a file review, or on one of its comments if
+// commentID is not 0
+func (r *FeedbackRepository) GetFeedback(tx *gorm.DB, fileReviewID, commentID, userID uint) (*models.FileReviewFeedback, error) {
+	var feedback models.FileReviewFeedback
+
+	if err := tx.Model(&models.FileReviewFeedback{}).
+		Where("file_review_id = ? AND review_comment_id = ? AND user_id = ?", fileReviewID, commentID, userID).
+		First(&feedback).Error; err != nil {
+		return nil, err
+	}
+
+	return &feedback, nil
+}
+
+// SaveFeedback inserts or updates feedback
+func (r *FeedbackRepository) SaveFeedback(tx *gorm.DB, feedback *models.FileReviewFeedback) error {
+	if err := tx.Save(feedback).Error; err != nil {
+		return fmt.Errorf("failed to save feedback on file review %d: %v", feedback.FileReviewID, err)
+	}
+	return nil
+}
+
+// GetFeedbackStats returns weekly feedback counts for the file reviews of a repository owned by the
+// user, for reviews created since the given time
+func (r *FeedbackRepository) GetFeedbackStats(tx *gorm.DB, userID, repoID uint, since time.Time) ([]*FeedbackStats, error) {
+	var stats []*FeedbackStats
+
+	if err := tx.Table("file_reviews").
+		Select(`date_trunc('week', reviews.created_at) AS week,
+			COUNT(DISTINCT file_reviews.id) AS file_reviews,
+			COUNT(file_review_feedbacks.id) FILTER (WHERE file_review_feedbacks.vote = ?) AS upvotes,
+			COUNT(file_review_feedbacks.id) FILTER (WHERE file_review_feedbacks.vote = ?) AS downvotes,
+			COUNT(file_review_feedbacks.id) FILTER (WHERE file_review_feedbacks.resolved) AS resolved,
+			COUNT(file_review_feedbacks.id) FILTER (WHERE file_review_feedbacks.dismissed) AS dismissed`,
+			constants.VoteUp, constants.VoteDown).
+		Joins("JOIN reviews ON reviews.id = file_reviews.review_id").
+		Joins("JOIN pull_requests ON pull_requests.id = reviews.pull_request_id").
+		Joins("JOIN repositories ON repositories.id = pull_requests.repository_id").
+		// only feedback on the file reviews themselves counts, not feedback on their review comments
+		Joins("LEFT JOIN file_review_feedbacks ON file_review_feedbacks.file_review_id = file_reviews.id AND file_review_feedbacks.review_comment_id = 0").
+		Where("repositories.id = ? AND repositories.user_id = ? AND reviews.created_at >= ?", repoID, userID, since).
+		Group("week").
+		Order("week").
+		Scan(&stats).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate feedback of repository %d: %v", repoID, err)
+	}
+
+	return stats, nil
+}
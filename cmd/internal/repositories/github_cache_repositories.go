@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GithubCacheRepository struct{}
+
+// NewGithubCacheRepository creates a new GitHub cache repository
+func NewGithubCacheRepository() *GithubCacheRepository {
+	return &GithubCacheRepository{}
+}
+
+// GetGithubCacheEntry returns the cached GitHub response for a key
+func (r *GithubCacheRepository) GetGithubCacheEntry(tx *gorm.DB, key string) (*models.GithubCacheEntry, error) {
+	var entry models.GithubCacheEntry
+
+	if err := tx.Where("key = ?", key).First(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// UpsertGithubCacheEntry stores a GitHub response, replacing the one cached for the same key
+func (r *GithubCacheRepository) UpsertGithubCacheEntry(tx *gorm.DB, entry *models.GithubCacheEntry) error {
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"etag", "last_modified", "status_code", "header", "body", "updated_at"}),
+	}).Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to store GitHub cache entry: %v", err)
+	}
+	return nil
+}
+
+// DeleteGithubCacheEntriesBefore deletes the responses that were not refreshed since before and returns
+// how many were deleted
+func (r *GithubCacheRepository) DeleteGithubCacheEntriesBefore(tx *gorm.DB, before time.Time) (int64, error) {
+	result := tx.Where("updated_at < ?", before).Delete(&models.GithubCacheEntry{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired GitHub cache entries: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GithubCredentialRepository struct{}
+
+// NewGithubCredentialRepository creates a new GitHub credential repository
+func NewGithubCredentialRepository() *GithubCredentialRepository {
+	return &GithubCredentialRepository{}
+}
+
+// UpsertGithubCredential stores the GitHub credential of a user, replacing an existing one
+func (r *GithubCredentialRepository) UpsertGithubCredential(tx *gorm.DB, credential *models.GithubCredential) error {
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"access_token", "refresh_token", "token_type", "scopes", "expires_at", "updated_at"}),
+	}).Create(credential).Error; err != nil {
+		return fmt.Errorf("failed to store GitHub credential of user %d: %v", credential.UserID, err)
+	}
+	return nil
+}
+
+// GetGithubCredential returns the GitHub credential of a user
+func (r *GithubCredentialRepository) GetGithubCredential(tx *gorm.DB, userID uint) (*models.GithubCredential, error) {
+	var credential models.GithubCredential
+
+	if err := tx.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+// GetGithubCredentialForUpdate returns the GitHub credential of a user, locked for the duration of the
+// transaction
+func (r *GithubCredentialRepository) GetGithubCredentialForUpdate(tx *gorm.DB, userID uint) (*models.GithubCredential, error) {
+	var credential models.GithubCredential
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+
+	return &credential, nil
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GithubPublicationRepository struct{}
+
+// NewGithubPublicationRepository creates a new GitHub publication repository
+func NewGithubPublicationRepository() *GithubPublicationRepository {
+	return &GithubPublicationRepository{}
+}
+
+// UpsertPendingGithubPublication schedules the publication of a review, resetting the attempts of an
+// already scheduled one
+func (r *GithubPublicationRepository) UpsertPendingGithubPublication(tx *gorm.DB, pending *models.PendingGithubPublication) error {
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "review_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"due_at", "attempts", "last_error", "updated_at"}),
+	}).Create(pending).Error; err != nil {
+		return fmt.Errorf("failed to schedule publication of review %d: %v", pending.ReviewID, err)
+	}
+	return nil
+}
+
+// GetDuePendingGithubPublication returns the next publication that is due, locking it for the duration
+// of the transaction. Rows locked by another publisher are skipped.
+func (r *GithubPublicationRepository) GetDuePendingGithubPublication(tx *gorm.DB) (*models.PendingGithubPublication, error) {
+	var pending models.PendingGithubPublication
+
+	if err := tx.Model(&models.PendingGithubPublication{}).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("due_at <= ?", time.Now()).
+		Order("due_at").
+		First(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
+
+// PostponePendingGithubPublication records a failed attempt and moves the due time of a publication
+func (r *GithubPublicationRepository) PostponePendingGithubPublication(tx *gorm.DB, pendingID uint, attempts int, dueAt time.Time, reason string) error {
+	if err := tx.Model(&models.PendingGithubPublication{}).Where("id = ?", pendingID).Updates(map[string]interface{}{
+		"attempts":   attempts,
+		"due_at":     dueAt,
+		"last_error": reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to postpone publication %d: %v", pendingID, err)
+	}
+	return nil
+}
+
+// DeletePendingGithubPublication removes a scheduled publication
+func (r *GithubPublicationRepository) DeletePendingGithubPublication(tx *gorm.DB, pendingID uint) error {
+	if err := tx.Delete(&models.PendingGithubPublication{}, pendingID).Error; err != nil {
+		return fmt.Errorf("failed to delete publication %d: %v", pendingID, err)
+	}
+	return nil
+}
+
+// DeletePendingGithubPublicationsForReview unschedules the publication of a review, if any
+func (r *GithubPublicationRepository) DeletePendingGithubPublicationsForReview(tx *gorm.DB, reviewID uint) error {
+	if err := tx.Where("review_id = ?", reviewID).Delete(&models.PendingGithubPublication{}).Error; err != nil {
+		return fmt.Errorf("failed to unschedule publication of review %d: %v", reviewID, err)
+	}
+	return nil
+}
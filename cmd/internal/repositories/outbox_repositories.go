@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository struct{}
+
+// NewOutboxRepository creates a new outbox repository
+func NewOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{}
+}
+
+// CreateOutboxMessage inserts an outbox message into the database
+func (r *OutboxRepository) CreateOutboxMessage(tx *gorm.DB, message *models.OutboxMessage) error {
+	if err := tx.Create(message).Error; err != nil {
+		return fmt.Errorf("failed to insert outbox message: %v", err)
+	}
+	return nil
+}
+
+// GetPendingOutboxMessages returns messages that are due for dispatch, locking them for the
+// duration of the transaction. Rows locked by another relay are skipped.
+func (r *OutboxRepository) GetPendingOutboxMessages(tx *gorm.DB, limit int) ([]*models.OutboxMessage, error) {
+	var messages []*models.OutboxMessage
+
+	if err := tx.Model(&models.OutboxMessage{}).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("dispatched_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", time.Now()).
+		Order("id").
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// DeleteSettledOutboxMessages deletes the messages that were published or given up on before a time,
+// and returns how many there were
+func (r *OutboxRepository) DeleteSettledOutboxMessages(tx *gorm.DB, before time.Time) (int64, error) {
+	result := tx.Where("dispatched_at < ? OR failed_at < ?", before, before).Delete(&models.OutboxMessage{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete settled outbox messages: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// DiscardPendingOutboxMessages gives up on the messages of a review on a queue that were not published
+// yet, and returns how many there were
+func (r *OutboxRepository) DiscardPendingOutboxMessages(tx *gorm.DB, reviewID uint, queue string, reason string) (int64, error) {
+	result := tx.Model(&models.OutboxMessage{}).
+		Where("review_id = ? AND queue = ? AND dispatched_at IS NULL AND failed_at IS NULL", reviewID, queue).
+		Updates(map[string]interface{}{
+			"failed_at":  time.Now(),
+			"last_error": reason,
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to discard outbox messages of review %d: %v", reviewID, result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// MarkOutboxMessageDispatched marks a message as successfully published
+func (r *OutboxRepository) MarkOutboxMessageDispatched(tx *gorm.DB, messageID uint) error {
+	if err := tx.Model(&models.OutboxMessage{}).Where("id = ?", messageID).Updates(map[string]interface{}{
+		"dispatched_at": time.Now(),
+		"last_error":    "",
+	}).Error; err != nil {
+		return fmt.Errorf("failed to mark outbox message %d as dispatched: %v", messageID, err)
+	}
+	return nil
+}
+
+// MarkOutboxMessageAttemptFailed records a failed publish attempt and schedules the next one
+func (r *OutboxRepository) MarkOutboxMessageAttemptFailed(tx *gorm.DB, messageID uint, attempts int, nextAttemptAt time.Time, reason string) error {
+	if err := tx.Model(&models.OutboxMessage{}).Where("id = ?", messageID).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update outbox message %d: %v", messageID, err)
+	}
+	return nil
+}
+
+// MarkOutboxMessageFailed gives up on a message after it exhausted its attempts
+func (r *OutboxRepository) MarkOutboxMessageFailed(tx *gorm.DB, messageID uint, attempts int, reason string) error {
+	if err := tx.Model(&models.OutboxMessage{}).Where("id = ?", messageID).Updates(map[string]interface{}{
+		"attempts":   attempts,
+		"failed_at":  time.Now(),
+		"last_error": reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to mark outbox message %d as failed: %v", messageID, err)
+	}
+	return nil
+}
@@ -1,6 +1,12 @@
 package repositories
 
 type Repositories struct {
-	ReviewsRepository *ReviewsRepository
-	UserRepository    *UserRepository
+	ReviewsRepository           *ReviewsRepository
+	UserRepository              *UserRepository
+	OutboxRepository            *OutboxRepository
+	AutoReviewRepository        *AutoReviewRepository
+	GithubPublicationRepository *GithubPublicationRepository
+	FeedbackRepository          *FeedbackRepository
+	TokenRepository             *TokenRepository
+	GithubCredentialRepository  *GithubCredentialRepository
 }
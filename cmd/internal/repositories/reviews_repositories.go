@@ -3,10 +3,12 @@ package repositories
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/simondanielsson/apPRoved/cmd/constants"
 	"github.com/simondanielsson/apPRoved/cmd/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ReviewsRepository struct{}
@@ -20,24 +22,114 @@ func NewReviewsRepository() *ReviewsRepository {
 func (r *ReviewsRepository) GetRepositories(tx *gorm.DB, userID uint) ([]*models.Repository, error) {
 	var repos []*models.Repository
 
-	if err := tx.Model(&models.Repository{}).Where(&models.Repository{UserID: userID}).Find(&repos).Error; err != nil {
+	if err := tx.Model(&models.Repository{}).Where("user_id = ?", userID).Find(&repos).Error; err != nil {
 		return nil, err
 	}
 
 	return repos, nil
 }
 
-// GetRepository returns a repository
-func (r *ReviewsRepository) GetRepository(tx *gorm.DB, repoID uint) (*models.Repository, error) {
+// ownedPullRequests scopes a query on pull requests to a repository registered by the user
+func ownedPullRequests(userID, repoID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Joins("JOIN repositories ON repositories.id = pull_requests.repository_id").
+			Where("repositories.id = ? AND repositories.user_id = ?", repoID, userID)
+	}
+}
+
+// ownedReviews scopes a query on reviews to a pull request in a repository registered by the user
+func ownedReviews(userID, repoID, prID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Joins("JOIN pull_requests ON pull_requests.id = reviews.pull_request_id").
+			Joins("JOIN repositories ON repositories.id = pull_requests.repository_id").
+			Where("pull_requests.id = ? AND repositories.id = ? AND repositories.user_id = ?", prID, repoID, userID)
+	}
+}
+
+// GetRepository returns a repository registered by the user
+func (r *ReviewsRepository) GetRepository(tx *gorm.DB, userID, repoID uint) (*models.Repository, error) {
 	var repo models.Repository
 
-	if err := tx.Model(&models.Repository{}).Where(&models.Repository{ID: repoID}).First(&repo).Error; err != nil {
+	if err := tx.Model(&models.Repository{}).Where("id = ? AND user_id = ?", repoID, userID).First(&repo).Error; err != nil {
 		return nil, err
 	}
 
 	return &repo, nil
 }
 
+// UpdateRepositorySettings updates the auto review and publishing settings of a repository
+func (r *ReviewsRepository) UpdateRepositorySettings(tx *gorm.DB, repo *models.Repository) error {
+	if err := tx.Model(&models.Repository{}).Where("id = ?", repo.ID).Updates(map[string]interface{}{
+		"auto_review":                  repo.AutoReview,
+		"auto_review_debounce_seconds": repo.AutoReviewDebounceSeconds,
+		"publish_to_github":            repo.PublishToGithub,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update settings of repository %d: %v", repo.ID, err)
+	}
+
+	return nil
+}
+
+// GetRepositoriesByName returns the repositories registered by any user for owner/name. GitHub
+// treats names case-insensitively, so the lookup does as well.
+func (r *ReviewsRepository) GetRepositoriesByName(tx *gorm.DB, owner, name string) ([]*models.Repository, error) {
+	var repos []*models.Repository
+
+	if err := tx.Model(&models.Repository{}).Where("LOWER(owner) = LOWER(?) AND LOWER(name) = LOWER(?)", owner, name).Find(&repos).Error; err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+// SetRepositoriesInstallation maps the registrations of owner/name by users linked to one of the GitHub
+// accounts githubIDs to a GitHub App installation, and returns the number of repositories updated
+func (r *ReviewsRepository) SetRepositoriesInstallation(tx *gorm.DB, owner, name string, installationID int64, githubIDs []int64) (int64, error) {
+	var ids []int64
+	for _, id := range githubIDs {
+		if id != 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result := tx.Model(&models.Repository{}).
+		Where("LOWER(owner) = LOWER(?) AND LOWER(name) = LOWER(?)", owner, name).
+		Where("user_id IN (SELECT id FROM users WHERE github_id IN ?)", ids).
+		Update("installation_id", installationID)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to set installation of repository %s/%s: %v", owner, name, result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// SetRepositoryInstallation maps a single repository to a GitHub App installation
+func (r *ReviewsRepository) SetRepositoryInstallation(tx *gorm.DB, repoID uint, installationID int64) error {
+	if err := tx.Model(&models.Repository{}).Where("id = ?", repoID).Update("installation_id", installationID).Error; err != nil {
+		return fmt.Errorf("failed to set installation of repository %d: %v", repoID, err)
+	}
+	return nil
+}
+
+// ClearRepositoriesInstallation unmaps the repositories of a GitHub App installation. Only owner/name
+// is unmapped if given, otherwise every repository of the installation is.
+func (r *ReviewsRepository) ClearRepositoriesInstallation(tx *gorm.DB, installationID int64, owner, name string) (int64, error) {
+	query := tx.Model(&models.Repository{}).Where("installation_id = ?", installationID)
+	if owner != "" {
+		query = query.Where("LOWER(owner) = LOWER(?) AND LOWER(name) = LOWER(?)", owner, name)
+	}
+
+	result := query.Update("installation_id", nil)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to clear repositories of installation %d: %v", installationID, result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
 // CreateRepository inserts a repository into the database
 func (r *ReviewsRepository) CreateRepository(tx *gorm.DB, repo *models.Repository) (*models.Repository, error) {
 	if err := tx.Create(repo).Error; err != nil {
@@ -64,41 +156,66 @@ func (r *ReviewsRepository) CreatePullRequests(tx *gorm.DB, prs []*models.PullRe
 func (r *ReviewsRepository) GetPullRequests(tx *gorm.DB, userID, repoID uint) ([]*models.PullRequest, error) {
 	var prs []*models.PullRequest
 
-	if err := tx.Model(&models.PullRequest{}).Where(&models.PullRequest{RepositoryID: repoID}).Find(&prs).Error; err != nil {
+	if err := tx.Model(&models.PullRequest{}).Scopes(ownedPullRequests(userID, repoID)).Find(&prs).Error; err != nil {
 		return nil, err
 	}
 
 	return prs, nil
 }
 
-func (r *ReviewsRepository) GetPullRequest(tx *gorm.DB, prID uint) (*models.PullRequest, error) {
+// GetPullRequest returns a pull request in a repository registered by the user
+func (r *ReviewsRepository) GetPullRequest(tx *gorm.DB, userID, repoID, prID uint) (*models.PullRequest, error) {
 	var pr models.PullRequest
 
-	if err := tx.Model(&models.PullRequest{}).Where(&models.PullRequest{ID: prID}).First(&pr).Error; err != nil {
+	if err := tx.Model(&models.PullRequest{}).Scopes(ownedPullRequests(userID, repoID)).Where("pull_requests.id = ?", prID).First(&pr).Error; err != nil {
 		return nil, err
 	}
 
 	return &pr, nil
 }
 
-func (r *ReviewsRepository) UpdatePullRequestStatuses(tx *gorm.DB, prs []*models.PullRequest) error {
-	if len(prs) == 0 {
-		return nil
+// GetPullRequestByNumberForUpdate returns and locks the pull request with the given GitHub number in a
+// repository, so that concurrent events about it are applied one after the other
+func (r *ReviewsRepository) GetPullRequestByNumberForUpdate(tx *gorm.DB, repoID, number uint) (*models.PullRequest, error) {
+	var pr models.PullRequest
+
+	if err := tx.Model(&models.PullRequest{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("repository_id = ? AND number = ?", repoID, number).First(&pr).Error; err != nil {
+		return nil, err
 	}
-	for _, pr := range prs {
-		if err := tx.Model(&models.PullRequest{}).Where("id = ?", pr.ID).Updates(models.PullRequest{State: pr.State}).Error; err != nil {
-			return fmt.Errorf("failed to update pull requests: %v", err)
-		}
+
+	return &pr, nil
+}
+
+// GetPullRequestWithRepository returns a pull request together with its repository, regardless of owner
+func (r *ReviewsRepository) GetPullRequestWithRepository(tx *gorm.DB, prID uint) (*models.PullRequest, error) {
+	var pr models.PullRequest
+
+	if err := tx.Model(&models.PullRequest{}).Preload("Repository").Where("id = ?", prID).First(&pr).Error; err != nil {
+		return nil, err
+	}
+
+	return &pr, nil
+}
+
+// UpdatePullRequest updates the state, title and last commit of a pull request
+func (r *ReviewsRepository) UpdatePullRequest(tx *gorm.DB, pr *models.PullRequest) error {
+	if err := tx.Model(&models.PullRequest{}).Where("id = ?", pr.ID).Updates(map[string]interface{}{
+		"state":             pr.State,
+		"title":             pr.Title,
+		"last_commit":       pr.LastCommit,
+		"github_updated_at": pr.GithubUpdatedAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update pull request %d: %v", pr.ID, err)
 	}
 
 	return nil
 }
 
 // GetReviews returns all reviews for a pull request
-func (r *ReviewsRepository) GetReviews(tx *gorm.DB, repoID, prID uint) ([]*models.Review, error) {
+func (r *ReviewsRepository) GetReviews(tx *gorm.DB, userID, repoID, prID uint) ([]*models.Review, error) {
 	var reviews []*models.Review
 
-	if err := tx.Model(&models.Review{}).Where(&models.Review{PullRequestID: prID}).Find(&reviews).Error; err != nil {
+	if err := tx.Model(&models.Review{}).Preload("SkippedFiles").Scopes(ownedReviews(userID, repoID, prID)).Find(&reviews).Error; err != nil {
 		return nil, err
 	}
 
@@ -106,10 +223,10 @@ func (r *ReviewsRepository) GetReviews(tx *gorm.DB, repoID, prID uint) ([]*model
 }
 
 // GetReview returns a review for a pull request
-func (r *ReviewsRepository) GetReview(tx *gorm.DB, repoID, prID, reviewID uint) (*models.Review, error) {
+func (r *ReviewsRepository) GetReview(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*models.Review, error) {
 	var review models.Review
 
-	if err := tx.Model(&models.Review{}).Where(&models.Review{PullRequestID: prID, ID: reviewID}).First(&review).Error; err != nil {
+	if err := tx.Model(&models.Review{}).Preload("SkippedFiles").Scopes(ownedReviews(userID, repoID, prID)).Where("reviews.id = ?", reviewID).First(&review).Error; err != nil {
 		return nil, err
 	}
 
@@ -117,15 +234,83 @@ func (r *ReviewsRepository) GetReview(tx *gorm.DB, repoID, prID, reviewID uint)
 }
 
 // GetFileReviews returns reviews for files
-func (r *ReviewsRepository) GetFileReviews(tx *gorm.DB, reviewID uint) (*models.Review, error) {
+func (r *ReviewsRepository) GetFileReviews(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*models.Review, error) {
 	var review models.Review
 
-	if err := tx.Model(&models.Review{}).Preload("FileReviews").Where(&models.Review{ID: reviewID}).First(&review).Error; err != nil {
+	if err := tx.Model(&models.Review{}).Preload("FileReviews.Comments").Preload("SkippedFiles").Scopes(ownedReviews(userID, repoID, prID)).Where("reviews.id = ?", reviewID).First(&review).Error; err != nil {
 		return nil, err
 	}
 	return &review, nil
 }
 
+// GetFileReview returns a file review of a review owned by the user
+func (r *ReviewsRepository) GetFileReview(tx *gorm.DB, userID, repoID, prID, reviewID, fileReviewID uint) (*models.FileReview, error) {
+	var fileReview models.FileReview
+
+	if err := tx.Model(&models.FileReview{}).
+		Joins("JOIN reviews ON reviews.id = file_reviews.review_id").
+		Scopes(ownedReviews(userID, repoID, prID)).
+		Where("reviews.id = ? AND file_reviews.id = ?", reviewID, fileReviewID).
+		First(&fileReview).Error; err != nil {
+		return nil, err
+	}
+
+	return &fileReview, nil
+}
+
+// GetReviewComment returns a review comment of a file review
+func (r *ReviewsRepository) GetReviewComment(tx *gorm.DB, fileReviewID, commentID uint) (*models.ReviewComment, error) {
+	var comment models.ReviewComment
+
+	if err := tx.Model(&models.ReviewComment{}).Where("id = ? AND file_review_id = ?", commentID, fileReviewID).First(&comment).Error; err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// GetLatestCompletedReview returns the most recent available review of a pull request that is pinned to a commit
+func (r *ReviewsRepository) GetLatestCompletedReview(tx *gorm.DB, prID uint) (*models.Review, error) {
+	var review models.Review
+
+	if err := tx.Model(&models.Review{}).
+		Joins("JOIN review_statuses ON review_statuses.review_id = reviews.id").
+		Where("reviews.pull_request_id = ? AND reviews.head_sha <> '' AND review_statuses.status = ?", prID, constants.StatusAvailable).
+		Order("reviews.created_at DESC").
+		First(&review).Error; err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// GetReviewForPublication returns a review with its status, file reviews, pull request and repository
+func (r *ReviewsRepository) GetReviewForPublication(tx *gorm.DB, reviewID uint) (*models.Review, error) {
+	var review models.Review
+
+	if err := tx.Model(&models.Review{}).
+		Preload("ReviewStatus").
+		Preload("FileReviews.Comments").
+		Preload("PullRequest.Repository").
+		Where("id = ?", reviewID).
+		First(&review).Error; err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// UpdateReviewGithubReviewID records the GitHub review a review was published as
+func (r *ReviewsRepository) UpdateReviewGithubReviewID(tx *gorm.DB, reviewID uint, githubReviewID int64, publishedAt time.Time) error {
+	if err := tx.Model(&models.Review{}).Where("id = ?", reviewID).Updates(map[string]interface{}{
+		"github_review_id": githubReviewID,
+		"published_at":     publishedAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update GitHub review of review %d: %v", reviewID, err)
+	}
+	return nil
+}
+
 // CreateReview inserts a review into the database
 func (r *ReviewsRepository) CreateReview(tx *gorm.DB, review *models.Review) (*models.Review, error) {
 	if err := tx.Create(review).Error; err != nil {
@@ -135,12 +320,12 @@ func (r *ReviewsRepository) CreateReview(tx *gorm.DB, review *models.Review) (*m
 }
 
 // DeleteReview deletes a review from the database
-func (r *ReviewsRepository) DeleteReview(tx *gorm.DB, reviewID uint) error {
+func (r *ReviewsRepository) DeleteReview(tx *gorm.DB, userID, repoID, prID, reviewID uint) error {
 	var review models.Review
 
 	// preload the id of the review to delete the review status and file reviews
-	if err := tx.Preload("FileReviews").Preload("ReviewStatus").First(&review, reviewID).Error; err != nil {
-		return fmt.Errorf("failed to find review with id %d: %v", reviewID, err)
+	if err := tx.Preload("FileReviews").Preload("ReviewStatus").Scopes(ownedReviews(userID, repoID, prID)).Where("reviews.id = ?", reviewID).First(&review).Error; err != nil {
+		return fmt.Errorf("failed to find review with id %d: %w", reviewID, err)
 	}
 
 	if err := tx.Delete(&review).Error; err != nil {
@@ -150,6 +335,40 @@ func (r *ReviewsRepository) DeleteReview(tx *gorm.DB, reviewID uint) error {
 	return nil
 }
 
+// CreateSkippedFiles inserts the files left out of a review into the database
+func (r *ReviewsRepository) CreateSkippedFiles(tx *gorm.DB, skippedFiles []*models.SkippedFile) error {
+	if len(skippedFiles) == 0 {
+		return nil
+	}
+
+	if err := tx.CreateInBatches(skippedFiles, 500).Error; err != nil {
+		return fmt.Errorf("failed to insert skipped files: %v", err)
+	}
+	return nil
+}
+
+// CreateReviewFileDiffs inserts the file diffs sent for a review into the database
+func (r *ReviewsRepository) CreateReviewFileDiffs(tx *gorm.DB, fileDiffs []*models.ReviewFileDiff) error {
+	if len(fileDiffs) == 0 {
+		return nil
+	}
+
+	if err := tx.CreateInBatches(fileDiffs, 500).Error; err != nil {
+		return fmt.Errorf("failed to insert review file diffs: %v", err)
+	}
+	return nil
+}
+
+// GetReviewFileDiffs returns the file diffs sent for a review, in the order they were sent
+func (r *ReviewsRepository) GetReviewFileDiffs(tx *gorm.DB, reviewID uint) ([]*models.ReviewFileDiff, error) {
+	var fileDiffs []*models.ReviewFileDiff
+
+	if err := tx.Model(&models.ReviewFileDiff{}).Where("review_id = ?", reviewID).Order("id").Find(&fileDiffs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get file diffs of review %d: %v", reviewID, err)
+	}
+	return fileDiffs, nil
+}
+
 // CreateReviewStatus inserts a review status into the database
 func (r *ReviewsRepository) CreateReviewStatus(tx *gorm.DB, reviewStatus *models.ReviewStatus) error {
 	if err := tx.Create(reviewStatus).Error; err != nil {
@@ -192,20 +411,94 @@ func (r *ReviewsRepository) CreateFileReviews(tx *gorm.DB, fileReviews []*models
 	return nil
 }
 
-// UpdateReviewStatus updates the status of a review
-func (r *ReviewsRepository) UpdateReviewStatus(tx *gorm.DB, reviewStatusID uint, status constants.ReviewStatus) error {
-	if err := tx.Model(&models.ReviewStatus{}).Where("id = ?", reviewStatusID).UpdateColumn("status", status).Error; err != nil {
-		return err
+// StartReviewAttempt counts another attempt of the review service at a review
+func (r *ReviewsRepository) StartReviewAttempt(tx *gorm.DB, reviewStatusID uint) error {
+	if err := tx.Model(&models.ReviewStatus{}).Where("id = ?", reviewStatusID).Update("attempt", gorm.Expr("attempt + 1")).Error; err != nil {
+		return fmt.Errorf("failed to start review attempt: %v", err)
 	}
-	log.Printf("Updated review status to %s", string(status))
 	return nil
 }
 
-// UpdateReviewProgress updates the progress of a review
-func (r *ReviewsRepository) UpdateReviewProgress(tx *gorm.DB, reviewStatusID uint, progress int) error {
-	if err := tx.Model(&models.ReviewStatus{}).Where("id = ?", reviewStatusID).UpdateColumn("progress", progress).Error; err != nil {
+// GetReviewStatusForUpdate returns a review status by its own ID, locking it for the duration of the
+// transaction so that concurrent transitions of the review are applied one after the other
+func (r *ReviewsRepository) GetReviewStatusForUpdate(tx *gorm.DB, reviewStatusID uint) (*models.ReviewStatus, error) {
+	var reviewStatus models.ReviewStatus
+
+	if err := tx.Model(&models.ReviewStatus{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", reviewStatusID).
+		First(&reviewStatus).Error; err != nil {
+		return nil, err
+	}
+
+	return &reviewStatus, nil
+}
+
+// UpdateReviewStatus updates the status and progress of a review along with the reason it failed, if any
+func (r *ReviewsRepository) UpdateReviewStatus(tx *gorm.DB, reviewStatusID uint, status constants.ReviewStatus, progress int, reason string) error {
+	if err := tx.Model(&models.ReviewStatus{}).Where("id = ?", reviewStatusID).Updates(map[string]interface{}{
+		"status":   status,
+		"progress": progress,
+		"error":    reason,
+	}).Error; err != nil {
 		return err
 	}
-	log.Printf("Updated review progress to %d", progress)
+	log.Printf("Updated review status to %s (%d%%)", string(status), progress)
 	return nil
 }
+
+// FailQueuedReview marks a review as failed if it is still queued, and returns its status if it was
+func (r *ReviewsRepository) FailQueuedReview(tx *gorm.DB, reviewID uint, reason string) ([]*models.ReviewStatus, error) {
+	var reviewStatuses []*models.ReviewStatus
+
+	if err := tx.Model(&reviewStatuses).
+		Clauses(clause.Returning{}).
+		Where("review_id = ? AND status = ?", reviewID, constants.StatusQueued).
+		Updates(map[string]interface{}{
+			"status": constants.StatusFailed,
+			"error":  reason,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to mark review %d as failed: %v", reviewID, err)
+	}
+	return reviewStatuses, nil
+}
+
+// TimeOutReviewStatuses marks the reviews that have been in a status since before staleBefore as timed
+// out, and returns their statuses
+func (r *ReviewsRepository) TimeOutReviewStatuses(tx *gorm.DB, status constants.ReviewStatus, staleBefore time.Time, reason string) ([]*models.ReviewStatus, error) {
+	var reviewStatuses []*models.ReviewStatus
+
+	if err := tx.Model(&reviewStatuses).
+		Clauses(clause.Returning{}).
+		Where("status = ? AND updated_at < ?", status, staleBefore).
+		Updates(map[string]interface{}{
+			"status": constants.StatusTimedOut,
+			"error":  reason,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to time out %s reviews: %v", status, err)
+	}
+	return reviewStatuses, nil
+}
+
+// CreateReviewEvents appends events to the history of their reviews
+func (r *ReviewsRepository) CreateReviewEvents(tx *gorm.DB, events []*models.ReviewEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := tx.Create(events).Error; err != nil {
+		return fmt.Errorf("failed to insert review events: %v", err)
+	}
+	return nil
+}
+
+// GetReviewEvents returns the history of a review, oldest first
+func (r *ReviewsRepository) GetReviewEvents(tx *gorm.DB, reviewID uint) ([]*models.ReviewEvent, error) {
+	var events []*models.ReviewEvent
+
+	if err := tx.Model(&models.ReviewEvent{}).Where("review_id = ?", reviewID).Order("id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
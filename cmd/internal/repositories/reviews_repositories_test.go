@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns an in-memory database with the tables of all models
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:?_pragma=foreign_keys(1)"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	// every connection to an in-memory database opens a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models.Models...); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	return db
+}
+
+// createOwnedReview creates a user with a repository, a pull request and a review of it
+func createOwnedReview(t *testing.T, db *gorm.DB, username string) *models.Review {
+	t.Helper()
+	review := &models.Review{
+		PullRequest: models.PullRequest{
+			Repository: models.Repository{
+				User:  models.User{Username: username, Email: fmt.Sprintf("%s@example.com", username)},
+				Name:  "repo",
+				Owner: username,
+			},
+			Number: 1,
+		},
+	}
+	if err := db.Create(review).Error; err != nil {
+		t.Fatalf("could not create review: %v", err)
+	}
+	return review
+}
+
+func TestOwnershipScopes(t *testing.T) {
+	db := newTestDB(t)
+	r := NewReviewsRepository()
+
+	alice := createOwnedReview(t, db, "alice")
+	bob := createOwnedReview(t, db, "bob")
+	aliceID := alice.PullRequest.Repository.UserID
+	aliceRepoID := alice.PullRequest.RepositoryID
+	bobRepoID := bob.PullRequest.RepositoryID
+
+	tests := []struct {
+		name     string
+		userID   uint
+		repoID   uint
+		prID     uint
+		reviewID uint
+		found    bool
+	}{
+		{name: "own review", userID: aliceID, repoID: aliceRepoID, prID: alice.PullRequestID, reviewID: alice.ID, found: true},
+		{name: "review of another user", userID: aliceID, repoID: bobRepoID, prID: bob.PullRequestID, reviewID: bob.ID},
+		{name: "review of another user through an own repository", userID: aliceID, repoID: aliceRepoID, prID: bob.PullRequestID, reviewID: bob.ID},
+		{name: "review of another user through an own pull request", userID: aliceID, repoID: aliceRepoID, prID: alice.PullRequestID, reviewID: bob.ID},
+		{name: "own review through a pull request of another user", userID: aliceID, repoID: bobRepoID, prID: bob.PullRequestID, reviewID: alice.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, err := r.GetPullRequest(db, tt.userID, tt.repoID, tt.prID)
+			prFound := tt.prID == alice.PullRequestID && tt.repoID == aliceRepoID
+			if found := err == nil; found != prFound {
+				t.Errorf("GetPullRequest() = %+v, %v, want found %v", pr, err, prFound)
+			}
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("GetPullRequest() failed: %v", err)
+			}
+
+			prs, err := r.GetPullRequests(db, tt.userID, tt.repoID)
+			if err != nil {
+				t.Fatalf("GetPullRequests() failed: %v", err)
+			}
+			if found := len(prs) > 0; found != (tt.repoID == aliceRepoID) {
+				t.Errorf("GetPullRequests() = %d pull requests, want found %v", len(prs), tt.repoID == aliceRepoID)
+			}
+
+			review, err := r.GetReview(db, tt.userID, tt.repoID, tt.prID, tt.reviewID)
+			if found := err == nil; found != tt.found {
+				t.Errorf("GetReview() = %+v, %v, want found %v", review, err, tt.found)
+			}
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("GetReview() failed: %v", err)
+			}
+
+			reviews, err := r.GetReviews(db, tt.userID, tt.repoID, tt.prID)
+			if err != nil {
+				t.Fatalf("GetReviews() failed: %v", err)
+			}
+			for _, review := range reviews {
+				if review.ID != alice.ID {
+					t.Errorf("GetReviews() returned review %d of another user", review.ID)
+				}
+			}
+
+			if tt.found {
+				return
+			}
+			if err := r.DeleteReview(db, tt.userID, tt.repoID, tt.prID, tt.reviewID); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("DeleteReview() = %v, want %v", err, gorm.ErrRecordNotFound)
+			}
+			if err := db.First(&models.Review{}, tt.reviewID).Error; err != nil {
+				t.Errorf("review %d is gone after a denied delete: %v", tt.reviewID, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TokenRepository struct{}
+
+// NewTokenRepository creates a new token repository
+func NewTokenRepository() *TokenRepository {
+	return &TokenRepository{}
+}
+
+// CreateRefreshToken inserts a refresh token into the database
+func (r *TokenRepository) CreateRefreshToken(tx *gorm.DB, token *models.RefreshToken) error {
+	if err := tx.Create(token).Error; err != nil {
+		return fmt.Errorf("failed to insert refresh token: %v", err)
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash returns a refresh token by its hash, locking it for the duration of the
+// transaction so that it can only be rotated once
+func (r *TokenRepository) GetRefreshTokenByHash(tx *gorm.DB, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+
+	if err := tx.Model(&models.RefreshToken{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error; err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RevokeRefreshToken revokes a refresh token
+func (r *TokenRepository) RevokeRefreshToken(tx *gorm.DB, tokenID uint) error {
+	if err := tx.Model(&models.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", tokenID).Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke refresh token %d: %v", tokenID, err)
+	}
+	return nil
+}
+
+// DeleteExpiredRefreshTokens removes the refresh tokens of a user that can no longer be used
+func (r *TokenRepository) DeleteExpiredRefreshTokens(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ? AND (expires_at < ? OR revoked_at IS NOT NULL)", userID, time.Now()).Delete(&models.RefreshToken{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired refresh tokens of user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// CreateRevokedToken adds an access token to the denylist. Revoking a token twice is a no-op.
+func (r *TokenRepository) CreateRevokedToken(tx *gorm.DB, token *models.RevokedToken) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error; err != nil {
+		return fmt.Errorf("failed to revoke token %s: %v", token.TokenID, err)
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether an access token is on the denylist
+func (r *TokenRepository) IsTokenRevoked(tx *gorm.DB, tokenID string) (bool, error) {
+	var count int64
+
+	if err := tx.Model(&models.RevokedToken{}).Where("token_id = ?", tokenID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to look up revoked token %s: %v", tokenID, err)
+	}
+
+	return count > 0, nil
+}
+
+// DeleteExpiredRevokedTokens removes denylist entries of tokens that have expired anyway
+func (r *TokenRepository) DeleteExpiredRevokedTokens(tx *gorm.DB) error {
+	if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired revoked tokens: %v", err)
+	}
+	return nil
+}
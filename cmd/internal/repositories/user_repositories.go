@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"fmt"
+
 	"github.com/simondanielsson/apPRoved/cmd/internal/models"
 	"gorm.io/gorm"
 )
@@ -42,9 +44,40 @@ func (r *UserRepository) GetUser(tx *gorm.DB, userID uint) (*models.User, error)
 func (r *UserRepository) GetUserByUsername(tx *gorm.DB, username string) (*models.User, error) {
 	var user models.User
 
-	if err := tx.First(&user, &models.User{Username: username}).Error; err != nil {
+	if err := tx.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *UserRepository) GetUserByEmail(tx *gorm.DB, email string) (*models.User, error) {
+	var user models.User
+
+	if err := tx.Where("LOWER(email) = LOWER(?)", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *UserRepository) GetUserByGithubID(tx *gorm.DB, githubID int64) (*models.User, error) {
+	var user models.User
+
+	if err := tx.Where("github_id = ?", githubID).First(&user).Error; err != nil {
 		return nil, err
 	}
 
 	return &user, nil
 }
+
+// UpdateUserGithubAccount links a user to a GitHub account
+func (r *UserRepository) UpdateUserGithubAccount(tx *gorm.DB, userID uint, githubID int64, githubLogin string) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"github_id":    githubID,
+		"github_login": githubLogin,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to link user %d to GitHub account %d: %v", userID, githubID, err)
+	}
+	return nil
+}
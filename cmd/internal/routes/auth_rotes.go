@@ -9,4 +9,9 @@ import (
 func RegisterAuthRoutes(apiV1 fiber.Router, authController *controllers.AuthController, opt_middlewares middlewares.OptionalMiddlewares) {
 	apiV1.Post("/login", opt_middlewares.Transaction, authController.Login)
 	apiV1.Post("/register", opt_middlewares.Transaction, authController.Register)
+	apiV1.Post("/token/refresh", opt_middlewares.Transaction, authController.RefreshToken)
+	apiV1.Post("/logout", opt_middlewares.Auth, opt_middlewares.Transaction, authController.Logout)
+
+	apiV1.Get("/auth/github/login", authController.GithubLogin)
+	apiV1.Get("/auth/github/callback", opt_middlewares.OptionalAuth, opt_middlewares.Transaction, authController.GithubCallback)
 }
@@ -6,12 +6,15 @@ import (
 	"github.com/simondanielsson/apPRoved/cmd/internal/middlewares"
 )
 
-func RegisterReviewsRoutes(apiV1 fiber.Router, reviewsController *controllers.ReviewsController, opt_middlewares middlewares.OptionalMiddlewares) {
+func RegisterReviewsRoutes(apiV1 fiber.Router, reviewsController *controllers.ReviewsController, feedbackController *controllers.FeedbackController, opt_middlewares middlewares.OptionalMiddlewares) {
 	router := apiV1.Group("/repositories", opt_middlewares.Auth, opt_middlewares.Transaction)
 
 	router.Get("", reviewsController.GetRepositories)
 	router.Post("", reviewsController.RegisterRepository)
 	router.Get(":repositoryID", reviewsController.GetRepository)
+	router.Get("/:repositoryID/settings", reviewsController.GetRepositorySettings)
+	router.Put("/:repositoryID/settings", reviewsController.UpdateRepositorySettings)
+	router.Get("/:repositoryID/feedback", feedbackController.GetFeedbackSummary)
 
 	router.Get("/:repositoryID/pull-requests", reviewsController.GetPullRequests)
 	router.Put("/:repositoryID/pull-requests", reviewsController.RefreshPullRequests)
@@ -21,11 +24,18 @@ func RegisterReviewsRoutes(apiV1 fiber.Router, reviewsController *controllers.Re
 	router.Post("/:repositoryID/pull-requests/:prID/reviews", reviewsController.CreateReview)
 	router.Get("/:repositoryID/pull-requests/:prID/reviews/:reviewID", reviewsController.GetReview)
 	router.Delete("/:repositoryID/pull-requests/:prID/reviews/:reviewID", reviewsController.DeleteReview)
+	router.Post("/:repositoryID/pull-requests/:prID/reviews/:reviewID/publish", reviewsController.PublishReview)
+	router.Post("/:repositoryID/pull-requests/:prID/reviews/:reviewID/retry", reviewsController.RetryReview)
+	router.Post("/:repositoryID/pull-requests/:prID/reviews/:reviewID/cancel", reviewsController.CancelReview)
 
 	router.Get("/:repositoryID/pull-requests/:prID/reviews/:reviewID/files", reviewsController.GetFileReviews)
+	router.Put("/:repositoryID/pull-requests/:prID/reviews/:reviewID/files/:fileReviewID/feedback", feedbackController.UpdateFileReviewFeedback)
+	router.Put("/:repositoryID/pull-requests/:prID/reviews/:reviewID/files/:fileReviewID/comments/:commentID/feedback", feedbackController.UpdateReviewCommentFeedback)
 	router.Get("/:repositoryID/pull-requests/:prID/reviews/:reviewID/progress", reviewsController.GetReviewProgress)
+	router.Get("/:repositoryID/pull-requests/:prID/reviews/:reviewID/events", reviewsController.GetReviewEvents)
+	router.Get("/:repositoryID/pull-requests/:prID/reviews/:reviewID/stream", reviewsController.StreamReview)
 
 	// used by LLM service
-	apiV1.Post("/reviews/complete", opt_middlewares.Transaction, reviewsController.CompleteReview)
-	apiV1.Put("/review-status/:reviewStatusID", opt_middlewares.Transaction, reviewsController.UpdateReviewProgress)
+	apiV1.Post("/reviews/complete", opt_middlewares.ServiceAuth, opt_middlewares.Transaction, reviewsController.CompleteReview)
+	apiV1.Put("/review-status/:reviewStatusID", opt_middlewares.ServiceAuth, opt_middlewares.Transaction, reviewsController.UpdateReviewProgress)
 }
@@ -20,6 +20,7 @@ func RegisterRoutes(apiV1 fiber.Router, ctrls *controllers.Controllers, opt_midd
 	apiV1.Get("/health", Health)
 
 	RegisterAuthRoutes(apiV1, ctrls.AuthController, opt_middlewares)
-	RegisterReviewsRoutes(apiV1, ctrls.ReviewsController, opt_middlewares)
+	RegisterReviewsRoutes(apiV1, ctrls.ReviewsController, ctrls.FeedbackController, opt_middlewares)
 	RegisterUserRoutes(apiV1, ctrls.UserController, opt_middlewares)
+	RegisterWebhooksRoutes(apiV1, ctrls.WebhooksController, opt_middlewares)
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/simondanielsson/apPRoved/cmd/internal/controllers"
+	"github.com/simondanielsson/apPRoved/cmd/internal/middlewares"
+)
+
+func RegisterWebhooksRoutes(apiV1 fiber.Router, webhooksController *controllers.WebhooksController, opt_middlewares middlewares.OptionalMiddlewares) {
+	router := apiV1.Group("/webhooks")
+
+	router.Post("/github", opt_middlewares.GithubWebhook, opt_middlewares.Transaction, webhooksController.HandleGithubWebhook)
+}
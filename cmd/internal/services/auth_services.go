@@ -1,33 +1,131 @@
 package services
 
 import (
+	"errors"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/responses"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
 	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
 	"github.com/simondanielsson/apPRoved/pkg/utils"
 	"gorm.io/gorm"
 )
 
+// refreshTokenBytes is the number of random bytes in a refresh token
+const refreshTokenBytes = 32
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or already used
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
 type AuthService struct {
-	userRepository *repositories.UserRepository
+	config          *config.JWTConfig
+	userRepository  *repositories.UserRepository
+	tokenRepository *repositories.TokenRepository
 }
 
-func NewAuthService(userRepository *repositories.UserRepository) *AuthService {
-	return &AuthService{userRepository: userRepository}
+func NewAuthService(cfg *config.JWTConfig, userRepository *repositories.UserRepository, tokenRepository *repositories.TokenRepository) *AuthService {
+	return &AuthService{
+		config:          cfg,
+		userRepository:  userRepository,
+		tokenRepository: tokenRepository,
+	}
 }
 
-func (s *AuthService) AuthenticateUser(tx *gorm.DB, username, password string) (string, error) {
+func (s *AuthService) AuthenticateUser(tx *gorm.DB, username, password string) (*responses.LoginResponse, error) {
 	user, err := s.userRepository.GetUserByUsername(tx, username)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if err := utils.ValidatePassword(password, user.Password); err != nil {
-		return "", err
+		return nil, err
+	}
+
+	return s.IssueTokens(tx, user.ID)
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and a new refresh token. The used
+// refresh token is revoked.
+func (s *AuthService) RefreshTokens(tx *gorm.DB, refreshToken string) (*responses.LoginResponse, error) {
+	token, err := s.tokenRepository.GetRefreshTokenByHash(tx, utils.HashToken(refreshToken))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err := s.tokenRepository.RevokeRefreshToken(tx, token.ID); err != nil {
+		return nil, err
+	}
+
+	return s.IssueTokens(tx, token.UserID)
+}
+
+// Logout revokes the access token tokenID until it expires, and the refresh token of the session if
+// given. Refresh tokens of other users are ignored.
+func (s *AuthService) Logout(tx *gorm.DB, userID uint, tokenID string, expiresAt time.Time, refreshToken string) error {
+	if tokenID != "" {
+		if err := s.tokenRepository.CreateRevokedToken(tx, &models.RevokedToken{TokenID: tokenID, ExpiresAt: expiresAt}); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken != "" {
+		token, err := s.tokenRepository.GetRefreshTokenByHash(tx, utils.HashToken(refreshToken))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && token.UserID == userID {
+			if err := s.tokenRepository.RevokeRefreshToken(tx, token.ID); err != nil {
+				return err
+			}
+		}
 	}
 
-	token, err := utils.CreateJWTToken(user.ID)
+	if err := s.tokenRepository.DeleteExpiredRefreshTokens(tx, userID); err != nil {
+		return err
+	}
+
+	return s.tokenRepository.DeleteExpiredRevokedTokens(tx)
+}
+
+// IsTokenRevoked reports whether the access token tokenID was revoked
+func (s *AuthService) IsTokenRevoked(tx *gorm.DB, tokenID string) (bool, error) {
+	return s.tokenRepository.IsTokenRevoked(tx, tokenID)
+}
+
+// IssueTokens issues a new access token and refresh token for a user
+func (s *AuthService) IssueTokens(tx *gorm.DB, userID uint) (*responses.LoginResponse, error) {
+	now := time.Now()
+
+	expiresAt := now.Add(s.config.AccessTokenTTL)
+	accessToken, err := utils.CreateJWTToken(userID, expiresAt)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(refreshTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiresAt := now.Add(s.config.RefreshTokenTTL)
+	if err := s.tokenRepository.CreateRefreshToken(tx, &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: refreshExpiresAt,
+	}); err != nil {
+		return nil, err
 	}
 
-	return token, err
+	return &responses.LoginResponse{
+		Token:                 accessToken,
+		ExpiresAt:             expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+	}, nil
 }
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
+func newTestAuthService(t *testing.T, refreshTokenTTL time.Duration) (*AuthService, *gorm.DB, uint, uint) {
+	t.Helper()
+	utils.SetJWTKey("test")
+	db := newTestDB(t)
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com"}
+	if err := db.Create([]*models.User{alice, bob}).Error; err != nil {
+		t.Fatalf("could not create users: %v", err)
+	}
+
+	cfg := &config.JWTConfig{AccessTokenTTL: time.Minute, RefreshTokenTTL: refreshTokenTTL}
+	return NewAuthService(cfg, repositories.NewUserRepository(), repositories.NewTokenRepository()), db, alice.ID, bob.ID
+}
+
+func TestRefreshTokens(t *testing.T) {
+	tests := []struct {
+		name            string
+		refreshTokenTTL time.Duration
+		// use prepares the refresh token of alice before it is exchanged
+		use     func(t *testing.T, s *AuthService, db *gorm.DB, aliceID, bobID uint, refreshToken string) string
+		wantErr error
+	}{
+		{
+			name:            "issued token",
+			refreshTokenTTL: time.Hour,
+		},
+		{
+			name:            "rotated token",
+			refreshTokenTTL: time.Hour,
+			use: func(t *testing.T, s *AuthService, db *gorm.DB, aliceID, bobID uint, refreshToken string) string {
+				if _, err := s.RefreshTokens(db, refreshToken); err != nil {
+					t.Fatalf("RefreshTokens() failed: %v", err)
+				}
+				return refreshToken
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:            "token issued by rotation",
+			refreshTokenTTL: time.Hour,
+			use: func(t *testing.T, s *AuthService, db *gorm.DB, aliceID, bobID uint, refreshToken string) string {
+				tokens, err := s.RefreshTokens(db, refreshToken)
+				if err != nil {
+					t.Fatalf("RefreshTokens() failed: %v", err)
+				}
+				if tokens.RefreshToken == refreshToken {
+					t.Fatalf("RefreshTokens() returned the same refresh token")
+				}
+				return tokens.RefreshToken
+			},
+		},
+		{
+			name:            "expired token",
+			refreshTokenTTL: -time.Second,
+			wantErr:         ErrInvalidRefreshToken,
+		},
+		{
+			name:            "token revoked by logout",
+			refreshTokenTTL: time.Hour,
+			use: func(t *testing.T, s *AuthService, db *gorm.DB, aliceID, bobID uint, refreshToken string) string {
+				if err := s.Logout(db, aliceID, "", time.Time{}, refreshToken); err != nil {
+					t.Fatalf("Logout() failed: %v", err)
+				}
+				return refreshToken
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:            "token passed to the logout of another user",
+			refreshTokenTTL: time.Hour,
+			use: func(t *testing.T, s *AuthService, db *gorm.DB, aliceID, bobID uint, refreshToken string) string {
+				if err := s.Logout(db, bobID, "", time.Time{}, refreshToken); err != nil {
+					t.Fatalf("Logout() failed: %v", err)
+				}
+				return refreshToken
+			},
+		},
+		{
+			name:            "unknown token",
+			refreshTokenTTL: time.Hour,
+			use: func(t *testing.T, s *AuthService, db *gorm.DB, aliceID, bobID uint, refreshToken string) string {
+				return refreshToken + "x"
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db, aliceID, bobID := newTestAuthService(t, tt.refreshTokenTTL)
+			tokens, err := s.IssueTokens(db, aliceID)
+			if err != nil {
+				t.Fatalf("IssueTokens() failed: %v", err)
+			}
+
+			refreshToken := tokens.RefreshToken
+			if tt.use != nil {
+				refreshToken = tt.use(t, s, db, aliceID, bobID, refreshToken)
+			}
+
+			refreshed, err := s.RefreshTokens(db, refreshToken)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RefreshTokens() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			claims, err := utils.ParseJWTToken(refreshed.Token)
+			if err != nil || claims.UserID != aliceID {
+				t.Errorf("RefreshTokens() issued access token %+v, %v, want one of user %d", claims, err, aliceID)
+			}
+		})
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	s, db, aliceID, _ := newTestAuthService(t, time.Hour)
+	tokens, err := s.IssueTokens(db, aliceID)
+	if err != nil {
+		t.Fatalf("IssueTokens() failed: %v", err)
+	}
+	claims, err := utils.ParseJWTToken(tokens.Token)
+	if err != nil {
+		t.Fatalf("could not parse access token: %v", err)
+	}
+
+	if revoked, err := s.IsTokenRevoked(db, claims.Id); err != nil || revoked {
+		t.Fatalf("IsTokenRevoked() = %v, %v before logout", revoked, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Logout(db, aliceID, claims.Id, tokens.ExpiresAt, tokens.RefreshToken); err != nil {
+			t.Fatalf("Logout() failed: %v", err)
+		}
+	}
+	if revoked, err := s.IsTokenRevoked(db, claims.Id); err != nil || !revoked {
+		t.Errorf("IsTokenRevoked() = %v, %v after logout, want revoked", revoked, err)
+	}
+	if _, err := s.RefreshTokens(db, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshTokens() = %v after logout, want %v", err, ErrInvalidRefreshToken)
+	}
+}
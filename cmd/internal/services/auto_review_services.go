@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type AutoReviewService struct {
+	config               *config.AutoReviewConfig
+	autoReviewRepository *repositories.AutoReviewRepository
+	reviewsRepository    *repositories.ReviewsRepository
+	reviewsService       *ReviewsService
+}
+
+// NewAutoReviewService creates a new auto review service
+func NewAutoReviewService(cfg *config.AutoReviewConfig, autoReviewRepository *repositories.AutoReviewRepository, reviewsRepository *repositories.ReviewsRepository, reviewsService *ReviewsService) *AutoReviewService {
+	return &AutoReviewService{
+		config:               cfg,
+		autoReviewRepository: autoReviewRepository,
+		reviewsRepository:    reviewsRepository,
+		reviewsService:       reviewsService,
+	}
+}
+
+// Schedule debounces an auto review of the head commit of an open pull request, if the repository
+// has auto review enabled. Scheduling again before the review is due pushes it back.
+func (s *AutoReviewService) Schedule(tx *gorm.DB, repo *models.Repository, pr *models.PullRequest) error {
+	if !repo.AutoReview || pr.State != string(constants.PRStateOpen) || pr.LastCommit == "" {
+		return nil
+	}
+
+	debounce := s.config.DefaultDebounce
+	if repo.AutoReviewDebounceSeconds > 0 {
+		debounce = time.Duration(repo.AutoReviewDebounceSeconds) * time.Second
+	}
+
+	return s.autoReviewRepository.UpsertPendingAutoReview(tx, &models.PendingAutoReview{
+		PullRequestID: pr.ID,
+		HeadSHA:       pr.LastCommit,
+		DueAt:         time.Now().Add(debounce),
+	})
+}
+
+// Unschedule drops the pending auto review of a pull request, e.g. because it was closed
+func (s *AutoReviewService) Unschedule(tx *gorm.DB, prID uint) error {
+	return s.autoReviewRepository.DeletePendingAutoReviewsForPullRequest(tx, prID)
+}
+
+// RunDue creates a review for the next due auto review through the same path as a manually
+// requested review. It returns false if no auto review was due.
+func (s *AutoReviewService) RunDue(ctx context.Context, tx *gorm.DB) (bool, error) {
+	pending, err := s.autoReviewRepository.GetDuePendingAutoReview(tx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	pr, err := s.reviewsRepository.GetPullRequestWithRepository(tx, pending.PullRequestID)
+	if err != nil {
+		return true, err
+	}
+	if !pr.Repository.AutoReview || pr.State != string(constants.PRStateOpen) {
+		return true, s.autoReviewRepository.DeletePendingAutoReview(tx, pending.ID)
+	}
+	// the pull request got new commits since the review was scheduled without being rescheduled, e.g.
+	// because the webhook was missed, so the review is debounced again for the new head
+	if pending.HeadSHA != pr.LastCommit {
+		log.Printf("Rescheduling auto review of pull request %d, head moved from %s to %s", pr.ID, shortSHA(pending.HeadSHA), shortSHA(pr.LastCommit))
+		return true, s.Schedule(tx, &pr.Repository, pr)
+	}
+
+	if err := tx.SavePoint("auto_review").Error; err != nil {
+		return true, err
+	}
+
+	name := fmt.Sprintf("Auto review of %s", shortSHA(pr.LastCommit))
+	if _, err := s.reviewsService.createReview(tx, ctx, pr.RepositoryID, pr.ID, &requests.CreateReviewRequest{Name: name, Mode: constants.ReviewModeFull}, pr.Repository.UserID, constants.ActorSystem, pending.HeadSHA); err != nil {
+		if err := tx.RollbackTo("auto_review").Error; err != nil {
+			return true, err
+		}
+
+		// being rate limited says nothing about the review, so it does not count as an attempt
+		var rateLimitedErr *utils.RateLimitedError
+		if errors.As(err, &rateLimitedErr) {
+			log.Printf("Postponing auto review of pull request %d: %v", pr.ID, err)
+			return true, s.autoReviewRepository.PostponePendingAutoReview(tx, pending.ID, pending.Attempts, rateLimitedErr.RetryAt, err.Error())
+		}
+
+		attempts := pending.Attempts + 1
+		if attempts >= s.config.MaxAttempts {
+			log.Printf("Giving up on auto review of pull request %d after %d attempts: %v", pr.ID, attempts, err)
+			return true, s.autoReviewRepository.DeletePendingAutoReview(tx, pending.ID)
+		}
+
+		log.Printf("Could not create auto review of pull request %d (attempt %d): %v", pr.ID, attempts, err)
+		return true, s.autoReviewRepository.PostponePendingAutoReview(tx, pending.ID, attempts, time.Now().Add(s.config.RetryDelay), err.Error())
+	}
+
+	log.Printf("Created auto review of pull request %d at %s", pr.ID, pr.LastCommit)
+	return true, s.autoReviewRepository.DeletePendingAutoReview(tx, pending.ID)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
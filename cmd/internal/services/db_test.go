@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns an in-memory database with the tables of all models
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:?_pragma=foreign_keys(1)"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	// every connection to an in-memory database opens a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models.Models...); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	return db
+}
+
+// createTestReview creates a review of a pull request of a new user, in the status given
+func createTestReview(t *testing.T, db *gorm.DB, status constants.ReviewStatus) (*models.Review, *models.ReviewStatus) {
+	t.Helper()
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+
+	user := &models.User{Username: "octocat", Email: fmt.Sprintf("octocat%d@example.com", users)}
+	repo := &models.Repository{User: *user, Name: "repo", Owner: "octocat"}
+	pr := &models.PullRequest{Repository: *repo, Number: 1, LastCommit: "head"}
+	review := &models.Review{PullRequest: *pr, HeadSHA: "head", BaseSHA: "base", Mode: string(constants.ReviewModeFull)}
+	if err := db.Create(review).Error; err != nil {
+		t.Fatalf("could not create review: %v", err)
+	}
+	reviewStatus := &models.ReviewStatus{ReviewID: review.ID, Status: status, Attempt: 1}
+	if err := db.Create(reviewStatus).Error; err != nil {
+		t.Fatalf("could not create review status: %v", err)
+	}
+	return review, reviewStatus
+}
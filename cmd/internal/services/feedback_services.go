@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/responses"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
+	"gorm.io/gorm"
+)
+
+type FeedbackService struct {
+	feedbackRepository *repositories.FeedbackRepository
+	reviewsRepository  *repositories.ReviewsRepository
+}
+
+// NewFeedbackService creates a new feedback service
+func NewFeedbackService(feedbackRepository *repositories.FeedbackRepository, reviewsRepository *repositories.ReviewsRepository) *FeedbackService {
+	return &FeedbackService{
+		feedbackRepository: feedbackRepository,
+		reviewsRepository:  reviewsRepository,
+	}
+}
+
+// UpdateFeedback records the user's feedback on a file review, or on one of its review comments if
+// commentID is not 0. Dismissing requires a reason.
+func (s *FeedbackService) UpdateFeedback(tx *gorm.DB, userID, repoID, prID, reviewID, fileReviewID, commentID uint, req *requests.UpdateFeedbackRequest) (*responses.GetFeedbackResponse, error) {
+	if _, err := s.reviewsRepository.GetFileReview(tx, userID, repoID, prID, reviewID, fileReviewID); err != nil {
+		return nil, err
+	}
+	if commentID != 0 {
+		if _, err := s.reviewsRepository.GetReviewComment(tx, fileReviewID, commentID); err != nil {
+			return nil, err
+		}
+	}
+
+	feedback, err := s.feedbackRepository.GetFeedback(tx, fileReviewID, commentID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		feedback = &models.FileReviewFeedback{
+			FileReviewID:    fileReviewID,
+			ReviewCommentID: commentID,
+			UserID:          userID,
+			Vote:            constants.VoteNone,
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if req.Vote != nil {
+		switch *req.Vote {
+		case constants.VoteUp, constants.VoteDown, constants.VoteNone:
+			feedback.Vote = *req.Vote
+		default:
+			return nil, customerrors.NewValidationError("vote", fmt.Sprintf("unknown vote %q", *req.Vote))
+		}
+	}
+	if req.Resolved != nil {
+		feedback.Resolved = *req.Resolved
+	}
+	if req.DismissReason != nil {
+		feedback.DismissReason = strings.TrimSpace(*req.DismissReason)
+	}
+	if req.Dismissed != nil {
+		feedback.Dismissed = *req.Dismissed
+		if !feedback.Dismissed {
+			feedback.DismissReason = ""
+		}
+	}
+	if feedback.Dismissed && feedback.DismissReason == "" {
+		return nil, customerrors.NewValidationError("dismiss_reason", "a reason is required to dismiss")
+	}
+
+	if err := s.feedbackRepository.SaveFeedback(tx, feedback); err != nil {
+		return nil, err
+	}
+
+	response := &responses.GetFeedbackResponse{
+		FileReviewID:  feedback.FileReviewID,
+		Vote:          feedback.Vote,
+		Resolved:      feedback.Resolved,
+		Dismissed:     feedback.Dismissed,
+		DismissReason: feedback.DismissReason,
+		UpdatedAt:     feedback.UpdatedAt,
+	}
+	if feedback.ReviewCommentID != 0 {
+		response.ReviewCommentID = &feedback.ReviewCommentID
+	}
+	return response, nil
+}
+
+// GetFeedbackSummary aggregates the feedback on the reviews of a repository created in the last
+// given number of weeks, in total and per week
+func (s *FeedbackService) GetFeedbackSummary(tx *gorm.DB, userID, repoID uint, weeks int) (*responses.GetFeedbackSummaryResponse, error) {
+	if weeks < 1 {
+		return nil, customerrors.NewValidationError("weeks", "must be at least 1")
+	}
+
+	if _, err := s.reviewsRepository.GetRepository(tx, userID, repoID); err != nil {
+		return nil, err
+	}
+
+	since := time.Now().AddDate(0, 0, -7*weeks)
+	stats, err := s.feedbackRepository.GetFeedbackStats(tx, userID, repoID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &responses.GetFeedbackSummaryResponse{
+		RepositoryID: repoID,
+		Since:        since,
+		Total:        &responses.FeedbackStatsResponse{},
+		Weeks:        []*responses.FeedbackStatsResponse{},
+	}
+	for _, week := range stats {
+		response.Total.FileReviews += week.FileReviews
+		response.Total.Upvotes += week.Upvotes
+		response.Total.Downvotes += week.Downvotes
+		response.Total.Resolved += week.Resolved
+		response.Total.Dismissed += week.Dismissed
+
+		weekStart := week.Week
+		response.Weeks = append(response.Weeks, &responses.FeedbackStatsResponse{
+			Week:        &weekStart,
+			FileReviews: week.FileReviews,
+			Upvotes:     week.Upvotes,
+			Downvotes:   week.Downvotes,
+			Resolved:    week.Resolved,
+			Dismissed:   week.Dismissed,
+			Usefulness:  usefulness(week.Upvotes, week.Downvotes),
+		})
+	}
+	response.Total.Usefulness = usefulness(response.Total.Upvotes, response.Total.Downvotes)
+
+	return response, nil
+}
+
+func usefulness(upvotes, downvotes int) *float64 {
+	if upvotes+downvotes == 0 {
+		return nil
+	}
+	share := float64(upvotes) / float64(upvotes+downvotes)
+	return &share
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/responses"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrGithubOAuthNotConfigured is returned when signing in with GitHub is not set up
+	ErrGithubOAuthNotConfigured = errors.New("signing in with GitHub is not configured")
+	// ErrGithubOAuthFailed is returned when GitHub does not grant access
+	ErrGithubOAuthFailed = errors.New("GitHub authorization failed")
+	// ErrGithubAccountConflict is returned when a GitHub account cannot be linked to the user signing in
+	ErrGithubAccountConflict = errors.New("GitHub account cannot be linked")
+)
+
+type GithubAuthService struct {
+	oauth                      *utils.GithubOAuth
+	encryptionKey              []byte
+	userRepository             *repositories.UserRepository
+	githubCredentialRepository *repositories.GithubCredentialRepository
+	authService                *AuthService
+}
+
+// NewGithubAuthService creates a new GitHub auth service. Signing in with GitHub is disabled unless
+// an OAuth app and a token encryption key are configured.
+func NewGithubAuthService(cfg *config.GithubConfig, userRepository *repositories.UserRepository, githubCredentialRepository *repositories.GithubCredentialRepository, authService *AuthService) *GithubAuthService {
+	encryptionKey, _ := parseTokenEncryptionKey(cfg)
+
+	return &GithubAuthService{
+		oauth:                      newGithubOAuth(cfg),
+		encryptionKey:              encryptionKey,
+		userRepository:             userRepository,
+		githubCredentialRepository: githubCredentialRepository,
+		authService:                authService,
+	}
+}
+
+// AuthCodeURL returns the GitHub URL to send the user to. state is echoed back to the callback.
+func (s *GithubAuthService) AuthCodeURL(state string) (string, error) {
+	if !s.configured() {
+		return "", ErrGithubOAuthNotConfigured
+	}
+	return s.oauth.AuthCodeURL(state), nil
+}
+
+// Login exchanges an authorization code for a GitHub token, signs the GitHub account in, and issues
+// our own tokens. Unknown GitHub accounts are linked to the signed in user if there is one, and get a
+// new user otherwise.
+func (s *GithubAuthService) Login(ctx context.Context, tx *gorm.DB, code string, signedInUserID *uint) (*responses.LoginResponse, error) {
+	if !s.configured() {
+		return nil, ErrGithubOAuthNotConfigured
+	}
+
+	token, err := s.oauth.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGithubOAuthFailed, err)
+	}
+
+	githubUser, err := s.oauth.GetUser(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch GitHub user: %v", err)
+	}
+
+	user, err := s.findOrCreateUser(tx, githubUser, signedInUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storeCredential(tx, user.ID, token); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d signed in with GitHub account %s", user.ID, githubUser.Login)
+	return s.authService.IssueTokens(tx, user.ID)
+}
+
+// findOrCreateUser returns the user linked to a GitHub account. An account that is not linked yet is
+// linked to the signed in user, if any, and gets a new user otherwise. It is never linked to a user by
+// email, since an email on GitHub does not prove that the account belongs to the user with that email.
+func (s *GithubAuthService) findOrCreateUser(tx *gorm.DB, githubUser *utils.GithubUser, signedInUserID *uint) (*models.User, error) {
+	user, err := s.userRepository.GetUserByGithubID(tx, githubUser.ID)
+	if err == nil {
+		if signedInUserID != nil && *signedInUserID != user.ID {
+			return nil, fmt.Errorf("%w: GitHub account %s is linked to another user", ErrGithubAccountConflict, githubUser.Login)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if signedInUserID != nil {
+		user, err := s.userRepository.GetUser(tx, *signedInUserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.GithubID != nil {
+			return nil, fmt.Errorf("%w: user %d is linked to another GitHub account", ErrGithubAccountConflict, user.ID)
+		}
+		if err := s.userRepository.UpdateUserGithubAccount(tx, user.ID, githubUser.ID, githubUser.Login); err != nil {
+			return nil, err
+		}
+		log.Printf("Linked user %d to GitHub account %s", user.ID, githubUser.Login)
+		return user, nil
+	}
+
+	email := githubUser.Email
+	if email != "" {
+		_, err := s.userRepository.GetUserByEmail(tx, email)
+		if err == nil {
+			return nil, fmt.Errorf("%w: %s belongs to an existing user, who has to sign in before linking the GitHub account", ErrGithubAccountConflict, email)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	} else {
+		// GitHub's no-reply address, as users without a verified email still need a unique one
+		email = fmt.Sprintf("%d+%s@users.noreply.github.com", githubUser.ID, strings.ToLower(githubUser.Login))
+	}
+
+	githubID := githubUser.ID
+	user = &models.User{
+		Username:    githubUser.Login,
+		Email:       email,
+		GithubID:    &githubID,
+		GithubLogin: githubUser.Login,
+	}
+	if _, err := s.userRepository.CreateUser(tx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *GithubAuthService) storeCredential(tx *gorm.DB, userID uint, token *oauth2.Token) error {
+	credential, err := newGithubCredential(s.encryptionKey, userID, token)
+	if err != nil {
+		return err
+	}
+
+	return s.githubCredentialRepository.UpsertGithubCredential(tx, credential)
+}
+
+// newGithubCredential returns the credential of a user for a GitHub token, with its tokens encrypted
+func newGithubCredential(encryptionKey []byte, userID uint, token *oauth2.Token) (*models.GithubCredential, error) {
+	accessToken, err := utils.EncryptString(encryptionKey, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := &models.GithubCredential{
+		UserID:      userID,
+		AccessToken: accessToken,
+		TokenType:   token.Type(),
+	}
+	if scopes, ok := token.Extra("scope").(string); ok {
+		credential.Scopes = scopes
+	}
+	if token.RefreshToken != "" {
+		credential.RefreshToken, err = utils.EncryptString(encryptionKey, token.RefreshToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !token.Expiry.IsZero() {
+		expiresAt := token.Expiry
+		credential.ExpiresAt = &expiresAt
+	}
+
+	return credential, nil
+}
+
+func (s *GithubAuthService) configured() bool {
+	return s.oauth.Configured() && s.encryptionKey != nil
+}
+
+func newGithubOAuth(cfg *config.GithubConfig) *utils.GithubOAuth {
+	return utils.NewGithubOAuth(cfg.ClientID, cfg.ClientSecret, cfg.OAuthRedirectURL, cfg.OAuthAuthURL, cfg.OAuthTokenURL, cfg.APIURL)
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// githubCachePruneInterval is how often expired responses are deleted
+const githubCachePruneInterval = time.Hour
+
+// GithubCacheService caches GitHub responses in Postgres, so that the cache is shared by all replicas
+// and survives restarts. It implements utils.GithubCache. Unlike other services it runs its own
+// queries, since it is called by the HTTP transport of the GitHub clients rather than by a request.
+type GithubCacheService struct {
+	config                *config.GithubCacheConfig
+	db                    *gorm.DB
+	githubCacheRepository *repositories.GithubCacheRepository
+
+	mutex      sync.Mutex
+	lastPruned time.Time
+}
+
+// NewGithubCacheService creates a new GitHub cache service
+func NewGithubCacheService(cfg *config.GithubCacheConfig, db *gorm.DB, githubCacheRepository *repositories.GithubCacheRepository) *GithubCacheService {
+	return &GithubCacheService{
+		config:                cfg,
+		db:                    db,
+		githubCacheRepository: githubCacheRepository,
+	}
+}
+
+// Get returns the cached response for a key, or nil if it is not cached
+func (s *GithubCacheService) Get(ctx context.Context, key string) (*utils.GithubCacheEntry, error) {
+	entry, err := s.githubCacheRepository.GetGithubCacheEntry(s.db.WithContext(ctx), key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var header http.Header
+	if err := json.Unmarshal(entry.Header, &header); err != nil {
+		return nil, err
+	}
+
+	return &utils.GithubCacheEntry{
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		StatusCode:   entry.StatusCode,
+		Header:       header,
+		Body:         entry.Body,
+	}, nil
+}
+
+// Set caches a response. Responses older than the configured max age are pruned along the way.
+func (s *GithubCacheService) Set(ctx context.Context, key string, entry *utils.GithubCacheEntry) error {
+	header, err := json.Marshal(entry.Header)
+	if err != nil {
+		return err
+	}
+
+	tx := s.db.WithContext(ctx)
+	if err := s.githubCacheRepository.UpsertGithubCacheEntry(tx, &models.GithubCacheEntry{
+		Key:          key,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		StatusCode:   entry.StatusCode,
+		Header:       header,
+		Body:         entry.Body,
+	}); err != nil {
+		return err
+	}
+
+	if s.pruneDue() {
+		pruned, err := s.githubCacheRepository.DeleteGithubCacheEntriesBefore(tx, time.Now().Add(-s.config.MaxAge))
+		if err != nil {
+			return err
+		}
+		log.Printf("Pruned %d expired GitHub cache entries", pruned)
+	}
+
+	return nil
+}
+
+// pruneDue reports whether expired responses should be pruned now
+func (s *GithubCacheService) pruneDue() bool {
+	if s.config.MaxAge <= 0 {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if time.Since(s.lastPruned) < githubCachePruneInterval {
+		return false
+	}
+	s.lastPruned = time.Now()
+	return true
+}
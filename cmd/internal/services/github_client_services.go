@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// ErrNoGithubCredential is returned when a user has no GitHub credential, or when the user's credential
+// expired and cannot be refreshed
+var ErrNoGithubCredential = errors.New("no GitHub credential available, sign in with GitHub first")
+
+// maxCachedGithubClients is the number of user and installation clients kept at most, each
+const maxCachedGithubClients = 1000
+
+type GithubClientService struct {
+	encryptionKey              []byte
+	encryptionKeyErr           error
+	oauth                      *utils.GithubOAuth
+	app                        *utils.GithubApp
+	githubCredentialRepository *repositories.GithubCredentialRepository
+
+	mutex               sync.Mutex
+	clients             map[uint]*userGithubClient
+	installationClients map[int64]*utils.GithubClient
+}
+
+// userGithubClient is a cached client of a user, valid as long as the user's token does not change
+type userGithubClient struct {
+	tokenHash string
+	client    *utils.GithubClient
+}
+
+// NewGithubClientService creates a new GitHub client service
+func NewGithubClientService(cfg *config.GithubConfig, githubCredentialRepository *repositories.GithubCredentialRepository) *GithubClientService {
+	encryptionKey, encryptionKeyErr := parseTokenEncryptionKey(cfg)
+
+	return &GithubClientService{
+		encryptionKey:              encryptionKey,
+		encryptionKeyErr:           encryptionKeyErr,
+		oauth:                      newGithubOAuth(cfg),
+		app:                        newGithubApp(cfg),
+		githubCredentialRepository: githubCredentialRepository,
+		clients:                    make(map[uint]*userGithubClient),
+		installationClients:        make(map[int64]*utils.GithubClient),
+	}
+}
+
+// ForRepository returns a GitHub client for accessing a repository: as the GitHub App installation of
+// the repository if it has one, and as the user who registered it otherwise
+func (s *GithubClientService) ForRepository(ctx context.Context, tx *gorm.DB, repo *models.Repository) (*utils.GithubClient, error) {
+	if repo.InstallationID == nil || s.app == nil {
+		return s.ForUser(ctx, tx, repo.UserID)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if client, ok := s.installationClients[*repo.InstallationID]; ok {
+		return client, nil
+	}
+
+	client, err := utils.NewGithubClientForInstallation(ctx, s.app, *repo.InstallationID)
+	if err != nil {
+		return nil, err
+	}
+	cacheGithubClient(s.installationClients, *repo.InstallationID, client)
+
+	return client, nil
+}
+
+// FindInstallation returns the ID of the GitHub App installation to access owner/name with on behalf of
+// a user, or nil if the app is not configured or not installed on the repository. The installation acts
+// with permissions of its own, so it is only returned if the user can access the repository with their
+// own GitHub credential.
+func (s *GithubClientService) FindInstallation(ctx context.Context, tx *gorm.DB, userID uint, owner, name string) (*int64, error) {
+	if s.app == nil {
+		return nil, nil
+	}
+
+	userClient, err := s.userClient(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if userClient == nil {
+		return nil, nil
+	}
+	hasAccess, err := userClient.HasRepositoryAccess(ctx, name, owner)
+	if err != nil {
+		return nil, fmt.Errorf("could not check access of user %d to %s/%s: %w", userID, owner, name, err)
+	}
+	if !hasAccess {
+		log.Printf("User %d has no access to %s/%s, not using the GitHub App installation", userID, owner, name)
+		return nil, nil
+	}
+
+	installationID, err := s.app.FindRepositoryInstallation(ctx, name, owner)
+	if errors.Is(err, utils.ErrGithubAppNotInstalled) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not look up GitHub App installation of %s/%s: %w", owner, name, err)
+	}
+
+	return &installationID, nil
+}
+
+// ForUser returns a GitHub client authenticated as the user, so that GitHub is accessed with the
+// user's permissions and rate limit. Users without a GitHub credential get ErrNoGithubCredential; GitHub
+// is never accessed as the server on behalf of a user.
+func (s *GithubClientService) ForUser(ctx context.Context, tx *gorm.DB, userID uint) (*utils.GithubClient, error) {
+	client, err := s.userClient(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("%w: user %d has not signed in with GitHub", ErrNoGithubCredential, userID)
+	}
+	return client, nil
+}
+
+// userClient returns a GitHub client authenticated as the user, or nil if the user has no GitHub
+// credential
+func (s *GithubClientService) userClient(ctx context.Context, tx *gorm.DB, userID uint) (*utils.GithubClient, error) {
+	token, err := s.userToken(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, nil
+	}
+
+	tokenHash := utils.HashToken(token)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if cached, ok := s.clients[userID]; ok && cached.tokenHash == tokenHash {
+		return cached.client, nil
+	}
+
+	client, err := utils.NewGithubClientWithToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	cacheGithubClient(s.clients, userID, &userGithubClient{tokenHash: tokenHash, client: client})
+
+	return client, nil
+}
+
+// userToken returns the decrypted GitHub token of a user, refreshing it if it expired, or an empty string
+// if the user has no GitHub credential
+func (s *GithubClientService) userToken(ctx context.Context, tx *gorm.DB, userID uint) (string, error) {
+	credential, err := s.githubCredentialRepository.GetGithubCredential(tx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if s.encryptionKey == nil {
+		return "", fmt.Errorf("could not decrypt GitHub credential of user %d: %w", userID, s.encryptionKeyErr)
+	}
+
+	if credential.ExpiresAt != nil && time.Now().After(*credential.ExpiresAt) {
+		credential, err = s.refreshCredential(ctx, tx, userID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	token, err := utils.DecryptString(s.encryptionKey, credential.AccessToken)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt GitHub credential of user %d: %v", userID, err)
+	}
+
+	return token, nil
+}
+
+// refreshCredential replaces the expired GitHub credential of a user with one obtained with its refresh
+// token. The credential is locked while refreshing, so that concurrent requests do not use the same
+// refresh token twice.
+func (s *GithubClientService) refreshCredential(ctx context.Context, tx *gorm.DB, userID uint) (*models.GithubCredential, error) {
+	credential, err := s.githubCredentialRepository.GetGithubCredentialForUpdate(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// refreshed by another request while waiting for the lock
+	if credential.ExpiresAt == nil || time.Now().Before(*credential.ExpiresAt) {
+		return credential, nil
+	}
+
+	if credential.RefreshToken == "" || !s.oauth.Configured() {
+		return nil, fmt.Errorf("%w: GitHub credential of user %d expired at %s", ErrNoGithubCredential, userID, credential.ExpiresAt)
+	}
+	refreshToken, err := utils.DecryptString(s.encryptionKey, credential.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt GitHub refresh token of user %d: %v", userID, err)
+	}
+
+	token, err := s.oauth.Refresh(ctx, refreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not refresh expired GitHub credential of user %d: %v", ErrNoGithubCredential, userID, err)
+	}
+
+	refreshed, err := newGithubCredential(s.encryptionKey, userID, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.githubCredentialRepository.UpsertGithubCredential(tx, refreshed); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Refreshed expired GitHub credential of user %d", userID)
+	return refreshed, nil
+}
+
+// newGithubApp returns the GitHub App to authenticate as, or nil if it is not configured or its private
+// key is invalid
+func newGithubApp(cfg *config.GithubConfig) *utils.GithubApp {
+	if cfg.AppID == 0 {
+		return nil
+	}
+
+	// keys passed through the environment often have their newlines escaped
+	privateKey := []byte(strings.ReplaceAll(cfg.AppPrivateKey, `\n`, "\n"))
+	if cfg.AppPrivateKey == "" && cfg.AppPrivateKeyPath != "" {
+		key, err := os.ReadFile(cfg.AppPrivateKeyPath)
+		if err != nil {
+			log.Printf("Could not read GitHub App private key, GitHub App authentication is disabled: %v", err)
+			return nil
+		}
+		privateKey = key
+	}
+
+	app, err := utils.NewGithubApp(cfg.AppID, privateKey, cfg.APIURL)
+	if err != nil {
+		log.Printf("GitHub App authentication is disabled: %v", err)
+		return nil
+	}
+	return app
+}
+
+// parseTokenEncryptionKey returns the key GitHub tokens are encrypted with, or nil and the reason if it
+// is missing or invalid
+func parseTokenEncryptionKey(cfg *config.GithubConfig) ([]byte, error) {
+	if cfg.TokenEncryptionKey == "" {
+		return nil, errors.New("no GitHub token encryption key configured")
+	}
+
+	key, err := utils.ParseEncryptionKey(cfg.TokenEncryptionKey)
+	if err != nil {
+		log.Printf("Invalid GitHub token encryption key, stored GitHub credentials are disabled: %v", err)
+		return nil, fmt.Errorf("invalid GitHub token encryption key: %v", err)
+	}
+	return key, nil
+}
+
+// cacheGithubClient caches a client, evicting an arbitrary client once the cache holds
+// maxCachedGithubClients clients
+func cacheGithubClient[K comparable, V any](clients map[K]V, key K, client V) {
+	if _, ok := clients[key]; !ok && len(clients) >= maxCachedGithubClients {
+		for evicted := range clients {
+			delete(clients, evicted)
+			break
+		}
+	}
+	clients[key] = client
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/responses"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type GithubPublicationService struct {
+	config                      *config.GithubPublicationConfig
+	githubPublicationRepository *repositories.GithubPublicationRepository
+	reviewsRepository           *repositories.ReviewsRepository
+	githubClientService         *GithubClientService
+}
+
+// NewGithubPublicationService creates a new GitHub publication service
+func NewGithubPublicationService(cfg *config.GithubPublicationConfig, githubPublicationRepository *repositories.GithubPublicationRepository, reviewsRepository *repositories.ReviewsRepository, githubClientService *GithubClientService) *GithubPublicationService {
+	return &GithubPublicationService{
+		config:                      cfg,
+		githubPublicationRepository: githubPublicationRepository,
+		reviewsRepository:           reviewsRepository,
+		githubClientService:         githubClientService,
+	}
+}
+
+// Schedule schedules the publication of a completed review to GitHub, if its repository has
+// publishing enabled
+func (s *GithubPublicationService) Schedule(tx *gorm.DB, reviewID uint) error {
+	review, err := s.reviewsRepository.GetReviewForPublication(tx, reviewID)
+	if err != nil {
+		return err
+	}
+	if !review.PullRequest.Repository.PublishToGithub {
+		return nil
+	}
+
+	return s.githubPublicationRepository.UpsertPendingGithubPublication(tx, &models.PendingGithubPublication{
+		ReviewID: reviewID,
+		DueAt:    time.Now(),
+	})
+}
+
+// PublishDue publishes the next due review to GitHub. It returns false if no publication was due.
+func (s *GithubPublicationService) PublishDue(ctx context.Context, tx *gorm.DB) (bool, error) {
+	pending, err := s.githubPublicationRepository.GetDuePendingGithubPublication(tx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	review, err := s.reviewsRepository.GetReviewForPublication(tx, pending.ReviewID)
+	if err != nil {
+		return true, err
+	}
+
+	if err := s.publish(ctx, tx, review); err != nil {
+		// being rate limited says nothing about the review, so it does not count as an attempt
+		var rateLimitedErr *utils.RateLimitedError
+		if errors.As(err, &rateLimitedErr) {
+			log.Printf("Postponing publication of review %d: %v", review.ID, err)
+			return true, s.githubPublicationRepository.PostponePendingGithubPublication(tx, pending.ID, pending.Attempts, rateLimitedErr.RetryAt, err.Error())
+		}
+
+		attempts := pending.Attempts + 1
+		if attempts >= s.config.MaxAttempts {
+			log.Printf("Giving up on publishing review %d after %d attempts: %v", review.ID, attempts, err)
+			return true, s.githubPublicationRepository.DeletePendingGithubPublication(tx, pending.ID)
+		}
+
+		log.Printf("Could not publish review %d (attempt %d): %v", review.ID, attempts, err)
+		return true, s.githubPublicationRepository.PostponePendingGithubPublication(tx, pending.ID, attempts, time.Now().Add(s.config.RetryDelay), err.Error())
+	}
+
+	log.Printf("Published review %d to GitHub review %d", review.ID, review.GithubReviewID)
+	return true, s.githubPublicationRepository.DeletePendingGithubPublication(tx, pending.ID)
+}
+
+// PublishReview publishes a completed review of the user to GitHub right away, regardless of the
+// repository setting. Publishing a review again updates the GitHub review.
+func (s *GithubPublicationService) PublishReview(ctx context.Context, tx *gorm.DB, userID, repoID, prID, reviewID uint) (*responses.PublishReviewResponse, error) {
+	if _, err := s.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID); err != nil {
+		return nil, err
+	}
+
+	review, err := s.reviewsRepository.GetReviewForPublication(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if review.ReviewStatus.Status != constants.StatusAvailable {
+		return nil, customerrors.NewValidationError("review_id", fmt.Sprintf("review %d is %s, only available reviews can be published", reviewID, review.ReviewStatus.Status))
+	}
+
+	if err := s.publish(ctx, tx, review); err != nil {
+		return nil, fmt.Errorf("could not publish review: %w", err)
+	}
+
+	if err := s.githubPublicationRepository.DeletePendingGithubPublicationsForReview(tx, reviewID); err != nil {
+		return nil, err
+	}
+
+	return &responses.PublishReviewResponse{
+		GithubReviewID: review.GithubReviewID,
+		PublishedAt:    *review.PublishedAt,
+	}, nil
+}
+
+// publish publishes a review to GitHub as the installation of its repository, or as the owner of the
+// repository if it has none
+func (s *GithubPublicationService) publish(ctx context.Context, tx *gorm.DB, review *models.Review) error {
+	pr := review.PullRequest
+	repo := pr.Repository
+
+	githubClient, err := s.githubClientService.ForRepository(ctx, tx, &repo)
+	if err != nil {
+		return err
+	}
+
+	githubReviewID, err := githubClient.PublishReview(ctx, repo.Name, repo.Owner, pr.Number, review.HeadSHA, newGithubReview(review), review.GithubReviewID)
+	if err != nil {
+		return err
+	}
+
+	publishedAt := time.Now()
+	if err := s.reviewsRepository.UpdateReviewGithubReviewID(tx, review.ID, githubReviewID, publishedAt); err != nil {
+		return err
+	}
+	review.GithubReviewID = githubReviewID
+	review.PublishedAt = &publishedAt
+
+	return nil
+}
+
+// newGithubReview turns the file reviews of a review into a GitHub review. Review comments are posted
+// inline on their lines. The content of file reviews without review comments is commented on the
+// first line of their diff; other file contents are added to the summary.
+func newGithubReview(review *models.Review) *utils.GithubReview {
+	var body strings.Builder
+	fmt.Fprintf(&body, "### %s\n\n", review.Name)
+	fmt.Fprintf(&body, "Reviewed %d files at %s.\n", len(review.FileReviews), review.HeadSHA)
+
+	githubReview := &utils.GithubReview{Marker: githubReviewMarker(review.ID)}
+	for _, fileReview := range review.FileReviews {
+		for _, comment := range fileReview.Comments {
+			githubReview.Comments = append(githubReview.Comments, &utils.GithubReviewComment{
+				Path:      fileReview.Filename,
+				Side:      string(comment.Side),
+				StartLine: comment.StartLine,
+				Line:      comment.EndLine,
+				Body:      formatReviewComment(&comment),
+			})
+		}
+
+		if fileReview.Content == "" {
+			continue
+		}
+		if len(fileReview.Comments) > 0 || !strings.HasPrefix(fileReview.Patch, "@@") {
+			fmt.Fprintf(&body, "\n#### %s\n\n%s\n", fileReview.Filename, fileReview.Content)
+			continue
+		}
+
+		githubReview.Comments = append(githubReview.Comments, &utils.GithubReviewComment{
+			Path:     fileReview.Filename,
+			Position: 1,
+			Body:     fileReview.Content,
+		})
+	}
+	githubReview.Body = body.String()
+
+	return githubReview
+}
+
+// githubReviewMarker identifies the GitHub review of a review. Since the GitHub review is created before
+// the transaction that stores its ID commits, publishing again looks it up by marker rather than creating
+// a duplicate if that transaction failed.
+func githubReviewMarker(reviewID uint) string {
+	return fmt.Sprintf("approved-review-%d", reviewID)
+}
+
+func formatReviewComment(comment *models.ReviewComment) string {
+	var body strings.Builder
+	fmt.Fprintf(&body, "**%s**", comment.Severity)
+	if comment.Category != "" {
+		fmt.Fprintf(&body, " · %s", comment.Category)
+	}
+	fmt.Fprintf(&body, "\n\n%s\n", comment.Body)
+	if comment.Suggestion != nil {
+		fmt.Fprintf(&body, "\n```suggestion\n%s\n```\n", strings.TrimSuffix(*comment.Suggestion, "\n"))
+	}
+	return body.String()
+}
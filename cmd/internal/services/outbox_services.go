@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
+	"gorm.io/gorm"
+)
+
+// maxOutboxBackoff caps the delay between two publish attempts of the same message
+const maxOutboxBackoff = 5 * time.Minute
+
+type OutboxService struct {
+	outboxRepository  *repositories.OutboxRepository
+	reviewsRepository *repositories.ReviewsRepository
+}
+
+// NewOutboxService creates a new outbox service
+func NewOutboxService(outboxRepository *repositories.OutboxRepository, reviewsRepository *repositories.ReviewsRepository) *OutboxService {
+	return &OutboxService{
+		outboxRepository:  outboxRepository,
+		reviewsRepository: reviewsRepository,
+	}
+}
+
+// Enqueue stores a message in the outbox. The message is published by the outbox relay once the
+// transaction commits, and is discarded together with the transaction on rollback. Messages that fail
+// their validate tags are rejected.
+func (s *OutboxService) Enqueue(tx *gorm.DB, queue config.QueueName, reviewID uint, message interface{}) error {
+	if err := utils.ValidateStruct(message); err != nil {
+		return fmt.Errorf("invalid message for %s: %w", queue, err)
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return s.store(tx, queue, reviewID, payload)
+}
+
+func (s *OutboxService) store(tx *gorm.DB, queue config.QueueName, reviewID uint, payload []byte) error {
+	return s.outboxRepository.CreateOutboxMessage(tx, &models.OutboxMessage{
+		ReviewID:      reviewID,
+		Queue:         string(queue),
+		Payload:       payload,
+		NextAttemptAt: time.Now(),
+	})
+}
+
+// Discard drops the messages of a review on a queue that were not published yet
+func (s *OutboxService) Discard(tx *gorm.DB, queue config.QueueName, reviewID uint, reason string) error {
+	discarded, err := s.outboxRepository.DiscardPendingOutboxMessages(tx, reviewID, string(queue), reason)
+	if err != nil {
+		return err
+	}
+	if discarded > 0 {
+		log.Printf("Discarded %d unpublished messages of review %d on %s", discarded, reviewID, queue)
+	}
+	return nil
+}
+
+// Prune deletes the messages that were published or given up on longer than retention ago
+func (s *OutboxService) Prune(tx *gorm.DB, retention time.Duration) error {
+	pruned, err := s.outboxRepository.DeleteSettledOutboxMessages(tx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d settled outbox messages", pruned)
+	}
+	return nil
+}
+
+// DispatchNext publishes the next due message and reports whether there was one. The message stays
+// locked until the transaction commits, so it should be the only message of the transaction: once it is
+// published, its dispatched mark must be committed right away for it not to be published again.
+// Failed messages are retried with exponential backoff until maxAttempts is reached.
+func (s *OutboxService) DispatchNext(ctx context.Context, tx *gorm.DB, queue mq.MessageQueue, maxAttempts int) (bool, error) {
+	messages, err := s.outboxRepository.GetPendingOutboxMessages(tx, 1)
+	if err != nil || len(messages) == 0 {
+		return false, err
+	}
+	message := messages[0]
+
+	err = queue.Publish(ctx, config.QueueName(message.Queue), json.RawMessage(message.Payload))
+	if err == nil {
+		return true, s.outboxRepository.MarkOutboxMessageDispatched(tx, message.ID)
+	}
+
+	attempts := message.Attempts + 1
+	if attempts < maxAttempts {
+		log.Printf("Could not publish outbox message %d (attempt %d): %v", message.ID, attempts, err)
+		nextAttemptAt := time.Now().Add(outboxBackoff(attempts))
+		return true, s.outboxRepository.MarkOutboxMessageAttemptFailed(tx, message.ID, attempts, nextAttemptAt, err.Error())
+	}
+
+	log.Printf("Giving up on outbox message %d after %d attempts: %v", message.ID, attempts, err)
+	if err := s.outboxRepository.MarkOutboxMessageFailed(tx, message.ID, attempts, err.Error()); err != nil {
+		return true, err
+	}
+	if config.QueueName(message.Queue) != config.QueueFileDiffs {
+		return true, nil
+	}
+
+	// a review whose file diffs never reach the review service would stay queued forever
+	reason := fmt.Sprintf("could not send review to the review service: %v", err)
+	reviewStatuses, err := s.reviewsRepository.FailQueuedReview(tx, message.ReviewID, reason)
+	if err != nil {
+		return true, err
+	}
+	var events []*models.ReviewEvent
+	for _, reviewStatus := range reviewStatuses {
+		events = append(events, newReviewEvent(reviewStatus.ReviewID, reviewStatus.Status, reviewStatus.Progress, reason, constants.ActorSystem, nil))
+	}
+	return true, recordReviewEvents(tx, s.reviewsRepository, events)
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := time.Second << uint(attempts)
+	if backoff <= 0 || backoff > maxOutboxBackoff {
+		return maxOutboxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
+)
+
+// fakeQueue records the messages published to it, or fails to publish them with err
+type fakeQueue struct {
+	err       error
+	published []string
+}
+
+func (q *fakeQueue) Close() {}
+
+func (q *fakeQueue) Publish(ctx context.Context, queue config.QueueName, message interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	q.published = append(q.published, string(queue)+" "+string(payload))
+	return nil
+}
+
+func (q *fakeQueue) Subscribe(ctx context.Context, queue config.QueueName, handler mq.MessageHandler) error {
+	return nil
+}
+
+func TestDispatchNext(t *testing.T) {
+	const maxAttempts = 3
+
+	tests := []struct {
+		name          string
+		queue         config.QueueName
+		attempts      int
+		publishErr    error
+		wantPublished bool
+		wantAttempts  int
+		wantFailed    bool
+		wantReview    constants.ReviewStatus
+	}{
+		{name: "published", queue: config.QueueFileDiffs, wantPublished: true, wantReview: constants.StatusQueued},
+		{name: "publish failed", queue: config.QueueFileDiffs, publishErr: errors.New("connection lost"), wantAttempts: 1, wantReview: constants.StatusQueued},
+		{name: "file diffs given up on", queue: config.QueueFileDiffs, attempts: maxAttempts - 1, publishErr: errors.New("connection lost"), wantAttempts: maxAttempts, wantFailed: true, wantReview: constants.StatusFailed},
+		{name: "cancellation given up on", queue: config.QueueReviewCancellations, attempts: maxAttempts - 1, publishErr: errors.New("connection lost"), wantAttempts: maxAttempts, wantFailed: true, wantReview: constants.StatusQueued},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			reviewsRepository := repositories.NewReviewsRepository()
+			outboxService := NewOutboxService(repositories.NewOutboxRepository(), reviewsRepository)
+			review, reviewStatus := createTestReview(t, db, constants.StatusQueued)
+
+			message := &models.OutboxMessage{
+				ReviewID:      review.ID,
+				Queue:         string(tt.queue),
+				Payload:       []byte(`{"review_id":1}`),
+				Attempts:      tt.attempts,
+				NextAttemptAt: time.Now().Add(-time.Second),
+			}
+			if err := db.Create(message).Error; err != nil {
+				t.Fatalf("could not create outbox message: %v", err)
+			}
+
+			queue := &fakeQueue{err: tt.publishErr}
+			dispatched, err := outboxService.DispatchNext(context.Background(), db, queue, maxAttempts)
+			if err != nil {
+				t.Fatalf("DispatchNext() failed: %v", err)
+			}
+			if !dispatched {
+				t.Fatalf("DispatchNext() found no message to dispatch")
+			}
+			if published := len(queue.published) == 1; published != tt.wantPublished {
+				t.Errorf("message published is %v, want %v", published, tt.wantPublished)
+			}
+
+			if err := db.First(message, message.ID).Error; err != nil {
+				t.Fatalf("could not read outbox message: %v", err)
+			}
+			if dispatched := message.DispatchedAt != nil; dispatched != tt.wantPublished {
+				t.Errorf("message marked as dispatched is %v, want %v", dispatched, tt.wantPublished)
+			}
+			if failed := message.FailedAt != nil; failed != tt.wantFailed {
+				t.Errorf("message marked as failed is %v, want %v", failed, tt.wantFailed)
+			}
+			if message.Attempts != tt.wantAttempts {
+				t.Errorf("message has %d attempts, want %d", message.Attempts, tt.wantAttempts)
+			}
+
+			if err := db.First(reviewStatus, reviewStatus.ID).Error; err != nil {
+				t.Fatalf("could not read review status: %v", err)
+			}
+			if reviewStatus.Status != tt.wantReview {
+				t.Errorf("review is %s, want %s", reviewStatus.Status, tt.wantReview)
+			}
+
+			// the message is either settled or not due until its next attempt
+			dispatched, err = outboxService.DispatchNext(context.Background(), db, queue, maxAttempts)
+			if err != nil || dispatched {
+				t.Errorf("DispatchNext() = %v, %v, want no message due", dispatched, err)
+			}
+		})
+	}
+}
+
+func TestPruneOutbox(t *testing.T) {
+	db := newTestDB(t)
+	outboxService := NewOutboxService(repositories.NewOutboxRepository(), repositories.NewReviewsRepository())
+
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now()
+	messages := map[string]*models.OutboxMessage{
+		"old dispatched":    {DispatchedAt: &old},
+		"old failed":        {FailedAt: &old},
+		"recent dispatched": {DispatchedAt: &recent},
+		"pending":           {NextAttemptAt: old},
+	}
+	for _, message := range messages {
+		message.Queue = string(config.QueueFileDiffs)
+		if err := db.Create(message).Error; err != nil {
+			t.Fatalf("could not create outbox message: %v", err)
+		}
+	}
+
+	if err := outboxService.Prune(db, time.Hour); err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+
+	for name, message := range messages {
+		err := db.First(&models.OutboxMessage{}, message.ID).Error
+		if pruned := err != nil; pruned != (name == "old dispatched" || name == "old failed") {
+			t.Errorf("%s message pruned is %v", name, pruned)
+		}
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 2 * time.Second},
+		{attempts: 5, want: 32 * time.Second},
+		{attempts: 9, want: maxOutboxBackoff},
+		{attempts: 100, want: maxOutboxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// PullRequestsService keeps the stored pull requests in line with GitHub. Webhook events and manual
+// refreshes go through the same path, so both schedule auto reviews when a pull request gets new commits.
+type PullRequestsService struct {
+	reviewsRepository   *repositories.ReviewsRepository
+	autoReviewService   *AutoReviewService
+	githubClientService *GithubClientService
+}
+
+// NewPullRequestsService creates a new pull requests service
+func NewPullRequestsService(reviewsRepository *repositories.ReviewsRepository, autoReviewService *AutoReviewService, githubClientService *GithubClientService) *PullRequestsService {
+	return &PullRequestsService{
+		reviewsRepository:   reviewsRepository,
+		autoReviewService:   autoReviewService,
+		githubClientService: githubClientService,
+	}
+}
+
+// Apply brings a pull request of a repository up to date with update, creating it if it is new. An open
+// pull request gets an auto review scheduled when it is new, got new commits or was reopened, and a
+// closed one has its auto review dropped. Updates about an older version of the pull request than the
+// stored one are ignored. It reports whether the update was applied.
+func (s *PullRequestsService) Apply(tx *gorm.DB, repo *models.Repository, update *utils.GithubPullRequest, reopened bool) (bool, error) {
+	pr, err := s.reviewsRepository.GetPullRequestByNumberForUpdate(tx, repo.ID, update.Number)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		newPR := &models.PullRequest{
+			RepositoryID:    repo.ID,
+			Number:          update.Number,
+			Title:           update.Title,
+			URL:             update.URL,
+			State:           update.State,
+			LastCommit:      update.LastCommit,
+			GithubUpdatedAt: githubUpdatedAt(update),
+		}
+		if err := s.reviewsRepository.CreatePullRequests(tx, []*models.PullRequest{newPR}); err != nil {
+			return false, err
+		}
+		return true, s.autoReviewService.Schedule(tx, repo, newPR)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// GitHub may deliver events out of order and redelivers failed ones later
+	if stalePullRequestUpdate(pr, update) {
+		log.Printf("Ignoring update of %s/%s#%d from %v, pull request was updated at %v", repo.Owner, repo.Name, pr.Number, update.UpdatedAt, *pr.GithubUpdatedAt)
+		return false, nil
+	}
+
+	headMoved := pr.LastCommit != update.LastCommit
+	pr.State = update.State
+	pr.Title = update.Title
+	pr.LastCommit = update.LastCommit
+	if updatedAt := githubUpdatedAt(update); updatedAt != nil {
+		pr.GithubUpdatedAt = updatedAt
+	}
+	if err := s.reviewsRepository.UpdatePullRequest(tx, pr); err != nil {
+		return false, err
+	}
+
+	if pr.State != string(constants.PRStateOpen) {
+		return true, s.autoReviewService.Unschedule(tx, pr.ID)
+	}
+	if headMoved || reopened {
+		return true, s.autoReviewService.Schedule(tx, repo, pr)
+	}
+	return true, nil
+}
+
+// Refresh applies the open pull requests GitHub lists for a repository, and closes the stored pull
+// requests it no longer lists. A repository registered before the GitHub App was installed on it is
+// mapped to the installation first.
+func (s *PullRequestsService) Refresh(ctx context.Context, tx *gorm.DB, userID, repoID uint) error {
+	repo, err := s.reviewsRepository.GetRepository(tx, userID, repoID)
+	if err != nil {
+		return err
+	}
+
+	if repo.InstallationID == nil {
+		installationID, err := s.githubClientService.FindInstallation(ctx, tx, userID, repo.Owner, repo.Name)
+		if err != nil {
+			return err
+		}
+		if installationID != nil {
+			if err := s.reviewsRepository.SetRepositoryInstallation(tx, repo.ID, *installationID); err != nil {
+				return err
+			}
+			repo.InstallationID = installationID
+		}
+	}
+
+	existingPRs, err := s.reviewsRepository.GetPullRequests(tx, userID, repoID)
+	if err != nil {
+		return err
+	}
+
+	githubClient, err := s.githubClientService.ForRepository(ctx, tx, repo)
+	if err != nil {
+		return err
+	}
+
+	openPRs, err := githubClient.ListPullRequests(ctx, repo.Name, repo.Owner)
+	if err != nil {
+		return err
+	}
+
+	open := make(map[uint]bool, len(openPRs))
+	applied := 0
+	for _, openPR := range openPRs {
+		open[openPR.Number] = true
+		ok, err := s.Apply(tx, repo, openPR, false)
+		if err != nil {
+			return err
+		}
+		if ok {
+			applied++
+		}
+	}
+
+	closed := 0
+	for _, existingPR := range existingPRs {
+		if open[existingPR.Number] || existingPR.State == string(constants.PRStateClosed) {
+			continue
+		}
+		// GitHub does not tell when the pull request was closed, so the update carries no time
+		if _, err := s.Apply(tx, repo, &utils.GithubPullRequest{
+			Number:     existingPR.Number,
+			Title:      existingPR.Title,
+			URL:        existingPR.URL,
+			State:      string(constants.PRStateClosed),
+			LastCommit: existingPR.LastCommit,
+		}, false); err != nil {
+			return err
+		}
+		closed++
+	}
+
+	log.Printf("Refreshed %d open and %d closed pull requests of %s/%s", applied, closed, repo.Owner, repo.Name)
+	return nil
+}
+
+// stalePullRequestUpdate reports whether update describes an older version of the pull request than
+// the one stored
+func stalePullRequestUpdate(pr *models.PullRequest, update *utils.GithubPullRequest) bool {
+	return pr.GithubUpdatedAt != nil && !update.UpdatedAt.IsZero() && update.UpdatedAt.Before(*pr.GithubUpdatedAt)
+}
+
+func githubUpdatedAt(pr *utils.GithubPullRequest) *time.Time {
+	if pr.UpdatedAt.IsZero() {
+		return nil
+	}
+	updatedAt := pr.UpdatedAt
+	return &updatedAt
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/responses"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"gorm.io/gorm"
+)
+
+// ErrIllegalTransition is returned when a review cannot move from its current status to the requested one
+var ErrIllegalTransition = errors.New("illegal review status transition")
+
+// reviewTransitions lists the statuses a review may move to from each status. Queued and processing
+// reviews may stay in their status to report progress. Finished reviews can only be queued again by a
+// retry, except available reviews, which are final.
+var reviewTransitions = map[constants.ReviewStatus][]constants.ReviewStatus{
+	constants.StatusQueued:     {constants.StatusQueued, constants.StatusProcessing, constants.StatusAvailable, constants.StatusFailed, constants.StatusCancelled, constants.StatusTimedOut},
+	constants.StatusProcessing: {constants.StatusProcessing, constants.StatusAvailable, constants.StatusFailed, constants.StatusCancelled, constants.StatusTimedOut},
+	constants.StatusFailed:     {constants.StatusQueued},
+	constants.StatusCancelled:  {constants.StatusQueued},
+	constants.StatusTimedOut:   {constants.StatusQueued},
+}
+
+func canTransition(from, to constants.ReviewStatus) bool {
+	for _, status := range reviewTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// finished reports whether the review service is done with a review of the status
+func finished(status constants.ReviewStatus) bool {
+	switch status {
+	case constants.StatusAvailable, constants.StatusFailed, constants.StatusCancelled, constants.StatusTimedOut:
+		return true
+	default:
+		return false
+	}
+}
+
+// transition moves a review to a status and appends the change to its history. The review status should
+// be locked, see GetReviewStatusForUpdate. The message of a failed, cancelled or timed out review is
+// stored as its error.
+func (rs *ReviewsService) transition(tx *gorm.DB, reviewStatus *models.ReviewStatus, status constants.ReviewStatus, progress int, message string, actor constants.ReviewActor, userID *uint) error {
+	if !canTransition(reviewStatus.Status, status) {
+		return fmt.Errorf("%w: review %d is %s and cannot become %s", ErrIllegalTransition, reviewStatus.ReviewID, reviewStatus.Status, status)
+	}
+
+	reason := ""
+	if finished(status) && status != constants.StatusAvailable {
+		reason = message
+	}
+	if err := rs.reviewsRepository.UpdateReviewStatus(tx, reviewStatus.ID, status, progress, reason); err != nil {
+		return err
+	}
+	if err := recordReviewEvents(tx, rs.reviewsRepository, []*models.ReviewEvent{
+		newReviewEvent(reviewStatus.ReviewID, status, progress, message, actor, userID),
+	}); err != nil {
+		return err
+	}
+
+	reviewStatus.Status = status
+	reviewStatus.Progress = progress
+	reviewStatus.Error = reason
+	return nil
+}
+
+// recordReviewEvents appends events to the history of their reviews and publishes them to the clients
+// streaming the reviews once tx commits
+func recordReviewEvents(tx *gorm.DB, reviewsRepository *repositories.ReviewsRepository, events []*models.ReviewEvent) error {
+	if err := reviewsRepository.CreateReviewEvents(tx, events); err != nil {
+		return err
+	}
+
+	eventbus.Collect(tx, events)
+	return nil
+}
+
+func newReviewEvent(reviewID uint, status constants.ReviewStatus, progress int, message string, actor constants.ReviewActor, userID *uint) *models.ReviewEvent {
+	return &models.ReviewEvent{
+		ReviewID: reviewID,
+		Status:   status,
+		Progress: progress,
+		Message:  message,
+		Actor:    actor,
+		UserID:   userID,
+	}
+}
+
+// GetReviewEvents returns the history of a review along with the durations derived from it
+func (rs *ReviewsService) GetReviewEvents(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*responses.GetReviewEventsResponse, error) {
+	if _, err := rs.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID); err != nil {
+		return nil, err
+	}
+
+	events, err := rs.reviewsRepository.GetReviewEvents(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newReviewEventsResponse(events), nil
+}
+
+// newReviewEventsResponse builds the history of a review. Each time a review is queued starts a new
+// attempt. The queue wait and processing time are those of the latest attempt, and the total time runs
+// from the first event to the end of the latest attempt. Phases that have not ended yet are left out.
+func newReviewEventsResponse(events []*models.ReviewEvent) *responses.GetReviewEventsResponse {
+	response := &responses.GetReviewEventsResponse{
+		Events: []*responses.GetReviewEventResponse{},
+	}
+
+	var attemptStart, processingStart *time.Time
+	var previous constants.ReviewStatus
+	for _, event := range events {
+		response.Events = append(response.Events, newReviewEventResponse(event))
+
+		at := event.CreatedAt
+		switch {
+		case event.Status == previous:
+		case event.Status == constants.StatusQueued:
+			response.Attempts++
+			attemptStart, processingStart = &at, nil
+			response.QueueWaitSeconds, response.ProcessingSeconds, response.TotalSeconds = nil, nil, nil
+		case event.Status == constants.StatusProcessing:
+			if attemptStart != nil {
+				response.QueueWaitSeconds = seconds(at.Sub(*attemptStart))
+			}
+			processingStart = &at
+		case finished(event.Status):
+			if previous == constants.StatusQueued && attemptStart != nil {
+				response.QueueWaitSeconds = seconds(at.Sub(*attemptStart))
+			}
+			if processingStart != nil {
+				response.ProcessingSeconds = seconds(at.Sub(*processingStart))
+			}
+			response.TotalSeconds = seconds(at.Sub(events[0].CreatedAt))
+		}
+		previous = event.Status
+	}
+
+	return response
+}
+
+func newReviewEventResponse(event *models.ReviewEvent) *responses.GetReviewEventResponse {
+	return &responses.GetReviewEventResponse{
+		ID:        event.ID,
+		Status:    event.Status,
+		Progress:  event.Progress,
+		Message:   event.Message,
+		Actor:     event.Actor,
+		UserID:    event.UserID,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+func seconds(d time.Duration) *float64 {
+	s := d.Seconds()
+	return &s
+}
+
+// ReviewWatch follows the status changes of a review
+type ReviewWatch struct {
+	// Current is the status of the review when the watch started
+	Current      *responses.GetReviewProgressResponse
+	subscription *eventbus.Subscription
+	events       chan *responses.GetReviewEventResponse
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+// Events returns the changes of the review after the watch started. The first events may repeat the
+// current status. The channel is closed once the review finished, or when the watch is closed or could
+// not keep up, after which clients should fetch the status again.
+func (w *ReviewWatch) Events() <-chan *responses.GetReviewEventResponse {
+	return w.events
+}
+
+// Close stops the watch
+func (w *ReviewWatch) Close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+func (w *ReviewWatch) run() {
+	defer close(w.events)
+	defer w.subscription.Close()
+
+	if finished(w.Current.Status) {
+		return
+	}
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.subscription.Events():
+			if !ok {
+				return
+			}
+			select {
+			case <-w.done:
+				return
+			case w.events <- newReviewEventResponse(event):
+			}
+			if finished(event.Status) {
+				return
+			}
+		}
+	}
+}
+
+// WatchReview starts following the status changes of a review. The subscription starts before the
+// status is read so that no change committed in between is missed. The watch must be closed.
+func (rs *ReviewsService) WatchReview(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*ReviewWatch, error) {
+	if _, err := rs.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID); err != nil {
+		return nil, err
+	}
+
+	subscription := rs.bus.Subscribe(reviewID)
+	reviewStatus, err := rs.reviewsRepository.GetReviewStatus(tx, reviewID)
+	if err != nil {
+		subscription.Close()
+		return nil, err
+	}
+
+	watch := &ReviewWatch{
+		Current: &responses.GetReviewProgressResponse{
+			Status:   reviewStatus.Status,
+			Progress: reviewStatus.Progress,
+			Error:    reviewStatus.Error,
+		},
+		subscription: subscription,
+		events:       make(chan *responses.GetReviewEventResponse),
+		done:         make(chan struct{}),
+	}
+	go watch.run()
+
+	return watch, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+)
+
+func TestReviewTransitions(t *testing.T) {
+	const (
+		queued     = constants.StatusQueued
+		processing = constants.StatusProcessing
+		available  = constants.StatusAvailable
+		failed     = constants.StatusFailed
+		cancelled  = constants.StatusCancelled
+		timedOut   = constants.StatusTimedOut
+	)
+	statuses := []constants.ReviewStatus{queued, processing, available, failed, cancelled, timedOut}
+
+	// allowed lists the legal transitions from each status, every other transition is illegal
+	allowed := map[constants.ReviewStatus][]constants.ReviewStatus{
+		queued:     {queued, processing, available, failed, cancelled, timedOut},
+		processing: {processing, available, failed, cancelled, timedOut},
+		failed:     {queued},
+		cancelled:  {queued},
+		timedOut:   {queued},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			t.Run(string(from)+" to "+string(to), func(t *testing.T) {
+				want := slices.Contains(allowed[from], to)
+				if got := canTransition(from, to); got != want {
+					t.Fatalf("canTransition() = %v, want %v", got, want)
+				}
+
+				db := newTestDB(t)
+				rs := newTestReviewsService()
+				review, reviewStatus := createTestReview(t, db, from)
+				err := rs.transition(db, reviewStatus, to, 100, "because", constants.ActorSystem, nil)
+				if want != (err == nil) || (err != nil && !errors.Is(err, ErrIllegalTransition)) {
+					t.Fatalf("transition() = %v, want legal %v", err, want)
+				}
+
+				var stored models.ReviewStatus
+				if err := db.First(&stored, reviewStatus.ID).Error; err != nil {
+					t.Fatalf("could not read review status: %v", err)
+				}
+				events, err := rs.reviewsRepository.GetReviewEvents(db, review.ID)
+				if err != nil {
+					t.Fatalf("could not read review events: %v", err)
+				}
+				if !want {
+					if stored.Status != from || len(events) != 0 {
+						t.Errorf("illegal transition left the review %s with %d events", stored.Status, len(events))
+					}
+					return
+				}
+				if stored.Status != to || len(events) != 1 || events[0].Status != to {
+					t.Errorf("review is %s with events %+v, want %s with one event", stored.Status, events, to)
+				}
+				if wantErr := finished(to) && to != available; (stored.Error != "") != wantErr {
+					t.Errorf("review error is %q, want an error %v", stored.Error, wantErr)
+				}
+			})
+		}
+	}
+}
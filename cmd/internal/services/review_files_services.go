@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+)
+
+const (
+	// maxPatchBytesLimit is the largest patch size a review may allow
+	maxPatchBytesLimit = 1 << 20
+	// maxContextLinesLimit is the most lines of context around each hunk a review may ask for
+	maxContextLinesLimit = 1000
+	// maxConcurrentContentFetches bounds how many files of a review are fetched at once
+	maxConcurrentContentFetches = 8
+)
+
+// reviewFileFilter decides which files of a pull request are sent for review
+type reviewFileFilter struct {
+	maxFiles      int
+	maxPatchBytes int
+	include       []*utils.Glob
+	exclude       []*utils.Glob
+}
+
+// newReviewFileFilter combines the default limits with the overrides of a review request
+func newReviewFileFilter(cfg *config.ReviewsConfig, req *requests.CreateReviewRequest) (*reviewFileFilter, error) {
+	filter := &reviewFileFilter{
+		maxFiles:      cfg.MaxFiles,
+		maxPatchBytes: cfg.MaxPatchBytes,
+	}
+
+	switch {
+	case req.MaxFiles < 0 || req.MaxFiles > utils.MaxPullRequestFiles:
+		return nil, customerrors.NewValidationError("max_files", fmt.Sprintf("must be between 1 and %d", utils.MaxPullRequestFiles))
+	case req.MaxFiles > 0:
+		filter.maxFiles = req.MaxFiles
+	}
+	switch {
+	case req.MaxPatchBytes < 0 || req.MaxPatchBytes > maxPatchBytesLimit:
+		return nil, customerrors.NewValidationError("max_patch_bytes", fmt.Sprintf("must be between 1 and %d", maxPatchBytesLimit))
+	case req.MaxPatchBytes > 0:
+		filter.maxPatchBytes = req.MaxPatchBytes
+	}
+
+	for i, pattern := range req.Include {
+		glob, err := utils.CompileGlob(pattern)
+		if err != nil {
+			return nil, customerrors.NewValidationError(fmt.Sprintf("include[%d]", i), err.Error())
+		}
+		filter.include = append(filter.include, glob)
+	}
+	for i, pattern := range req.Exclude {
+		glob, err := utils.CompileGlob(pattern)
+		if err != nil {
+			return nil, customerrors.NewValidationError(fmt.Sprintf("exclude[%d]", i), err.Error())
+		}
+		filter.exclude = append(filter.exclude, glob)
+	}
+	for _, pattern := range cfg.Exclude {
+		glob, err := utils.CompileGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q in reviews config: %v", pattern, err)
+		}
+		filter.exclude = append(filter.exclude, glob)
+	}
+
+	return filter, nil
+}
+
+// apply returns the files to review, and the files left out with the reason why
+func (f *reviewFileFilter) apply(files []*utils.GithubPullRequestFileChanges) ([]*utils.GithubPullRequestFileChanges, []*models.SkippedFile) {
+	var kept []*utils.GithubPullRequestFileChanges
+	var skipped []*models.SkippedFile
+
+	for _, file := range files {
+		reason, skip := f.skipReason(file, len(kept))
+		if !skip {
+			kept = append(kept, file)
+			continue
+		}
+		skipped = append(skipped, &models.SkippedFile{
+			Filename:  file.Filename,
+			Reason:    reason,
+			Additions: file.Additions,
+			Deletions: file.Deletions,
+		})
+	}
+
+	return kept, skipped
+}
+
+func (f *reviewFileFilter) skipReason(file *utils.GithubPullRequestFileChanges, keptFiles int) (constants.SkipReason, bool) {
+	included := matchesAny(f.include, file.Filename)
+	if len(f.include) > 0 && !included {
+		return constants.SkipExcluded, true
+	}
+	if matchesAny(f.exclude, file.Filename) {
+		return constants.SkipExcluded, true
+	}
+
+	switch file.Class {
+	case utils.FileClassBinary:
+		return constants.SkipBinary, true
+	case utils.FileClassGenerated:
+		if !included {
+			return constants.SkipGenerated, true
+		}
+	case utils.FileClassVendored:
+		if !included {
+			return constants.SkipVendored, true
+		}
+	}
+
+	if file.Patch == "" {
+		// GitHub omits the diff of binary files and of files with too large a diff
+		if file.Additions+file.Deletions > 0 {
+			return constants.SkipTooLarge, true
+		}
+		return constants.SkipEmptyDiff, true
+	}
+	if f.maxPatchBytes > 0 && len(file.Patch) > f.maxPatchBytes {
+		return constants.SkipTooLarge, true
+	}
+	if f.maxFiles > 0 && keptFiles >= f.maxFiles {
+		return constants.SkipFileLimit, true
+	}
+
+	return "", false
+}
+
+func matchesAny(globs []*utils.Glob, filename string) bool {
+	for _, glob := range globs {
+		if glob.Match(filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewContext decides which file contents are sent along with the diffs of a review
+type reviewContext struct {
+	mode                constants.ReviewContext
+	lines               int
+	maxFileContentBytes int
+	maxContentBytes     int
+}
+
+// newReviewContext combines the default context with the overrides of a review request
+func newReviewContext(cfg *config.ReviewsConfig, req *requests.CreateReviewRequest) (*reviewContext, error) {
+	rc := &reviewContext{
+		mode:                constants.ReviewContext(cfg.Context),
+		lines:               cfg.ContextLines,
+		maxFileContentBytes: cfg.MaxFileContentBytes,
+		maxContentBytes:     cfg.MaxContentBytes,
+	}
+
+	if req.Context != "" {
+		rc.mode = req.Context
+	}
+	switch rc.mode {
+	case "":
+		rc.mode = constants.ContextNone
+	case constants.ContextNone, constants.ContextLines, constants.ContextFull:
+	default:
+		return nil, customerrors.NewValidationError("context", fmt.Sprintf("unknown context %q", rc.mode))
+	}
+
+	switch {
+	case req.ContextLines < 0 || req.ContextLines > maxContextLinesLimit:
+		return nil, customerrors.NewValidationError("context_lines", fmt.Sprintf("must be between 1 and %d", maxContextLinesLimit))
+	case req.ContextLines > 0:
+		rc.lines = req.ContextLines
+	}
+
+	return rc, nil
+}
+
+// fileContents holds the versions of a file fetched from GitHub
+type fileContents struct {
+	head, base       []byte
+	headErr, baseErr error
+}
+
+// fileDiffs attaches the context to the files to review. Head versions are fetched at headSHA and base
+// versions at baseSHA. Files whose content is too large or cannot be fetched are sent without content,
+// except when GitHub rate limits us, since all other files would fail the same way.
+func (rc *reviewContext) fileDiffs(ctx context.Context, githubClient *utils.GithubClient, repo *models.Repository, headSHA, baseSHA string, files []*utils.GithubPullRequestFileChanges) ([]*requests.FileDiff, error) {
+	diffs := make([]*requests.FileDiff, 0, len(files))
+	if rc.mode == constants.ContextNone {
+		for _, file := range files {
+			diffs = append(diffs, &requests.FileDiff{GithubPullRequestFileChanges: file})
+		}
+		return diffs, nil
+	}
+
+	contents := make([]fileContents, len(files))
+	slots := make(chan struct{}, maxConcurrentContentFetches)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file *utils.GithubPullRequestFileChanges) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if file.Status == utils.FileStatusRemoved {
+				contents[i].headErr = utils.ErrFileNotFound
+			} else {
+				contents[i].head, contents[i].headErr = githubClient.GetFileContent(ctx, repo.Name, repo.Owner, file.Filename, headSHA, rc.maxFileContentBytes)
+			}
+			if rc.mode != constants.ContextFull {
+				return
+			}
+
+			baseFilename := file.Filename
+			if file.PreviousFilename != "" {
+				baseFilename = file.PreviousFilename
+			}
+			if file.Status == utils.FileStatusAdded {
+				contents[i].baseErr = utils.ErrFileNotFound
+			} else {
+				contents[i].base, contents[i].baseErr = githubClient.GetFileContent(ctx, repo.Name, repo.Owner, baseFilename, baseSHA, rc.maxFileContentBytes)
+			}
+		}(i, file)
+	}
+	wg.Wait()
+
+	contentBytes := 0
+	for i, file := range files {
+		diff, size, err := rc.fileDiff(file, &contents[i])
+		if err != nil {
+			return nil, err
+		}
+		if diff.ContentOmitted == "" && rc.maxContentBytes > 0 && contentBytes+size > rc.maxContentBytes {
+			diff = &requests.FileDiff{GithubPullRequestFileChanges: file, ContentOmitted: constants.ContentReviewLimit}
+			size = 0
+		}
+		contentBytes += size
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
+
+// fileDiff builds the file diff of a file from its fetched contents, and returns the size of the content
+// it carries
+func (rc *reviewContext) fileDiff(file *utils.GithubPullRequestFileChanges, contents *fileContents) (*requests.FileDiff, int, error) {
+	diff := &requests.FileDiff{GithubPullRequestFileChanges: file}
+
+	for _, err := range []error{contents.headErr, contents.baseErr} {
+		var rateLimitedError *utils.RateLimitedError
+		switch {
+		case err == nil, errors.Is(err, utils.ErrFileNotFound):
+		case errors.As(err, &rateLimitedError), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return nil, 0, fmt.Errorf("could not fetch content of %s: %w", file.Filename, err)
+		case errors.Is(err, utils.ErrFileTooLarge):
+			diff.ContentOmitted = constants.ContentTooLarge
+			return diff, 0, nil
+		default:
+			log.Printf("Could not fetch content of %s: %v", file.Filename, err)
+			diff.ContentOmitted = constants.ContentUnavailable
+			return diff, 0, nil
+		}
+	}
+	if bytes.IndexByte(contents.head, 0) >= 0 || bytes.IndexByte(contents.base, 0) >= 0 {
+		diff.ContentOmitted = constants.ContentBinary
+		return diff, 0, nil
+	}
+
+	if rc.mode == constants.ContextFull {
+		if contents.headErr == nil {
+			head := string(contents.head)
+			diff.HeadContent = &head
+		}
+		if contents.baseErr == nil {
+			base := string(contents.base)
+			diff.BaseContent = &base
+		}
+		return diff, len(contents.head) + len(contents.base), nil
+	}
+
+	if contents.headErr != nil {
+		// a removed file has no head version, and its diff already holds all of its lines
+		return diff, 0, nil
+	}
+	hunks, err := utils.ParseUnifiedDiff(file.Patch)
+	if err != nil {
+		log.Printf("Could not parse diff of %s: %v", file.Filename, err)
+		diff.ContentOmitted = constants.ContentUnavailable
+		return diff, 0, nil
+	}
+	size := 0
+	diff.Excerpts = utils.ContextExcerpts(string(contents.head), hunks, rc.lines)
+	for _, excerpt := range diff.Excerpts {
+		size += len(excerpt.Text)
+	}
+
+	return diff, size, nil
+}
@@ -2,26 +2,53 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/simondanielsson/apPRoved/cmd/config"
 	"github.com/simondanielsson/apPRoved/cmd/constants"
 	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
 	"github.com/simondanielsson/apPRoved/cmd/internal/dto/responses"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
 	"github.com/simondanielsson/apPRoved/cmd/internal/models"
 	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
 	"github.com/simondanielsson/apPRoved/pkg/utils"
-	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrReviewCancelled is returned when the review service sends results for a cancelled review
+	ErrReviewCancelled = errors.New("review was cancelled")
+	// ErrReviewDeleted is returned when the review service sends results for a review that no longer exists
+	ErrReviewDeleted = errors.New("review was deleted")
+	// ErrStaleAttempt is returned when the review service sends results of an attempt at a review that
+	// was abandoned for a retry
+	ErrStaleAttempt = errors.New("review attempt was abandoned")
+)
+
 type ReviewsService struct {
-	reviewsRepository *repositories.ReviewsRepository
+	config                   *config.ReviewsConfig
+	reviewsRepository        *repositories.ReviewsRepository
+	outboxService            *OutboxService
+	githubPublicationService *GithubPublicationService
+	githubClientService      *GithubClientService
+	bus                      eventbus.Bus
 }
 
 // NewReviewsService creates a new reviews service
-func NewReviewsService(reviewsRepository *repositories.ReviewsRepository) *ReviewsService {
-	return &ReviewsService{reviewsRepository: reviewsRepository}
+func NewReviewsService(cfg *config.ReviewsConfig, reviewsRepository *repositories.ReviewsRepository, outboxService *OutboxService, githubPublicationService *GithubPublicationService, githubClientService *GithubClientService, bus eventbus.Bus) *ReviewsService {
+	return &ReviewsService{
+		config:                   cfg,
+		reviewsRepository:        reviewsRepository,
+		outboxService:            outboxService,
+		githubPublicationService: githubPublicationService,
+		githubClientService:      githubClientService,
+		bus:                      bus,
+	}
 }
 
 // GetRepositories returns all repositories for a user
@@ -34,12 +61,13 @@ func (rs *ReviewsService) GetRepositories(tx *gorm.DB, userID uint) ([]*response
 	var reposResponse []*responses.GetRepositoriesResponse
 	for _, repo := range repos {
 		reposResponse = append(reposResponse, &responses.GetRepositoriesResponse{
-			ID:        repo.ID,
-			Name:      repo.Name,
-			Owner:     repo.Owner,
-			URL:       repo.URL,
-			CreatedAt: repo.CreatedAt,
-			UpdatedAt: repo.UpdatedAt,
+			ID:             repo.ID,
+			Name:           repo.Name,
+			Owner:          repo.Owner,
+			URL:            repo.URL,
+			InstallationID: repo.InstallationID,
+			CreatedAt:      repo.CreatedAt,
+			UpdatedAt:      repo.UpdatedAt,
 		})
 	}
 
@@ -47,19 +75,25 @@ func (rs *ReviewsService) GetRepositories(tx *gorm.DB, userID uint) ([]*response
 }
 
 // RegisterRepository registers a new repository and its pull requests
-func (rs *ReviewsService) RegisterRepository(ctx context.Context, tx *gorm.DB, githubClient utils.GithubClient, userID uint, name, owner, url string) (*responses.GetRepositoriesResponse, error) {
+func (rs *ReviewsService) RegisterRepository(ctx context.Context, tx *gorm.DB, userID uint, name, owner, url string) (*responses.GetRepositoriesResponse, error) {
+	installationID, err := rs.githubClientService.FindInstallation(ctx, tx, userID, owner, name)
+	if err != nil {
+		return nil, err
+	}
+
 	repo := &models.Repository{
-		UserID: userID,
-		Name:   name,
-		Owner:  owner,
-		URL:    url,
+		UserID:         userID,
+		Name:           name,
+		Owner:          owner,
+		URL:            url,
+		InstallationID: installationID,
 	}
-	repo, err := rs.reviewsRepository.CreateRepository(tx, repo)
+	repo, err = rs.reviewsRepository.CreateRepository(tx, repo)
 	if err != nil {
 		return nil, err
 	}
 
-	prs, err := rs.findPullRequests(ctx, githubClient, repo, userID)
+	prs, err := rs.findPullRequests(ctx, tx, repo)
 	if err != nil {
 		return nil, err
 	}
@@ -69,105 +103,90 @@ func (rs *ReviewsService) RegisterRepository(ctx context.Context, tx *gorm.DB, g
 	}
 
 	response := &responses.GetRepositoriesResponse{
-		ID:        repo.ID,
-		Name:      repo.Name,
-		Owner:     repo.Owner,
-		URL:       repo.URL,
-		CreatedAt: repo.CreatedAt,
-		UpdatedAt: repo.UpdatedAt,
+		ID:             repo.ID,
+		Name:           repo.Name,
+		Owner:          repo.Owner,
+		URL:            repo.URL,
+		InstallationID: repo.InstallationID,
+		CreatedAt:      repo.CreatedAt,
+		UpdatedAt:      repo.UpdatedAt,
 	}
 	return response, nil
 }
 
-func (rs *ReviewsService) GetRepository(tx *gorm.DB, repoID uint) (*responses.GetRepositoriesResponse, error) {
-	repo, err := rs.reviewsRepository.GetRepository(tx, repoID)
+// GetRepository returns a repository registered by the user
+func (rs *ReviewsService) GetRepository(tx *gorm.DB, userID, repoID uint) (*responses.GetRepositoriesResponse, error) {
+	repo, err := rs.reviewsRepository.GetRepository(tx, userID, repoID)
 	if err != nil {
 		return nil, err
 	}
 
 	response := &responses.GetRepositoriesResponse{
-		ID:        repo.ID,
-		Name:      repo.Name,
-		Owner:     repo.Owner,
-		URL:       repo.URL,
-		CreatedAt: repo.CreatedAt,
-		UpdatedAt: repo.UpdatedAt,
+		ID:             repo.ID,
+		Name:           repo.Name,
+		Owner:          repo.Owner,
+		URL:            repo.URL,
+		InstallationID: repo.InstallationID,
+		CreatedAt:      repo.CreatedAt,
+		UpdatedAt:      repo.UpdatedAt,
 	}
 
 	return response, nil
 }
 
-func (rs *ReviewsService) RefreshPullRequests(ctx context.Context, tx *gorm.DB, githubClient utils.GithubClient, userID, repoID uint) error {
-	repository, err := rs.reviewsRepository.GetRepository(tx, repoID)
+// GetRepositorySettings returns the auto review and publishing settings of a repository registered by the user
+func (rs *ReviewsService) GetRepositorySettings(tx *gorm.DB, userID, repoID uint) (*responses.GetRepositorySettingsResponse, error) {
+	repo, err := rs.reviewsRepository.GetRepository(tx, userID, repoID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	existingPRs, err := rs.reviewsRepository.GetPullRequests(tx, userID, repoID)
-	if err != nil {
-		return err
-	}
+	return &responses.GetRepositorySettingsResponse{
+		AutoReview:                repo.AutoReview,
+		AutoReviewDebounceSeconds: repo.AutoReviewDebounceSeconds,
+		PublishToGithub:           repo.PublishToGithub,
+	}, nil
+}
 
-	currentOpenPRs, err := githubClient.ListPullRequests(ctx, repository.Name, repository.Owner, userID)
+// UpdateRepositorySettings updates the auto review and publishing settings of a repository registered by the user.
+// Settings missing from the request are left unchanged.
+func (rs *ReviewsService) UpdateRepositorySettings(tx *gorm.DB, userID, repoID uint, req *requests.UpdateRepositorySettingsRequest) (*responses.GetRepositorySettingsResponse, error) {
+	repo, err := rs.reviewsRepository.GetRepository(tx, userID, repoID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// find all new open PRs that were added since last refresh
-	var newPRs []*models.PullRequest
-	for _, pr := range currentOpenPRs {
-		found := false
-		for _, existingPR := range existingPRs {
-			if pr.Number == existingPR.Number {
-				found = true
-				break
-			}
-		}
-		if !found {
-			newPRs = append(newPRs, &models.PullRequest{
-				RepositoryID: repoID,
-				Number:       pr.Number,
-				Title:        pr.Title,
-				URL:          pr.URL,
-				State:        pr.State,
-				LastCommit:   pr.LastCommit,
-			})
-		}
+	if req.AutoReview != nil {
+		repo.AutoReview = *req.AutoReview
 	}
-	log.Printf("Found %d new PRs\n", len(newPRs))
-
-	// find PRs that are no longer open
-	var closedPRs []*models.PullRequest
-	for _, existingPR := range existingPRs {
-		if existingPR.State == string(constants.PRStateClosed) {
-			continue
-		}
-		found := false
-		for _, pr := range currentOpenPRs {
-			if pr.Number == existingPR.Number {
-				found = true
-				break
-			}
-		}
-		if !found {
-			existingPR.State = string(constants.PRStateClosed)
-			closedPRs = append(closedPRs, existingPR)
+	if req.AutoReviewDebounceSeconds != nil {
+		if *req.AutoReviewDebounceSeconds < 0 {
+			return nil, customerrors.NewValidationError("auto_review_debounce_seconds", "must not be negative")
 		}
+		repo.AutoReviewDebounceSeconds = *req.AutoReviewDebounceSeconds
 	}
-	log.Printf("Found %d now closed PRs\n", len(closedPRs))
-
-	if err := rs.reviewsRepository.CreatePullRequests(tx, newPRs); err != nil {
-		return err
+	if req.PublishToGithub != nil {
+		repo.PublishToGithub = *req.PublishToGithub
 	}
-	if err := rs.reviewsRepository.UpdatePullRequestStatuses(tx, closedPRs); err != nil {
-		return err
+
+	if err := rs.reviewsRepository.UpdateRepositorySettings(tx, repo); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &responses.GetRepositorySettingsResponse{
+		AutoReview:                repo.AutoReview,
+		AutoReviewDebounceSeconds: repo.AutoReviewDebounceSeconds,
+		PublishToGithub:           repo.PublishToGithub,
+	}, nil
 }
 
-func (rs *ReviewsService) findPullRequests(ctx context.Context, githubClient utils.GithubClient, repo *models.Repository, userID uint) ([]*models.PullRequest, error) {
-	fetched_prs, err := githubClient.ListPullRequests(ctx, repo.Name, repo.Owner, userID)
+func (rs *ReviewsService) findPullRequests(ctx context.Context, tx *gorm.DB, repo *models.Repository) ([]*models.PullRequest, error) {
+	githubClient, err := rs.githubClientService.ForRepository(ctx, tx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched_prs, err := githubClient.ListPullRequests(ctx, repo.Name, repo.Owner)
 	if err != nil {
 		return nil, err
 	}
@@ -175,12 +194,13 @@ func (rs *ReviewsService) findPullRequests(ctx context.Context, githubClient uti
 	var prs []*models.PullRequest
 	for _, pr := range fetched_prs {
 		prs = append(prs, &models.PullRequest{
-			RepositoryID: repo.ID,
-			Number:       pr.Number,
-			Title:        pr.Title,
-			URL:          pr.URL,
-			State:        pr.State,
-			LastCommit:   pr.LastCommit,
+			RepositoryID:    repo.ID,
+			Number:          pr.Number,
+			Title:           pr.Title,
+			URL:             pr.URL,
+			State:           pr.State,
+			LastCommit:      pr.LastCommit,
+			GithubUpdatedAt: githubUpdatedAt(pr),
 		})
 	}
 
@@ -189,6 +209,10 @@ func (rs *ReviewsService) findPullRequests(ctx context.Context, githubClient uti
 
 // GetPullRequests returns all pull requests for a repository
 func (rs *ReviewsService) GetPullRequests(tx *gorm.DB, userID, repoID uint) ([]*responses.GetPullRequestResponse, error) {
+	if _, err := rs.reviewsRepository.GetRepository(tx, userID, repoID); err != nil {
+		return nil, err
+	}
+
 	prs, err := rs.reviewsRepository.GetPullRequests(tx, userID, repoID)
 	if err != nil {
 		return nil, err
@@ -211,8 +235,8 @@ func (rs *ReviewsService) GetPullRequests(tx *gorm.DB, userID, repoID uint) ([]*
 }
 
 // GetPullRequest returns a pull request
-func (rs *ReviewsService) GetPullRequest(tx *gorm.DB, repoID, prID uint) (*responses.GetPullRequestResponse, error) {
-	pr, err := rs.reviewsRepository.GetPullRequest(tx, prID)
+func (rs *ReviewsService) GetPullRequest(tx *gorm.DB, userID, repoID, prID uint) (*responses.GetPullRequestResponse, error) {
+	pr, err := rs.reviewsRepository.GetPullRequest(tx, userID, repoID, prID)
 	if err != nil {
 		return nil, err
 	}
@@ -230,8 +254,13 @@ func (rs *ReviewsService) GetPullRequest(tx *gorm.DB, repoID, prID uint) (*respo
 }
 
 // GetReviews returns all reviews for a pull request
-func (rs *ReviewsService) GetReviews(tx *gorm.DB, repoID, prID uint) ([]*responses.GetReviewsResponse, error) {
-	reviews, err := rs.reviewsRepository.GetReviews(tx, repoID, prID)
+func (rs *ReviewsService) GetReviews(tx *gorm.DB, userID, repoID, prID uint) ([]*responses.GetReviewsResponse, error) {
+	pr, err := rs.reviewsRepository.GetPullRequest(tx, userID, repoID, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews, err := rs.reviewsRepository.GetReviews(tx, userID, repoID, prID)
 	if err != nil {
 		return nil, err
 	}
@@ -255,22 +284,20 @@ func (rs *ReviewsService) GetReviews(tx *gorm.DB, repoID, prID uint) ([]*respons
 		if !ok {
 			return nil, err
 		}
-		reviewResponse = append(reviewResponse, &responses.GetReviewsResponse{
-			ID:        review.ID,
-			Title:     review.Name,
-			Status:    reviewStatus.Status,
-			Progress:  reviewStatus.Progress,
-			CreatedAt: review.CreatedAt,
-			UpdatedAt: review.UpdatedAt,
-		})
+		reviewResponse = append(reviewResponse, newReviewResponse(review, &reviewStatus, pr))
 	}
 
 	return reviewResponse, nil
 }
 
 // GEtReview returns a review
-func (rs *ReviewsService) GetReview(tx *gorm.DB, repoID, prID, reviewID uint) (*responses.GetReviewsResponse, error) {
-	review, err := rs.reviewsRepository.GetReview(tx, repoID, prID, reviewID)
+func (rs *ReviewsService) GetReview(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*responses.GetReviewsResponse, error) {
+	pr, err := rs.reviewsRepository.GetPullRequest(tx, userID, repoID, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := rs.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID)
 	if err != nil {
 		return nil, err
 	}
@@ -280,141 +307,707 @@ func (rs *ReviewsService) GetReview(tx *gorm.DB, repoID, prID, reviewID uint) (*
 		return nil, err
 	}
 
-	response := &responses.GetReviewsResponse{
-		ID:        review.ID,
-		Title:     review.Name,
-		Status:    reviewStatus.Status,
-		Progress:  reviewStatus.Progress,
-		CreatedAt: review.CreatedAt,
-		UpdatedAt: review.UpdatedAt,
+	return newReviewResponse(review, reviewStatus, pr), nil
+}
+
+// newReviewResponse builds the response for a review. A review is outdated once the pull request
+// has moved on from the commit that was reviewed.
+func newReviewResponse(review *models.Review, reviewStatus *models.ReviewStatus, pr *models.PullRequest) *responses.GetReviewsResponse {
+	return &responses.GetReviewsResponse{
+		ID:           review.ID,
+		Title:        review.Name,
+		Status:       reviewStatus.Status,
+		Progress:     reviewStatus.Progress,
+		Error:        reviewStatus.Error,
+		HeadSHA:      review.HeadSHA,
+		BaseSHA:      review.BaseSHA,
+		Mode:         review.Mode,
+		SinceSHA:     review.SinceSHA,
+		Outdated:     review.HeadSHA != "" && review.HeadSHA != pr.LastCommit,
+		PublishedAt:  review.PublishedAt,
+		SkippedFiles: skippedFileCounts(review.SkippedFiles),
+		CreatedAt:    review.CreatedAt,
+		UpdatedAt:    review.UpdatedAt,
 	}
+}
 
-	return response, nil
+// skippedFileCounts counts the skipped files of a review by reason
+func skippedFileCounts(skippedFiles []models.SkippedFile) map[constants.SkipReason]int {
+	if len(skippedFiles) == 0 {
+		return nil
+	}
+
+	counts := make(map[constants.SkipReason]int)
+	for _, skippedFile := range skippedFiles {
+		counts[skippedFile.Reason]++
+	}
+	return counts
 }
 
 // GetFileReviews returns files for a review
-func (rs *ReviewsService) GetFileReviews(tx *gorm.DB, reviewID uint) (*responses.GetReviewResponse, error) {
-	review, err := rs.reviewsRepository.GetFileReviews(tx, reviewID)
+func (rs *ReviewsService) GetFileReviews(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*responses.GetReviewResponse, error) {
+	review, err := rs.reviewsRepository.GetFileReviews(tx, userID, repoID, prID, reviewID)
 	if err != nil {
 		return nil, err
 	}
 	response := &responses.GetReviewResponse{
-		ID:          review.ID,
-		FileReviews: []*responses.GetFileReviewResponse{},
-		CreatedAt:   review.CreatedAt,
-		UpdatedAt:   review.UpdatedAt,
+		ID:           review.ID,
+		FileReviews:  []*responses.GetFileReviewResponse{},
+		SkippedFiles: []*responses.GetSkippedFileResponse{},
+		CreatedAt:    review.CreatedAt,
+		UpdatedAt:    review.UpdatedAt,
 	}
 	for _, fr := range review.FileReviews {
 		fileReviewResponse := &responses.GetFileReviewResponse{
-			ID:        fr.ID,
-			Filename:  fr.Filename,
-			Content:   fr.Content,
-			Patch:     fr.Patch,
-			CreatedAt: fr.CreatedAt,
-			UpdatedAt: fr.UpdatedAt,
+			ID:               fr.ID,
+			Filename:         fr.Filename,
+			PreviousFilename: fr.PreviousFilename,
+			Status:           fr.Status,
+			SHA:              fr.SHA,
+			RawURL:           fr.RawURL,
+			Language:         fr.Language,
+			Class:            fr.Class,
+			Content:          fr.Content,
+			Patch:            fr.Patch,
+			Comments:         []*responses.GetReviewCommentResponse{},
+			CreatedAt:        fr.CreatedAt,
+			UpdatedAt:        fr.UpdatedAt,
+		}
+		for _, comment := range fr.Comments {
+			fileReviewResponse.Comments = append(fileReviewResponse.Comments, &responses.GetReviewCommentResponse{
+				ID:         comment.ID,
+				Side:       comment.Side,
+				StartLine:  comment.StartLine,
+				EndLine:    comment.EndLine,
+				Severity:   comment.Severity,
+				Category:   comment.Category,
+				Body:       comment.Body,
+				Suggestion: comment.Suggestion,
+			})
 		}
 		response.FileReviews = append(response.FileReviews, fileReviewResponse)
 	}
+	for _, skippedFile := range review.SkippedFiles {
+		response.SkippedFiles = append(response.SkippedFiles, &responses.GetSkippedFileResponse{
+			Filename:  skippedFile.Filename,
+			Reason:    skippedFile.Reason,
+			Additions: skippedFile.Additions,
+			Deletions: skippedFile.Deletions,
+		})
+	}
 
 	return response, nil
 }
 
-func (rs *ReviewsService) CreateReview(tx *gorm.DB, ctx context.Context, queue mq.MessageQueue, githubClient utils.GithubClient, repoID, prID uint, name string, userID uint) (*responses.GetReviewsResponse, error) {
-	repo, err := rs.reviewsRepository.GetRepository(tx, repoID)
+// CreateReview creates a review for a pull request and stores the file diffs to review in the
+// outbox, so that they are only published to the review service if the review is committed.
+// Incremental reviews only cover the changes since the last completed review, and fall back to a
+// full review when there is no such review or the pull request history was rewritten. Files left out
+// by the file limits and rules are recorded on the review; if no file is left, the review is available
+// right away without going to the review service. On request, the file contents around the
+// diffs are fetched at the reviewed commits and sent along.
+func (rs *ReviewsService) CreateReview(tx *gorm.DB, ctx context.Context, repoID, prID uint, req *requests.CreateReviewRequest, userID uint) (*responses.GetReviewsResponse, error) {
+	return rs.createReview(tx, ctx, repoID, prID, req, userID, constants.ActorUser, "")
+}
+
+// createReview creates a review of the user on behalf of actor, which is recorded in the review history.
+// If headSHA is set, the review fails with utils.ErrPullRequestHeadMoved unless it is still the head of
+// the pull request.
+func (rs *ReviewsService) createReview(tx *gorm.DB, ctx context.Context, repoID, prID uint, req *requests.CreateReviewRequest, userID uint, actor constants.ReviewActor, headSHA string) (*responses.GetReviewsResponse, error) {
+	mode := req.Mode
+	switch mode {
+	case "":
+		mode = constants.ReviewModeFull
+	case constants.ReviewModeFull, constants.ReviewModeIncremental:
+	default:
+		return nil, customerrors.NewValidationError("mode", fmt.Sprintf("unknown review mode %q", mode))
+	}
+
+	filter, err := newReviewFileFilter(rs.config, req)
+	if err != nil {
+		return nil, err
+	}
+	reviewContext, err := newReviewContext(rs.config, req)
 	if err != nil {
 		return nil, err
 	}
 
-	pr, err := rs.reviewsRepository.GetPullRequest(tx, prID)
+	repo, err := rs.reviewsRepository.GetRepository(tx, userID, repoID)
 	if err != nil {
-		return nil, nil
+		return nil, err
+	}
+
+	pr, err := rs.reviewsRepository.GetPullRequest(tx, userID, repoID, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	githubClient, err := rs.githubClientService.ForRepository(ctx, tx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := githubClient.GetPullRequestRefs(ctx, repo.Name, repo.Owner, pr.Number)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch pull request head: %w", err)
+	}
+	if headSHA != "" && refs.HeadSHA != headSHA {
+		return nil, fmt.Errorf("%w: expected %s, found %s", utils.ErrPullRequestHeadMoved, shortSHA(headSHA), shortSHA(refs.HeadSHA))
+	}
+	if pr.LastCommit != refs.HeadSHA {
+		pr.LastCommit = refs.HeadSHA
+		if err := rs.reviewsRepository.UpdatePullRequest(tx, pr); err != nil {
+			return nil, err
+		}
 	}
 
 	review := &models.Review{
-		Name:          name,
+		Name:          req.Name,
 		PullRequestID: pr.ID,
+		HeadSHA:       refs.HeadSHA,
+		BaseSHA:       refs.BaseSHA,
+		Mode:          string(constants.ReviewModeFull),
+		Context:       string(reviewContext.mode),
+		ContextLines:  reviewContext.lines,
+	}
+
+	var fileDiffs, omittedFileDiffs []*utils.GithubPullRequestFileChanges
+	if mode == constants.ReviewModeIncremental {
+		fileDiffs, omittedFileDiffs, err = rs.incrementalFileDiffs(tx, ctx, githubClient, repo, pr, review)
+		if err != nil {
+			return nil, err
+		}
 	}
+	if review.Mode == string(constants.ReviewModeFull) {
+		fileDiffs, err = githubClient.FetchFileDiffs(ctx, repo.Name, repo.Owner, pr.Number, review.HeadSHA)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch file diffs: %w", err)
+		}
+	}
+
+	// the diff of a pull request starts at the merge base, which is behind the base commit once the base
+	// branch moves on, so the merge base is what the review is based on
+	review.BaseSHA, err = githubClient.GetMergeBase(ctx, repo.Name, repo.Owner, refs.BaseSHA, review.HeadSHA)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch merge base: %w", err)
+	}
+
 	review, err = rs.reviewsRepository.CreateReview(tx, review)
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
 	reviewStatus := &models.ReviewStatus{
 		ReviewID: review.ID,
 		Status:   constants.StatusQueued,
+		Attempt:  1,
 	}
 	if err := rs.reviewsRepository.CreateReviewStatus(tx, reviewStatus); err != nil {
 		return nil, err
 	}
+	var eventUserID *uint
+	if actor == constants.ActorUser {
+		eventUserID = &userID
+	}
+	if err := recordReviewEvents(tx, rs.reviewsRepository, []*models.ReviewEvent{
+		newReviewEvent(review.ID, constants.StatusQueued, 0, "review created", actor, eventUserID),
+	}); err != nil {
+		return nil, err
+	}
 
-	// fetch file diffs for the PR from github using github client
-	// send info over RabbitMQ to call external review service api to retrieve file reviews
-	go func() {
-		fileDiffs, err := githubClient.FetchFileDiffs(ctx, repo.Name, repo.Owner, pr.Number, userID)
-		if err != nil {
-			log.Println("Error fetching file diffs:", err)
-			return
+	fileDiffs, skippedFiles := filter.apply(fileDiffs)
+	for _, file := range omittedFileDiffs {
+		skippedFiles = append(skippedFiles, &models.SkippedFile{
+			Filename:  file.Filename,
+			Reason:    constants.SkipGithubLimit,
+			Additions: file.Additions,
+			Deletions: file.Deletions,
+		})
+	}
+	for _, skippedFile := range skippedFiles {
+		skippedFile.ReviewID = review.ID
+		review.SkippedFiles = append(review.SkippedFiles, *skippedFile)
+	}
+	if err := rs.reviewsRepository.CreateSkippedFiles(tx, skippedFiles); err != nil {
+		return nil, err
+	}
+
+	if len(fileDiffs) == 0 {
+		message := fmt.Sprintf("nothing to review, all %d changed files were skipped", len(skippedFiles))
+		if err := rs.transition(tx, reviewStatus, constants.StatusAvailable, 100, message, actor, eventUserID); err != nil {
+			return nil, err
 		}
+		return newReviewResponse(review, reviewStatus, pr), nil
+	}
+
+	reviewFileDiffs := make([]*models.ReviewFileDiff, 0, len(fileDiffs))
+	for _, file := range fileDiffs {
+		reviewFileDiffs = append(reviewFileDiffs, newReviewFileDiff(review.ID, file))
+	}
+	if err := rs.reviewsRepository.CreateReviewFileDiffs(tx, reviewFileDiffs); err != nil {
+		return nil, err
+	}
+
+	if err := rs.sendFileDiffs(tx, ctx, githubClient, repo, review, reviewStatus, reviewContext, fileDiffs); err != nil {
+		return nil, err
+	}
 
-		message := requests.FileDiffReviewRequest{
-			FileDiffs:      fileDiffs,
-			ReviewID:       review.ID,
-			ReviewStatusID: reviewStatus.ID,
+	return newReviewResponse(review, reviewStatus, pr), nil
+}
+
+// sendFileDiffs fetches the context of the file diffs of a review and stores the message for the review
+// service in the outbox, for the current attempt of the review
+func (rs *ReviewsService) sendFileDiffs(tx *gorm.DB, ctx context.Context, githubClient *utils.GithubClient, repo *models.Repository, review *models.Review, reviewStatus *models.ReviewStatus, reviewContext *reviewContext, fileDiffs []*utils.GithubPullRequestFileChanges) error {
+	// the diff of an incremental review starts at the reviewed commit, the diff of a pull request at the
+	// merge base
+	contentBaseSHA := review.SinceSHA
+	if review.Mode == string(constants.ReviewModeFull) {
+		contentBaseSHA = review.BaseSHA
+	}
+	messageFileDiffs, err := reviewContext.fileDiffs(ctx, githubClient, repo, review.HeadSHA, contentBaseSHA, fileDiffs)
+	if err != nil {
+		return err
+	}
+
+	message := requests.FileDiffReviewRequest{
+		FileDiffs:      messageFileDiffs,
+		ReviewID:       review.ID,
+		ReviewStatusID: reviewStatus.ID,
+		Attempt:        reviewStatus.Attempt,
+		HeadSHA:        review.HeadSHA,
+		BaseSHA:        review.BaseSHA,
+		Mode:           constants.ReviewMode(review.Mode),
+		SinceSHA:       review.SinceSHA,
+		Context:        reviewContext.mode,
+	}
+	return rs.outboxService.Enqueue(tx, config.QueueFileDiffs, review.ID, &message)
+}
+
+// newReviewFileDiff records a file diff sent for a review
+func newReviewFileDiff(reviewID uint, file *utils.GithubPullRequestFileChanges) *models.ReviewFileDiff {
+	return &models.ReviewFileDiff{
+		ReviewID:         reviewID,
+		Filename:         file.Filename,
+		PreviousFilename: file.PreviousFilename,
+		Status:           file.Status,
+		SHA:              file.SHA,
+		RawURL:           file.RawURL,
+		Language:         file.Language,
+		Class:            string(file.Class),
+		Patch:            file.Patch,
+		Additions:        file.Additions,
+		Deletions:        file.Deletions,
+		Changes:          file.Changes,
+	}
+}
+
+// newGithubFileChanges turns a recorded file diff back into the file changes it was sent as
+func newGithubFileChanges(fileDiff *models.ReviewFileDiff) *utils.GithubPullRequestFileChanges {
+	return &utils.GithubPullRequestFileChanges{
+		Filename:         fileDiff.Filename,
+		PreviousFilename: fileDiff.PreviousFilename,
+		Status:           fileDiff.Status,
+		SHA:              fileDiff.SHA,
+		RawURL:           fileDiff.RawURL,
+		Language:         fileDiff.Language,
+		Class:            utils.FileClass(fileDiff.Class),
+		Patch:            fileDiff.Patch,
+		Additions:        fileDiff.Additions,
+		Deletions:        fileDiff.Deletions,
+		Changes:          fileDiff.Changes,
+	}
+}
+
+// incrementalFileDiffs returns the files changed since the last completed review of the pull request and
+// switches the review to incremental mode. GitHub lists at most utils.MaxComparisonFiles files of a
+// comparison, so when it leaves files out, the other files of the pull request are returned as omitted,
+// since they may have changed as well. It returns no diffs and leaves the review in full mode when an
+// incremental review is not possible.
+func (rs *ReviewsService) incrementalFileDiffs(tx *gorm.DB, ctx context.Context, githubClient *utils.GithubClient, repo *models.Repository, pr *models.PullRequest, review *models.Review) ([]*utils.GithubPullRequestFileChanges, []*utils.GithubPullRequestFileChanges, error) {
+	lastReview, err := rs.reviewsRepository.GetLatestCompletedReview(tx, pr.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("No completed review of PR %d to compare with, falling back to a full review", pr.ID)
+			return nil, nil, nil
 		}
-		if err := queue.Publish(ctx, config.QueueFileDiffs, &message); err != nil {
-			log.Println("Error publishing to message queue:", err)
-			return
+		return nil, nil, err
+	}
+
+	comparison, err := githubClient.CompareFileDiffs(ctx, repo.Name, repo.Owner, lastReview.HeadSHA, review.HeadSHA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not compare commits: %w", err)
+	}
+
+	switch comparison.Status {
+	case "identical":
+		return nil, nil, customerrors.NewValidationError("mode", fmt.Sprintf("no new commits since review %d", lastReview.ID))
+	case "ahead":
+	default:
+		// the reviewed commit is no longer part of the pull request history, e.g. after a force push
+		log.Printf("Head of PR %d is %s of reviewed commit %s, falling back to a full review", pr.ID, comparison.Status, lastReview.HeadSHA)
+		return nil, nil, nil
+	}
+
+	review.Mode = string(constants.ReviewModeIncremental)
+	review.SinceSHA = lastReview.HeadSHA
+	if !comparison.Truncated {
+		return comparison.Files, nil, nil
+	}
+
+	pullRequestFileDiffs, err := githubClient.FetchFileDiffs(ctx, repo.Name, repo.Owner, pr.Number, review.HeadSHA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not fetch file diffs: %w", err)
+	}
+	compared := make(map[string]bool, len(comparison.Files))
+	for _, file := range comparison.Files {
+		compared[file.Filename] = true
+	}
+	var omitted []*utils.GithubPullRequestFileChanges
+	for _, file := range pullRequestFileDiffs {
+		if !compared[file.Filename] {
+			omitted = append(omitted, file)
 		}
-	}()
+	}
+	return comparison.Files, omitted, nil
+}
 
-	response := &responses.GetReviewsResponse{
-		ID:        review.ID,
-		Title:     review.Name,
-		Status:    reviewStatus.Status,
-		Progress:  reviewStatus.Progress,
-		CreatedAt: review.CreatedAt,
-		UpdatedAt: review.UpdatedAt,
+// RetryReview sends a failed, cancelled or timed out review to the review service again. The review is
+// retried with the same file diffs and context, at the commit it was created for, as a new attempt so
+// that late results of the abandoned attempt are rejected.
+func (rs *ReviewsService) RetryReview(tx *gorm.DB, ctx context.Context, userID, repoID, prID, reviewID uint) (*responses.GetReviewsResponse, error) {
+	repo, err := rs.reviewsRepository.GetRepository(tx, userID, repoID)
+	if err != nil {
+		return nil, err
 	}
 
-	return response, nil
+	pr, err := rs.reviewsRepository.GetPullRequest(tx, userID, repoID, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := rs.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewStatus, err := rs.lockReviewStatus(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.transition(tx, reviewStatus, constants.StatusQueued, 0, "retried by the user", constants.ActorUser, &userID); err != nil {
+		return nil, err
+	}
+
+	if err := rs.reviewsRepository.StartReviewAttempt(tx, reviewStatus.ID); err != nil {
+		return nil, err
+	}
+	reviewStatus.Attempt++
+
+	reviewContext, err := newReviewContext(rs.config, &requests.CreateReviewRequest{
+		Context:      constants.ReviewContext(review.Context),
+		ContextLines: review.ContextLines,
+	})
+	if err != nil {
+		return nil, err
+	}
+	reviewFileDiffs, err := rs.reviewsRepository.GetReviewFileDiffs(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	fileDiffs := make([]*utils.GithubPullRequestFileChanges, 0, len(reviewFileDiffs))
+	for _, fileDiff := range reviewFileDiffs {
+		fileDiffs = append(fileDiffs, newGithubFileChanges(fileDiff))
+	}
+
+	githubClient, err := rs.githubClientService.ForRepository(ctx, tx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.sendFileDiffs(tx, ctx, githubClient, repo, review, reviewStatus, reviewContext, fileDiffs); err != nil {
+		return nil, err
+	}
+
+	return newReviewResponse(review, reviewStatus, pr), nil
+}
+
+// TimeOutStuckReviews marks reviews that stayed queued for longer than the queued timeout, or made no
+// progress for longer than the processing timeout, as timed out. It returns how many reviews timed out.
+func (rs *ReviewsService) TimeOutStuckReviews(tx *gorm.DB) (int64, error) {
+	now := time.Now()
+
+	queued, err := rs.reviewsRepository.TimeOutReviewStatuses(tx, constants.StatusQueued, now.Add(-rs.config.QueuedTimeout), fmt.Sprintf("not picked up by the review service within %v", rs.config.QueuedTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	processing, err := rs.reviewsRepository.TimeOutReviewStatuses(tx, constants.StatusProcessing, now.Add(-rs.config.ProcessingTimeout), fmt.Sprintf("no progress from the review service within %v", rs.config.ProcessingTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	var events []*models.ReviewEvent
+	for _, reviewStatus := range append(queued, processing...) {
+		events = append(events, newReviewEvent(reviewStatus.ReviewID, reviewStatus.Status, reviewStatus.Progress, reviewStatus.Error, constants.ActorSystem, nil))
+	}
+	if err := recordReviewEvents(tx, rs.reviewsRepository, events); err != nil {
+		return 0, err
+	}
+
+	return int64(len(events)), nil
 }
 
-func (rs *ReviewsService) DeleteReview(tx *gorm.DB, repoID, prID, reviewID uint) error {
-	if err := rs.reviewsRepository.DeleteReview(tx, reviewID); err != nil {
+// CancelReview stops a review the review service has not completed yet
+func (rs *ReviewsService) CancelReview(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*responses.GetReviewsResponse, error) {
+	pr, err := rs.reviewsRepository.GetPullRequest(tx, userID, repoID, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := rs.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewStatus, err := rs.lockReviewStatus(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := "cancelled by the user"
+	if err := rs.transition(tx, reviewStatus, constants.StatusCancelled, reviewStatus.Progress, reason, constants.ActorUser, &userID); err != nil {
+		return nil, err
+	}
+	if err := rs.stopReviewService(tx, reviewStatus, reason); err != nil {
+		return nil, err
+	}
+
+	return newReviewResponse(review, reviewStatus, pr), nil
+}
+
+// DeleteReview deletes a review. The review service is told to stop working on it if it is in flight.
+func (rs *ReviewsService) DeleteReview(tx *gorm.DB, userID, repoID, prID, reviewID uint) error {
+	if _, err := rs.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID); err != nil {
+		return err
+	}
+
+	reviewStatus, err := rs.lockReviewStatus(tx, reviewID)
+	if err != nil {
+		return err
+	}
+	if inFlight(reviewStatus.Status) {
+		if err := rs.stopReviewService(tx, reviewStatus, "review deleted"); err != nil {
+			return err
+		}
+	}
+
+	if err := rs.reviewsRepository.DeleteReview(tx, userID, repoID, prID, reviewID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// stopReviewService drops the file diffs of a review that were not sent to the review service yet, and
+// tells the review service to stop working on the review
+func (rs *ReviewsService) stopReviewService(tx *gorm.DB, reviewStatus *models.ReviewStatus, reason string) error {
+	if err := rs.outboxService.Discard(tx, config.QueueFileDiffs, reviewStatus.ReviewID, reason); err != nil {
+		return err
+	}
+
+	message := requests.ReviewCancellationMessage{
+		ReviewID:       reviewStatus.ReviewID,
+		ReviewStatusID: reviewStatus.ID,
+		Attempt:        reviewStatus.Attempt,
+		Reason:         reason,
+	}
+	return rs.outboxService.Enqueue(tx, config.QueueReviewCancellations, reviewStatus.ReviewID, &message)
+}
+
+// inFlight reports whether the review service may be working on a review with the status
+func inFlight(status constants.ReviewStatus) bool {
+	return status == constants.StatusQueued || status == constants.StatusProcessing
+}
+
+// lockReviewStatus returns the status of a review, locked for the duration of the transaction
+func (rs *ReviewsService) lockReviewStatus(tx *gorm.DB, reviewID uint) (*models.ReviewStatus, error) {
+	reviewStatus, err := rs.reviewsRepository.GetReviewStatus(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs.reviewsRepository.GetReviewStatusForUpdate(tx, reviewStatus.ID)
+}
+
+// acceptingReviewStatus returns a review status the review service may still report results of attempt
+// for. Results for cancelled and deleted reviews, and of attempts other than the current one, are rejected.
+func (rs *ReviewsService) acceptingReviewStatus(tx *gorm.DB, reviewStatusID uint, attempt int) (*models.ReviewStatus, error) {
+	reviewStatus, err := rs.reviewsRepository.GetReviewStatusForUpdate(tx, reviewStatusID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("review status %d: %w", reviewStatusID, ErrReviewDeleted)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reviewStatus.Status == constants.StatusCancelled {
+		return nil, fmt.Errorf("review %d: %w", reviewStatus.ReviewID, ErrReviewCancelled)
+	}
+	if reviewStatus.Attempt != attempt {
+		return nil, fmt.Errorf("review %d is at attempt %d, not %d: %w", reviewStatus.ReviewID, reviewStatus.Attempt, attempt, ErrStaleAttempt)
+	}
+
+	return reviewStatus, nil
+}
+
+// CompleteReview stores the file reviews produced by the review service and marks the review available.
+// Each file review must be of a file sent to the review service. The file metadata and patch are taken
+// from the diff that was sent, and the comments are checked against it. Results for cancelled or deleted
+// reviews, or of an abandoned attempt, are rejected.
 func (rs *ReviewsService) CompleteReview(tx *gorm.DB, req *requests.CompleteReviewRequest) error {
+	reviewStatus, err := rs.acceptingReviewStatus(tx, req.ReviewStatusID, req.Attempt)
+	if err != nil {
+		return err
+	}
+	if reviewStatus.ReviewID != req.ReviewID {
+		return customerrors.NewValidationError("review_status_id", fmt.Sprintf("review status %d does not belong to review %d", req.ReviewStatusID, req.ReviewID))
+	}
+
+	reviewFileDiffs, err := rs.reviewsRepository.GetReviewFileDiffs(tx, req.ReviewID)
+	if err != nil {
+		return err
+	}
+	sentFileDiffs := make(map[string]*models.ReviewFileDiff, len(reviewFileDiffs))
+	for _, fileDiff := range reviewFileDiffs {
+		sentFileDiffs[fileDiff.Filename] = fileDiff
+	}
+
 	var fileReviews []*models.FileReview
-	for _, review := range req.FileReviews {
+	for i, review := range req.FileReviews {
+		field := fmt.Sprintf("file_reviews[%d]", i)
+		fileDiff, ok := sentFileDiffs[review.Filename]
+		if !ok {
+			return customerrors.NewValidationError(field+".filename", fmt.Sprintf("%s was not sent for review", review.Filename))
+		}
+
+		comments, err := newReviewComments(field, review.Filename, fileDiff.Patch, review.Comments)
+		if err != nil {
+			return err
+		}
+
 		fr := models.FileReview{
-			ReviewID: req.ReviewID,
-			Filename: review.Filename,
-			Content:  review.Content,
-			Patch:    review.Patch,
+			ReviewID:         req.ReviewID,
+			Filename:         fileDiff.Filename,
+			PreviousFilename: fileDiff.PreviousFilename,
+			Status:           fileDiff.Status,
+			SHA:              fileDiff.SHA,
+			RawURL:           fileDiff.RawURL,
+			Language:         fileDiff.Language,
+			Class:            fileDiff.Class,
+			Content:          review.Content,
+			Patch:            fileDiff.Patch,
+			Comments:         comments,
 		}
 		fileReviews = append(fileReviews, &fr)
 	}
 
-	if err := rs.reviewsRepository.CreateFileReviews(tx, fileReviews); err != nil {
+	if err := rs.transition(tx, reviewStatus, constants.StatusAvailable, 100, fmt.Sprintf("%d files reviewed", len(fileReviews)), constants.ActorReviewService, nil); err != nil {
 		return err
 	}
 
-	if err := rs.reviewsRepository.UpdateReviewStatus(tx, req.ReviewStatusID, constants.StatusAvailable); err != nil {
+	if err := rs.reviewsRepository.CreateFileReviews(tx, fileReviews); err != nil {
 		return err
 	}
 
-	if err := rs.reviewsRepository.UpdateReviewProgress(tx, req.ReviewStatusID, 100); err != nil {
+	if err := rs.githubPublicationService.Schedule(tx, req.ReviewID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (rs *ReviewsService) GetReviewStatus(tx *gorm.DB, repoID, prID, reviewID uint) (*models.ReviewStatus, error) {
+// newReviewComments validates the comments on a file against the patch of its diff. Every comment must
+// cover lines of a single hunk on its side of the diff, so that it can be rendered inline.
+func newReviewComments(field, filename, patch string, reviewComments []requests.ReviewCommentRequest) ([]models.ReviewComment, error) {
+	if len(reviewComments) == 0 {
+		return nil, nil
+	}
+
+	hunks, err := utils.ParseUnifiedDiff(patch)
+	if err != nil {
+		return nil, customerrors.NewValidationError(field+".comments", fmt.Sprintf("diff of %s cannot be commented on: %v", filename, err))
+	}
+
+	var comments []models.ReviewComment
+	for i, comment := range reviewComments {
+		commentField := fmt.Sprintf("%s.comments[%d]", field, i)
+
+		if comment.Body == "" {
+			return nil, customerrors.NewValidationError(commentField+".body", "must not be empty")
+		}
+
+		side := comment.Side
+		if side == "" {
+			side = constants.CommentSideRight
+		}
+		if side != constants.CommentSideLeft && side != constants.CommentSideRight {
+			return nil, customerrors.NewValidationError(commentField+".side", fmt.Sprintf("unknown side %q", side))
+		}
+
+		severity := comment.Severity
+		switch severity {
+		case "":
+			severity = constants.SeverityInfo
+		case constants.SeverityInfo, constants.SeverityMinor, constants.SeverityMajor, constants.SeverityCritical:
+		default:
+			return nil, customerrors.NewValidationError(commentField+".severity", fmt.Sprintf("unknown severity %q", severity))
+		}
+
+		endLine := comment.EndLine
+		if endLine == 0 {
+			endLine = comment.StartLine
+		}
+		if comment.StartLine < 1 || endLine < comment.StartLine {
+			return nil, customerrors.NewValidationError(commentField+".start_line", fmt.Sprintf("invalid line range %d-%d", comment.StartLine, endLine))
+		}
+		if !diffContainsLines(hunks, side, comment.StartLine, endLine) {
+			return nil, customerrors.NewValidationError(commentField+".start_line", fmt.Sprintf("lines %d-%d on side %s are not part of a single hunk of the diff", comment.StartLine, endLine, side))
+		}
+
+		if comment.Suggestion != nil && side != constants.CommentSideRight {
+			return nil, customerrors.NewValidationError(commentField+".suggestion", "suggestions can only replace lines on side RIGHT")
+		}
+
+		comments = append(comments, models.ReviewComment{
+			Filename:   filename,
+			Side:       side,
+			StartLine:  comment.StartLine,
+			EndLine:    endLine,
+			Severity:   severity,
+			Category:   strings.ToLower(strings.TrimSpace(comment.Category)),
+			Body:       comment.Body,
+			Suggestion: comment.Suggestion,
+		})
+	}
+
+	return comments, nil
+}
+
+func diffContainsLines(hunks []*utils.DiffHunk, side constants.CommentSide, start, end int) bool {
+	for _, hunk := range hunks {
+		if side == constants.CommentSideLeft && hunk.ContainsOld(start, end) {
+			return true
+		}
+		if side == constants.CommentSideRight && hunk.ContainsNew(start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs *ReviewsService) GetReviewStatus(tx *gorm.DB, userID, repoID, prID, reviewID uint) (*models.ReviewStatus, error) {
+	if _, err := rs.reviewsRepository.GetReview(tx, userID, repoID, prID, reviewID); err != nil {
+		return nil, err
+	}
+
 	reviewStatus, err := rs.reviewsRepository.GetReviewStatus(tx, reviewID)
 	if err != nil {
 		return nil, err
@@ -423,14 +1016,25 @@ func (rs *ReviewsService) GetReviewStatus(tx *gorm.DB, repoID, prID, reviewID ui
 	return reviewStatus, nil
 }
 
-func (rs *ReviewsService) UpdateReviewStatus(tx *gorm.DB, reviewStatusID uint, status constants.ReviewStatus, progress int) error {
-	if err := rs.reviewsRepository.UpdateReviewStatus(tx, reviewStatusID, status); err != nil {
-		return err
+// UpdateReviewStatus applies a status update of the review service. The review service may not cancel
+// or time out reviews, and only failed reviews have an error. Updates for cancelled or deleted reviews,
+// and updates that are not a legal transition, are rejected.
+func (rs *ReviewsService) UpdateReviewStatus(tx *gorm.DB, reviewStatusID uint, attempt int, status constants.ReviewStatus, progress int, reason string) error {
+	switch status {
+	case constants.StatusQueued, constants.StatusProcessing, constants.StatusAvailable:
+		reason = ""
+	case constants.StatusFailed:
+		if reason == "" {
+			reason = "the review service gave no reason"
+		}
+	default:
+		return customerrors.NewValidationError("status", fmt.Sprintf("unknown or reserved status %q", status))
 	}
 
-	if err := rs.reviewsRepository.UpdateReviewProgress(tx, reviewStatusID, progress); err != nil {
+	reviewStatus, err := rs.acceptingReviewStatus(tx, reviewStatusID, attempt)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return rs.transition(tx, reviewStatus, status, progress, reason, constants.ActorReviewService, nil)
 }
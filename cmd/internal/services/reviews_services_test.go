@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+	"github.com/simondanielsson/apPRoved/cmd/internal/models"
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
+	"gorm.io/gorm"
+)
+
+func TestNewReviewComments(t *testing.T) {
+	// old lines 10-13 map to new lines 10-14, with old line 11 replaced by new lines 11-12
+	patch := "@@ -10,4 +10,5 @@\n a\n-b\n+c\n+d\n e\n f\n"
+	suggestion := "x"
+
+	tests := []struct {
+		name    string
+		patch   string
+		comment requests.ReviewCommentRequest
+		wantErr bool
+	}{
+		{name: "new line", patch: patch, comment: requests.ReviewCommentRequest{StartLine: 11, Body: "c"}},
+		{name: "new lines", patch: patch, comment: requests.ReviewCommentRequest{StartLine: 10, EndLine: 14, Body: "a-f"}},
+		{name: "old line", patch: patch, comment: requests.ReviewCommentRequest{Side: constants.CommentSideLeft, StartLine: 11, Body: "b"}},
+		{name: "old lines past the hunk", patch: patch, comment: requests.ReviewCommentRequest{Side: constants.CommentSideLeft, StartLine: 12, EndLine: 14, Body: "e-?"}, wantErr: true},
+		{name: "new line past the hunk", patch: patch, comment: requests.ReviewCommentRequest{StartLine: 15, Body: "?"}, wantErr: true},
+		{name: "new line before the hunk", patch: patch, comment: requests.ReviewCommentRequest{StartLine: 9, EndLine: 10, Body: "?"}, wantErr: true},
+		{name: "unknown side", patch: patch, comment: requests.ReviewCommentRequest{Side: "MIDDLE", StartLine: 11, Body: "c"}, wantErr: true},
+		{name: "suggestion on old line", patch: patch, comment: requests.ReviewCommentRequest{Side: constants.CommentSideLeft, StartLine: 11, Body: "b", Suggestion: &suggestion}, wantErr: true},
+		{name: "binary file", patch: "", comment: requests.ReviewCommentRequest{StartLine: 1, Body: "?"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments, err := newReviewComments("file_reviews[0]", "main.go", tt.patch, []requests.ReviewCommentRequest{tt.comment})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("newReviewComments() = %v, want an error", comments)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newReviewComments() failed: %v", err)
+			}
+			if len(comments) != 1 || comments[0].Filename != "main.go" || comments[0].EndLine < comments[0].StartLine {
+				t.Errorf("newReviewComments() = %+v", comments)
+			}
+		})
+	}
+}
+
+func newTestReviewsService() *ReviewsService {
+	reviewsRepository := repositories.NewReviewsRepository()
+	outboxService := NewOutboxService(repositories.NewOutboxRepository(), reviewsRepository)
+	githubPublicationService := NewGithubPublicationService(&config.GithubPublicationConfig{}, repositories.NewGithubPublicationRepository(), reviewsRepository, nil)
+	return NewReviewsService(&config.ReviewsConfig{}, reviewsRepository, outboxService, githubPublicationService, nil, eventbus.NewMemoryBus())
+}
+
+func TestCancelReview(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  constants.ReviewStatus
+		wantErr error
+	}{
+		{name: "queued", status: constants.StatusQueued},
+		{name: "processing", status: constants.StatusProcessing},
+		{name: "available", status: constants.StatusAvailable, wantErr: ErrIllegalTransition},
+		{name: "failed", status: constants.StatusFailed, wantErr: ErrIllegalTransition},
+		{name: "cancelled", status: constants.StatusCancelled, wantErr: ErrIllegalTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			rs := newTestReviewsService()
+			review, reviewStatus := createTestReview(t, db, tt.status)
+			if err := rs.outboxService.Enqueue(db, config.QueueFileDiffs, review.ID, &requests.FileDiffReviewRequest{
+				ReviewID:       review.ID,
+				ReviewStatusID: reviewStatus.ID,
+				Attempt:        reviewStatus.Attempt,
+				HeadSHA:        review.HeadSHA,
+				FileDiffs:      []*requests.FileDiff{},
+			}); err != nil {
+				t.Fatalf("could not enqueue file diffs: %v", err)
+			}
+
+			userID, repoID := review.PullRequest.Repository.UserID, review.PullRequest.RepositoryID
+			_, err := rs.CancelReview(db, userID, repoID, review.PullRequestID, review.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CancelReview() = %v, want %v", err, tt.wantErr)
+			}
+
+			var messages []*models.OutboxMessage
+			if err := db.Order("id").Find(&messages).Error; err != nil {
+				t.Fatalf("could not read outbox: %v", err)
+			}
+			if tt.wantErr != nil {
+				if len(messages) != 1 || messages[0].FailedAt != nil {
+					t.Errorf("outbox changed although the review was not cancelled: %+v", messages)
+				}
+				return
+			}
+
+			if err := db.First(reviewStatus, reviewStatus.ID).Error; err != nil {
+				t.Fatalf("could not read review status: %v", err)
+			}
+			if reviewStatus.Status != constants.StatusCancelled {
+				t.Errorf("review is %s, want %s", reviewStatus.Status, constants.StatusCancelled)
+			}
+			if len(messages) != 2 {
+				t.Fatalf("outbox has %d messages, want the file diffs and a cancellation", len(messages))
+			}
+			if messages[0].FailedAt == nil {
+				t.Errorf("file diffs were not discarded")
+			}
+			if messages[1].Queue != string(config.QueueReviewCancellations) || messages[1].FailedAt != nil {
+				t.Errorf("outbox has %+v, want a pending cancellation", messages[1])
+			}
+		})
+	}
+}
+
+func TestRejectLateResults(t *testing.T) {
+	patch := "@@ -1,1 +1,2 @@\n a\n+b\n"
+
+	tests := []struct {
+		name string
+		// before changes the review after it was sent to the review service
+		before      func(t *testing.T, rs *ReviewsService, db *gorm.DB, review *models.Review, reviewStatus *models.ReviewStatus)
+		attempt     int
+		filename    string
+		wantErr     error
+		wantInvalid bool
+	}{
+		{name: "results of the current attempt", attempt: 1, filename: "main.go"},
+		{
+			name: "results after the review was cancelled",
+			before: func(t *testing.T, rs *ReviewsService, db *gorm.DB, review *models.Review, reviewStatus *models.ReviewStatus) {
+				if _, err := rs.CancelReview(db, review.PullRequest.Repository.UserID, review.PullRequest.RepositoryID, review.PullRequestID, review.ID); err != nil {
+					t.Fatalf("CancelReview() failed: %v", err)
+				}
+			},
+			attempt:  1,
+			filename: "main.go",
+			wantErr:  ErrReviewCancelled,
+		},
+		{
+			name: "results after the review was deleted",
+			before: func(t *testing.T, rs *ReviewsService, db *gorm.DB, review *models.Review, reviewStatus *models.ReviewStatus) {
+				if err := rs.DeleteReview(db, review.PullRequest.Repository.UserID, review.PullRequest.RepositoryID, review.PullRequestID, review.ID); err != nil {
+					t.Fatalf("DeleteReview() failed: %v", err)
+				}
+			},
+			attempt:  1,
+			filename: "main.go",
+			wantErr:  ErrReviewDeleted,
+		},
+		{
+			name: "results of an abandoned attempt",
+			before: func(t *testing.T, rs *ReviewsService, db *gorm.DB, review *models.Review, reviewStatus *models.ReviewStatus) {
+				if err := rs.reviewsRepository.StartReviewAttempt(db, reviewStatus.ID); err != nil {
+					t.Fatalf("StartReviewAttempt() failed: %v", err)
+				}
+			},
+			attempt:  1,
+			filename: "main.go",
+			wantErr:  ErrStaleAttempt,
+		},
+		{name: "results of a file that was not sent", attempt: 1, filename: "other.go", wantInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			rs := newTestReviewsService()
+			review, reviewStatus := createTestReview(t, db, constants.StatusQueued)
+			if err := rs.reviewsRepository.CreateReviewFileDiffs(db, []*models.ReviewFileDiff{{ReviewID: review.ID, Filename: "main.go", Status: "modified", Patch: patch}}); err != nil {
+				t.Fatalf("could not record file diffs: %v", err)
+			}
+			if tt.before != nil {
+				tt.before(t, rs, db, review, reviewStatus)
+			}
+
+			progressErr := rs.UpdateReviewStatus(db, reviewStatus.ID, tt.attempt, constants.StatusProcessing, 50, "")
+			completeErr := rs.CompleteReview(db, &requests.CompleteReviewRequest{
+				ReviewID:       review.ID,
+				ReviewStatusID: reviewStatus.ID,
+				Attempt:        tt.attempt,
+				FileReviews:    []requests.FileReviewRequest{{Filename: tt.filename, Content: "looks good"}},
+			})
+
+			if tt.wantInvalid {
+				var validationError *customerrors.ValidationError
+				if progressErr != nil || !errors.As(completeErr, &validationError) {
+					t.Errorf("results = %v, %v, want a validation error", progressErr, completeErr)
+				}
+				return
+			}
+			if !errors.Is(progressErr, tt.wantErr) {
+				t.Errorf("UpdateReviewStatus() = %v, want %v", progressErr, tt.wantErr)
+			}
+			if !errors.Is(completeErr, tt.wantErr) {
+				t.Errorf("CompleteReview() = %v, want %v", completeErr, tt.wantErr)
+			}
+
+			var fileReviews int64
+			db.Model(&models.FileReview{}).Where("review_id = ?", review.ID).Count(&fileReviews)
+			if accepted := fileReviews > 0; accepted != (tt.wantErr == nil) {
+				t.Errorf("file reviews stored is %v, want %v", accepted, tt.wantErr == nil)
+			}
+		})
+	}
+}
@@ -1,7 +1,15 @@
 package services
 
 type Services struct {
-	ReviewsService *ReviewsService
-	UserService    *UserService
-	AuthService    *AuthService
+	ReviewsService           *ReviewsService
+	UserService              *UserService
+	AuthService              *AuthService
+	OutboxService            *OutboxService
+	WebhooksService          *WebhooksService
+	PullRequestsService      *PullRequestsService
+	AutoReviewService        *AutoReviewService
+	GithubPublicationService *GithubPublicationService
+	FeedbackService          *FeedbackService
+	GithubAuthService        *GithubAuthService
+	GithubClientService      *GithubClientService
 }
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"log"
+
+	"github.com/simondanielsson/apPRoved/cmd/internal/repositories"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// syncedPullRequestActions are the pull_request actions that change the state, title or head of a pull request
+var syncedPullRequestActions = map[string]bool{
+	"opened":      true,
+	"closed":      true,
+	"reopened":    true,
+	"synchronize": true,
+	"edited":      true,
+}
+
+type WebhooksService struct {
+	reviewsRepository   *repositories.ReviewsRepository
+	pullRequestsService *PullRequestsService
+}
+
+// NewWebhooksService creates a new webhooks service
+func NewWebhooksService(reviewsRepository *repositories.ReviewsRepository, pullRequestsService *PullRequestsService) *WebhooksService {
+	return &WebhooksService{
+		reviewsRepository:   reviewsRepository,
+		pullRequestsService: pullRequestsService,
+	}
+}
+
+// HandlePullRequestEvent applies a pull_request event to every registration of the repository it
+// belongs to, and returns the number of pull requests that were created or updated.
+func (s *WebhooksService) HandlePullRequestEvent(tx *gorm.DB, event *utils.GithubPullRequestEvent) (int, error) {
+	if !syncedPullRequestActions[event.Action] {
+		return 0, nil
+	}
+
+	repos, err := s.reviewsRepository.GetRepositoriesByName(tx, event.RepoOwner, event.RepoName)
+	if err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	for _, repo := range repos {
+		applied, err := s.pullRequestsService.Apply(tx, repo, event.PullRequest, event.Action == "reopened")
+		if err != nil {
+			return synced, err
+		}
+		if applied {
+			synced++
+		}
+	}
+
+	log.Printf("Synced %d pull requests for %s/%s#%d (%s)", synced, event.RepoOwner, event.RepoName, event.PullRequest.Number, event.Action)
+	return synced, nil
+}
+
+// HandleInstallationEvent maps the repositories a GitHub App installation gained access to onto the
+// installation for the users of the account it is installed on, and unmaps the ones it lost access to.
+// It returns the number of repositories updated.
+func (s *WebhooksService) HandleInstallationEvent(tx *gorm.DB, event *utils.GithubInstallationEvent) (int64, error) {
+	if event.Uninstalled() {
+		updated, err := s.reviewsRepository.ClearRepositoriesInstallation(tx, event.InstallationID, "", "")
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("Unmapped %d repositories of GitHub App installation %d (%s)", updated, event.InstallationID, event.Action)
+		return updated, nil
+	}
+
+	// the installation acts with permissions of its own, so it is only mapped to the repositories of users
+	// linked to the account it is installed on, or to the user who installed it, who have access to them.
+	// Accounts are matched by GitHub ID, since logins can be renamed and taken over. Other users, e.g. the
+	// members of an organization the app is installed on, get it mapped when they register the repository
+	// or refresh its pull requests, once it is checked that they have access.
+	var updated int64
+	for _, repo := range event.Added {
+		n, err := s.reviewsRepository.SetRepositoriesInstallation(tx, repo.Owner, repo.Name, event.InstallationID, []int64{event.AccountID, event.SenderID})
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+	}
+	for _, repo := range event.Removed {
+		n, err := s.reviewsRepository.ClearRepositoriesInstallation(tx, event.InstallationID, repo.Owner, repo.Name)
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+	}
+
+	log.Printf("Updated %d repositories of GitHub App installation %d (%s)", updated, event.InstallationID, event.Action)
+	return updated, nil
+}
@@ -0,0 +1,68 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"gorm.io/gorm"
+)
+
+// AutoReviewScheduler creates reviews for pull requests whose debounced auto review is due
+type AutoReviewScheduler struct {
+	config            *config.AutoReviewConfig
+	db                *gorm.DB
+	bus               eventbus.Bus
+	autoReviewService *services.AutoReviewService
+}
+
+// NewAutoReviewScheduler creates a new auto review scheduler
+func NewAutoReviewScheduler(cfg *config.AutoReviewConfig, db *gorm.DB, bus eventbus.Bus, autoReviewService *services.AutoReviewService) *AutoReviewScheduler {
+	return &AutoReviewScheduler{
+		config:            cfg,
+		db:                db,
+		bus:               bus,
+		autoReviewService: autoReviewService,
+	}
+}
+
+func (s *AutoReviewScheduler) Name() string {
+	return "auto review scheduler"
+}
+
+func (s *AutoReviewScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDue(ctx)
+		}
+	}
+}
+
+// runDue creates due auto reviews one transaction at a time, so that one failing review does not
+// hold back the others
+func (s *AutoReviewScheduler) runDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		var ran bool
+		err := eventbus.Transaction(ctx, s.bus, s.db, func(tx *gorm.DB) error {
+			var err error
+			ran, err = s.autoReviewService.RunDue(ctx, tx)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error running auto reviews: %v", err)
+			return
+		}
+		if !ran {
+			return
+		}
+	}
+}
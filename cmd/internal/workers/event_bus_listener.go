@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+)
+
+// EventBusListener delivers the review events published by any replica to the clients streaming
+// reviews from this replica
+type EventBusListener struct {
+	config *config.EventBusConfig
+	bus    *eventbus.PostgresBus
+}
+
+// NewEventBusListener creates a new event bus listener
+func NewEventBusListener(cfg *config.EventBusConfig, bus *eventbus.PostgresBus) *EventBusListener {
+	return &EventBusListener{
+		config: cfg,
+		bus:    bus,
+	}
+}
+
+func (l *EventBusListener) Name() string {
+	return "event bus listener"
+}
+
+func (l *EventBusListener) Run(ctx context.Context) {
+	for {
+		err := l.bus.Listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Stopped listening for review events: %v. Listening again in %v...", err, l.config.ReconnectDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.config.ReconnectDelay):
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"gorm.io/gorm"
+)
+
+// GithubPublisher publishes completed reviews to their pull requests on GitHub
+type GithubPublisher struct {
+	config                   *config.GithubPublicationConfig
+	db                       *gorm.DB
+	githubPublicationService *services.GithubPublicationService
+}
+
+// NewGithubPublisher creates a new GitHub publisher
+func NewGithubPublisher(cfg *config.GithubPublicationConfig, db *gorm.DB, githubPublicationService *services.GithubPublicationService) *GithubPublisher {
+	return &GithubPublisher{
+		config:                   cfg,
+		db:                       db,
+		githubPublicationService: githubPublicationService,
+	}
+}
+
+func (p *GithubPublisher) Name() string {
+	return "github publisher"
+}
+
+func (p *GithubPublisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.publishDue(ctx)
+		}
+	}
+}
+
+// publishDue publishes due reviews one transaction at a time, so that one failing publication does
+// not hold back the others
+func (p *GithubPublisher) publishDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		var published bool
+		err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			published, err = p.githubPublicationService.PublishDue(ctx, tx)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error publishing reviews: %v", err)
+			return
+		}
+		if !published {
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
+	"gorm.io/gorm"
+)
+
+// OutboxRelay periodically publishes committed outbox messages to the message queue
+type OutboxRelay struct {
+	config        *config.OutboxConfig
+	db            *gorm.DB
+	bus           eventbus.Bus
+	queue         mq.MessageQueue
+	outboxService *services.OutboxService
+}
+
+// NewOutboxRelay creates a new outbox relay
+func NewOutboxRelay(cfg *config.OutboxConfig, db *gorm.DB, bus eventbus.Bus, queue mq.MessageQueue, outboxService *services.OutboxService) *OutboxRelay {
+	return &OutboxRelay{
+		config:        cfg,
+		db:            db,
+		bus:           bus,
+		queue:         queue,
+		outboxService: outboxService,
+	}
+}
+
+func (r *OutboxRelay) Name() string {
+	return "outbox relay"
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(r.config.PruneInterval)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.dispatch(ctx)
+		case <-pruneTicker.C:
+			r.prune(ctx)
+		}
+	}
+}
+
+// prune deletes the messages that no longer need to be kept
+func (r *OutboxRelay) prune(ctx context.Context) {
+	if err := r.outboxService.Prune(r.db.WithContext(ctx), r.config.Retention); err != nil {
+		log.Printf("Error pruning outbox messages: %v", err)
+	}
+}
+
+// dispatch drains the outbox, one message per transaction, until no due messages remain. Each message is
+// marked as dispatched in the transaction that published it, so a failure can only publish the message
+// of the failed transaction again.
+func (r *OutboxRelay) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		var dispatched bool
+		err := eventbus.Transaction(ctx, r.bus, r.db, func(tx *gorm.DB) error {
+			var err error
+			dispatched, err = r.outboxService.DispatchNext(ctx, tx, r.queue, r.config.MaxAttempts)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error dispatching outbox messages: %v", err)
+			return
+		}
+		if !dispatched {
+			return
+		}
+	}
+}
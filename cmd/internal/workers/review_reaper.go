@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	"gorm.io/gorm"
+)
+
+// ReviewReaper times out reviews the review service never picked up or stopped working on
+type ReviewReaper struct {
+	config         *config.ReviewsConfig
+	db             *gorm.DB
+	bus            eventbus.Bus
+	reviewsService *services.ReviewsService
+}
+
+// NewReviewReaper creates a new review reaper
+func NewReviewReaper(cfg *config.ReviewsConfig, db *gorm.DB, bus eventbus.Bus, reviewsService *services.ReviewsService) *ReviewReaper {
+	return &ReviewReaper{
+		config:         cfg,
+		db:             db,
+		bus:            bus,
+		reviewsService: reviewsService,
+	}
+}
+
+func (r *ReviewReaper) Name() string {
+	return "review reaper"
+}
+
+func (r *ReviewReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.ReaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+func (r *ReviewReaper) reap(ctx context.Context) {
+	var timedOut int64
+	err := eventbus.Transaction(ctx, r.bus, r.db, func(tx *gorm.DB) error {
+		var err error
+		timedOut, err = r.reviewsService.TimeOutStuckReviews(tx)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error timing out stuck reviews: %v", err)
+		return
+	}
+	if timedOut > 0 {
+		log.Printf("Timed out %d stuck reviews", timedOut)
+	}
+}
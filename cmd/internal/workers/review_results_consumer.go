@@ -0,0 +1,101 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simondanielsson/apPRoved/cmd/config"
+	"github.com/simondanielsson/apPRoved/cmd/constants"
+	"github.com/simondanielsson/apPRoved/cmd/internal/dto/requests"
+	"github.com/simondanielsson/apPRoved/cmd/internal/eventbus"
+	"github.com/simondanielsson/apPRoved/cmd/internal/services"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
+	"github.com/simondanielsson/apPRoved/pkg/utils"
+	"github.com/simondanielsson/apPRoved/pkg/utils/mq"
+	"gorm.io/gorm"
+)
+
+// resubscribeDelay is how long the consumer waits before subscribing again after losing its subscription
+const resubscribeDelay = 5 * time.Second
+
+// ReviewResultsConsumer applies progress updates and completed reviews sent by the review service
+type ReviewResultsConsumer struct {
+	db             *gorm.DB
+	bus            eventbus.Bus
+	queue          mq.MessageQueue
+	reviewsService *services.ReviewsService
+}
+
+// NewReviewResultsConsumer creates a new review results consumer
+func NewReviewResultsConsumer(db *gorm.DB, bus eventbus.Bus, queue mq.MessageQueue, reviewsService *services.ReviewsService) *ReviewResultsConsumer {
+	return &ReviewResultsConsumer{
+		db:             db,
+		bus:            bus,
+		queue:          queue,
+		reviewsService: reviewsService,
+	}
+}
+
+func (c *ReviewResultsConsumer) Name() string {
+	return "review results consumer"
+}
+
+func (c *ReviewResultsConsumer) Run(ctx context.Context) {
+	for {
+		err := c.queue.Subscribe(ctx, config.QueueReviewResults, c.handle)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Lost subscription to %s: %v. Resubscribing in %v...", config.QueueReviewResults, err, resubscribeDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// handle processes a single message in its own transaction. Messages that can never succeed are
+// reported as permanent errors so that they are dropped instead of redelivered.
+func (c *ReviewResultsConsumer) handle(ctx context.Context, body []byte) error {
+	var message requests.ReviewResultMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return mq.NewPermanentError(fmt.Errorf("could not parse review result: %v", err))
+	}
+	if err := utils.ValidateStruct(&message); err != nil {
+		return mq.NewPermanentError(fmt.Errorf("invalid review result: %w", err))
+	}
+
+	err := eventbus.Transaction(ctx, c.bus, c.db, func(tx *gorm.DB) error {
+		switch message.Type {
+		case constants.ReviewResultProgress:
+			return c.reviewsService.UpdateReviewStatus(tx, message.ReviewStatusID, message.Attempt, message.Status, message.Progress, "")
+		case constants.ReviewResultComplete:
+			return c.reviewsService.CompleteReview(tx, &requests.CompleteReviewRequest{
+				ReviewID:       message.ReviewID,
+				ReviewStatusID: message.ReviewStatusID,
+				Attempt:        message.Attempt,
+				FileReviews:    message.FileReviews,
+			})
+		case constants.ReviewResultFailed:
+			return c.reviewsService.UpdateReviewStatus(tx, message.ReviewStatusID, message.Attempt, constants.StatusFailed, message.Progress, message.Error)
+		default:
+			return mq.NewPermanentError(fmt.Errorf("unknown review result type %q", message.Type))
+		}
+	})
+	// results for cancelled, deleted or finished reviews, or abandoned attempts, are of no use anymore
+	var validationErr *customerrors.ValidationError
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.As(err, &validationErr) ||
+		errors.Is(err, services.ErrReviewCancelled) || errors.Is(err, services.ErrReviewDeleted) ||
+		errors.Is(err, services.ErrStaleAttempt) ||
+		errors.Is(err, services.ErrIllegalTransition) {
+		return mq.NewPermanentError(err)
+	}
+
+	return err
+}
@@ -0,0 +1,9 @@
+package workers
+
+import "context"
+
+// Worker is a background process that runs alongside the API server until its context is cancelled.
+type Worker interface {
+	Name() string
+	Run(ctx context.Context)
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/simondanielsson/apPRoved/cmd/api"
+	"github.com/simondanielsson/apPRoved/cmd/bootstrap"
 	"github.com/simondanielsson/apPRoved/cmd/config"
 	"github.com/simondanielsson/apPRoved/cmd/internal/db"
 	"github.com/simondanielsson/apPRoved/pkg/utils"
@@ -20,6 +21,9 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.apikey ServiceSignature
+// @in header
+// @name X-Approved-Signature
 func main() {
 	config, err := config.LoadConfig()
 	if err != nil {
@@ -39,18 +43,19 @@ func main() {
 	}
 	defer messageQueue.Close()
 
-	githubClient, err := utils.NewGithubClient(context.Background())
-	if err != nil {
-		log.Fatalf("could not create github client: %v", err)
-	}
+	utils.ConfigureGithubRequests(config.Github.MaxConcurrentRequests, config.Github.MaxRateLimitWait)
+	utils.SetGithubCache(bootstrap.InitGithubCache(config.GithubCache, db))
+
+	server := api.NewAPIServer(config, db, messageQueue)
 
-	server := api.NewAPIServer(config.Server, db, messageQueue, githubClient)
+	ctx, stopWorkers := context.WithCancel(context.Background())
+	server.RunWorkers(ctx)
 
-	gracefulShutdown(server, &messageQueue)
+	gracefulShutdown(server, &messageQueue, stopWorkers)
 	server.Run()
 }
 
-func gracefulShutdown(server *api.APIServer, queue *mq.MessageQueue) {
+func gracefulShutdown(server *api.APIServer, queue *mq.MessageQueue, stopWorkers context.CancelFunc) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
@@ -58,6 +63,7 @@ func gracefulShutdown(server *api.APIServer, queue *mq.MessageQueue) {
 		<-quit
 		log.Println("Shutting down server...")
 
+		stopWorkers()
 		(*queue).Close()
 
 		if err := server.Shutdown(); err != nil {
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// DiffHunk is a hunk of a unified diff. Old lines are lines of the base version of the file, new
+// lines are lines of the head version.
+type DiffHunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+}
+
+// ContainsOld reports whether the old lines start to end are all part of the hunk
+func (h *DiffHunk) ContainsOld(start, end int) bool {
+	return h.OldLines > 0 && start >= h.OldStart && end < h.OldStart+h.OldLines
+}
+
+// ContainsNew reports whether the new lines start to end are all part of the hunk
+func (h *DiffHunk) ContainsNew(start, end int) bool {
+	return h.NewLines > 0 && start >= h.NewStart && end < h.NewStart+h.NewLines
+}
+
+// ParseUnifiedDiff parses the hunks of a unified diff as returned by GitHub for a single file, and
+// checks that each hunk has as many lines as its header says
+func ParseUnifiedDiff(patch string) ([]*DiffHunk, error) {
+	var hunks []*DiffHunk
+	var hunk *DiffHunk
+	var oldSeen, newSeen int
+
+	closeHunk := func() error {
+		if hunk != nil && (oldSeen != hunk.OldLines || newSeen != hunk.NewLines) {
+			return fmt.Errorf("hunk at line %d has %d old and %d new lines, header says %d and %d", hunk.NewStart, oldSeen, newSeen, hunk.OldLines, hunk.NewLines)
+		}
+		return nil
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			if err := closeHunk(); err != nil {
+				return nil, err
+			}
+
+			match := hunkHeaderRegexp.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+			hunk = &DiffHunk{
+				OldStart: atoiOr(match[1], 0),
+				OldLines: atoiOr(match[2], 1),
+				NewStart: atoiOr(match[3], 0),
+				NewLines: atoiOr(match[4], 1),
+			}
+			hunks = append(hunks, hunk)
+			oldSeen, newSeen = 0, 0
+			continue
+		}
+
+		if hunk == nil {
+			return nil, fmt.Errorf("diff content before first hunk header")
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			newSeen++
+		case strings.HasPrefix(line, "-"):
+			oldSeen++
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+		default:
+			oldSeen++
+			newSeen++
+		}
+	}
+
+	if err := closeHunk(); err != nil {
+		return nil, err
+	}
+
+	return hunks, nil
+}
+
+func atoiOr(s string, defaultValue int) int {
+	if s == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+// FileExcerpt holds lines StartLine to EndLine of a file
+type FileExcerpt struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Text      string `json:"text"`
+}
+
+// ContextExcerpts returns the lines of the head version of a file within contextLines of the hunks of its
+// diff. Overlapping excerpts are merged.
+func ContextExcerpts(content string, hunks []*DiffHunk, contextLines int) []*FileExcerpt {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var excerpts []*FileExcerpt
+	for _, hunk := range hunks {
+		start := max(hunk.NewStart-contextLines, 1)
+		end := min(hunk.NewStart+hunk.NewLines-1+contextLines, len(lines))
+		if start > end {
+			continue
+		}
+
+		if last := len(excerpts) - 1; last >= 0 && start <= excerpts[last].EndLine+1 {
+			start = excerpts[last].StartLine
+			excerpts = excerpts[:last]
+		}
+		excerpts = append(excerpts, &FileExcerpt{
+			StartLine: start,
+			EndLine:   end,
+			Text:      strings.Join(lines[start-1:end], ""),
+		})
+	}
+
+	return excerpts
+}
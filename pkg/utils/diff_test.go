@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testPatch = `@@ -1,4 +1,6 @@
+ package main
+-import "fmt"
++import (
++	"fmt"
++)
+
+ func main() {
+@@ -10,3 +12,2 @@ func main() {
+ 	a := 1
+-	b := 2
+ 	fmt.Println(a)
+\ No newline at end of file`
+
+func TestParseUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    []*DiffHunk
+		wantErr bool
+	}{
+		{
+			name:  "hunks",
+			patch: testPatch,
+			want: []*DiffHunk{
+				{OldStart: 1, OldLines: 4, NewStart: 1, NewLines: 6},
+				{OldStart: 10, OldLines: 3, NewStart: 12, NewLines: 2},
+			},
+		},
+		{
+			name:  "omitted line counts",
+			patch: "@@ -3 +3 @@\n-a\n+b\n",
+			want:  []*DiffHunk{{OldStart: 3, OldLines: 1, NewStart: 3, NewLines: 1}},
+		},
+		{
+			name:  "added file",
+			patch: "@@ -0,0 +1,2 @@\n+a\n+b",
+			want:  []*DiffHunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2}},
+		},
+		{
+			name:  "removed file",
+			patch: "@@ -1,2 +0,0 @@\n-a\n-b",
+			want:  []*DiffHunk{{OldStart: 1, OldLines: 2, NewStart: 0, NewLines: 0}},
+		},
+		{
+			name:    "empty patch",
+			patch:   "",
+			wantErr: true,
+		},
+		{
+			name:    "content before first hunk",
+			patch:   "+a\n@@ -1 +1 @@\n a",
+			wantErr: true,
+		},
+		{
+			name:    "invalid hunk header",
+			patch:   "@@ -a +b @@\n a",
+			wantErr: true,
+		},
+		{
+			name:    "fewer lines than the header says",
+			patch:   "@@ -1,3 +1,3 @@\n a\n b",
+			wantErr: true,
+		},
+		{
+			name:    "more lines than the header says",
+			patch:   "@@ -1 +1,2 @@\n a\n+b\n+c",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := ParseUnifiedDiff(tt.patch)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseUnifiedDiff() = %v, want an error", hunks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseUnifiedDiff() failed: %v", err)
+			}
+			if !reflect.DeepEqual(hunks, tt.want) {
+				t.Errorf("ParseUnifiedDiff() = %v, want %v", hunks, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffHunkContains(t *testing.T) {
+	hunks, err := ParseUnifiedDiff(testPatch)
+	if err != nil {
+		t.Fatalf("ParseUnifiedDiff() failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		hunk       *DiffHunk
+		start, end int
+		wantOld    bool
+		wantNew    bool
+	}{
+		{name: "first line", hunk: hunks[0], start: 1, end: 1, wantOld: true, wantNew: true},
+		{name: "whole hunk", hunk: hunks[0], start: 1, end: 4, wantOld: true, wantNew: true},
+		{name: "new lines past the old lines", hunk: hunks[0], start: 2, end: 5, wantOld: false, wantNew: true},
+		{name: "past the hunk", hunk: hunks[0], start: 6, end: 7, wantOld: false, wantNew: false},
+		{name: "before the second hunk", hunk: hunks[1], start: 9, end: 10, wantOld: false, wantNew: false},
+		{name: "old lines of the second hunk", hunk: hunks[1], start: 10, end: 12, wantOld: true, wantNew: false},
+		{name: "new lines of the second hunk", hunk: hunks[1], start: 12, end: 13, wantOld: false, wantNew: true},
+		{name: "no old lines", hunk: &DiffHunk{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2}, start: 0, end: 0, wantOld: false, wantNew: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hunk.ContainsOld(tt.start, tt.end); got != tt.wantOld {
+				t.Errorf("ContainsOld(%d, %d) = %v, want %v", tt.start, tt.end, got, tt.wantOld)
+			}
+			if got := tt.hunk.ContainsNew(tt.start, tt.end); got != tt.wantNew {
+				t.Errorf("ContainsNew(%d, %d) = %v, want %v", tt.start, tt.end, got, tt.wantNew)
+			}
+		})
+	}
+}
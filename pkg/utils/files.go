@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+type FileClass string
+
+// File Class Constants
+const (
+	// FileClassSource is a file written by hand.
+	FileClassSource FileClass = "source"
+	// FileClassGenerated is a file generated by a tool, e.g. a lockfile or generated code.
+	FileClassGenerated FileClass = "generated"
+	// FileClassVendored is a third-party file checked into the repository.
+	FileClassVendored FileClass = "vendored"
+	// FileClassBinary is a file without a textual diff, e.g. an image or an archive.
+	FileClassBinary FileClass = "binary"
+)
+
+var vendoredDirectories = []string{"vendor/", "node_modules/", "third_party/", "bower_components/"}
+
+var generatedFiles = map[string]bool{
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"pnpm-lock.yaml":    true,
+	"go.sum":            true,
+	"Cargo.lock":        true,
+	"poetry.lock":       true,
+	"Pipfile.lock":      true,
+	"composer.lock":     true,
+	"Gemfile.lock":      true,
+}
+
+var generatedSuffixes = []string{".pb.go", "_generated.go", ".gen.go", "_pb2.py", ".min.js", ".min.css", ".map", ".snap"}
+
+var binaryExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".ico": true, ".webp": true, ".bmp": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tgz": true, ".tar": true, ".jar": true, ".war": true,
+	".exe": true, ".dll": true, ".so": true, ".dylib": true, ".a": true, ".o": true, ".class": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+	".mp3": true, ".mp4": true, ".mov": true, ".wav": true, ".sqlite": true,
+}
+
+// ClassifyFile classifies a file by its path
+func ClassifyFile(filename string) FileClass {
+	base := path.Base(filename)
+
+	for _, dir := range vendoredDirectories {
+		if strings.HasPrefix(filename, dir) || strings.Contains(filename, "/"+dir) {
+			return FileClassVendored
+		}
+	}
+	if binaryExtensions[strings.ToLower(path.Ext(base))] {
+		return FileClassBinary
+	}
+	if generatedFiles[base] {
+		return FileClassGenerated
+	}
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return FileClassGenerated
+		}
+	}
+
+	return FileClassSource
+}
+
+var languagesByExtension = map[string]string{
+	".go": "Go", ".py": "Python", ".rb": "Ruby", ".rs": "Rust", ".java": "Java", ".kt": "Kotlin", ".kts": "Kotlin",
+	".scala": "Scala", ".swift": "Swift", ".m": "Objective-C", ".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++",
+	".cxx": "C++", ".hpp": "C++", ".cs": "C#", ".fs": "F#", ".php": "PHP", ".js": "JavaScript", ".mjs": "JavaScript",
+	".cjs": "JavaScript", ".jsx": "JavaScript", ".ts": "TypeScript", ".tsx": "TypeScript", ".vue": "Vue",
+	".svelte": "Svelte", ".html": "HTML", ".css": "CSS", ".scss": "SCSS", ".sass": "Sass", ".less": "Less",
+	".sql": "SQL", ".sh": "Shell", ".bash": "Shell", ".zsh": "Shell", ".ps1": "PowerShell", ".lua": "Lua",
+	".pl": "Perl", ".r": "R", ".dart": "Dart", ".ex": "Elixir", ".exs": "Elixir", ".erl": "Erlang", ".hs": "Haskell",
+	".clj": "Clojure", ".ml": "OCaml", ".zig": "Zig", ".tf": "HCL", ".hcl": "HCL", ".proto": "Protocol Buffers",
+	".graphql": "GraphQL", ".json": "JSON", ".yaml": "YAML", ".yml": "YAML", ".toml": "TOML", ".xml": "XML",
+	".md": "Markdown", ".rst": "reStructuredText", ".ipynb": "Jupyter Notebook",
+}
+
+var languagesByFilename = map[string]string{
+	"Dockerfile":     "Dockerfile",
+	"Makefile":       "Makefile",
+	"Jenkinsfile":    "Groovy",
+	"Gemfile":        "Ruby",
+	"Rakefile":       "Ruby",
+	"go.mod":         "Go Module",
+	"CMakeLists.txt": "CMake",
+}
+
+// DetectLanguage returns the language of a file by its path, or an empty string if it is not known
+func DetectLanguage(filename string) string {
+	base := path.Base(filename)
+	if language, ok := languagesByFilename[base]; ok {
+		return language
+	}
+	if strings.HasPrefix(base, "Dockerfile.") {
+		return "Dockerfile"
+	}
+	return languagesByExtension[strings.ToLower(path.Ext(base))]
+}
+
+// Glob matches slash-separated paths. "*" matches within a path segment, "**" matches across segments
+// and "?" matches a single character. A pattern without a slash matches the base name of a path, and a
+// pattern ending in a slash matches everything in the directory.
+type Glob struct {
+	re       *regexp.Regexp
+	basename bool
+}
+
+// CompileGlob compiles a glob pattern
+func CompileGlob(pattern string) (*Glob, error) {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" also matches no directory at all
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					expr.WriteString("(?:.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Glob{re: re, basename: !strings.Contains(pattern, "/")}, nil
+}
+
+// Match reports whether a path matches the glob
+func (g *Glob) Match(filename string) bool {
+	if g.basename {
+		return g.re.MatchString(path.Base(filename))
+	}
+	return g.re.MatchString(filename)
+}
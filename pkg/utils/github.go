@@ -2,58 +2,158 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/go-github/v64/github"
 	"golang.org/x/oauth2"
 )
 
+// GithubPullRequest is a pull request as GitHub last reported it. UpdatedAt orders the reports of the
+// same pull request.
 type GithubPullRequest struct {
 	Number     uint
 	Title      string
 	URL        string
 	State      string
 	LastCommit string
+	UpdatedAt  time.Time
 }
 
-type GithubPullRequestFileChanges struct {
-	Filename  string `json:"filename"`
-	Patch     string `json:"patch"`
-	Additions int    `json:"additions"`
-	Deletions int    `json:"deletions"`
-	Changes   int    `json:"changes"`
+// GithubPullRequestRefs are the commits a pull request currently compares
+type GithubPullRequestRefs struct {
+	HeadSHA string
+	BaseSHA string
 }
 
-type GithubClient struct {
-	client *github.Client
-	mutex  *sync.Mutex
+// GithubComparison is the difference between two commits. MergeBaseSHA is the commit the head diverged
+// from the base at, which the files are compared from. Truncated tells that GitHub left out files past
+// MaxComparisonFiles.
+type GithubComparison struct {
+	Status       string
+	MergeBaseSHA string
+	Files        []*GithubPullRequestFileChanges
+	Truncated    bool
 }
 
-func NewGithubClient(ctx context.Context) (*GithubClient, error) {
-	client := GithubClient{
-		client: nil,
-		mutex:  &sync.Mutex{},
-	}
+// GithubReview is a pull request review to publish to GitHub. Marker identifies the review on GitHub;
+// it is hidden in the body, so that the review can be found again if its ID was lost.
+type GithubReview struct {
+	Body     string
+	Marker   string
+	Comments []*GithubReviewComment
+}
 
-	if err := client.connect(ctx); err != nil {
-		return nil, fmt.Errorf("failed to initialize GitHub client")
+// body returns the body of the review with its marker
+func (r *GithubReview) body() string {
+	if r.Marker == "" {
+		return r.Body
 	}
+	return fmt.Sprintf("%s\n<!-- %s -->\n", r.Body, r.Marker)
+}
 
-	return &client, nil
+// GithubReviewComment is a review comment on a file. It is anchored at lines StartLine to Line of one
+// side of the file's diff, or at a position in the diff if Line is not set.
+type GithubReviewComment struct {
+	Path      string
+	Position  int
+	Side      string
+	StartLine int
+	Line      int
+	Body      string
 }
 
-func (c *GithubClient) connect(ctx context.Context) error {
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
-		log.Fatalf("GITHUB_TOKEN is not set")
+func (c *GithubReviewComment) key() string {
+	if c.Line == 0 {
+		return fmt.Sprintf("%s@%d", c.Path, c.Position)
 	}
+	return fmt.Sprintf("%s:%s:%d", c.Path, c.Side, c.Line)
+}
+
+// MaxPullRequestFiles is the number of files GitHub lists for a pull request at most
+const MaxPullRequestFiles = 3000
+
+// MaxComparisonFiles is the number of files GitHub lists for a comparison of two commits at most
+const MaxComparisonFiles = 300
+
+// ErrPullRequestHeadMoved is returned when a pull request is no longer at the commit it is expected at
+var ErrPullRequestHeadMoved = errors.New("pull request head moved")
+
+var (
+	// ErrFileNotFound is returned when a file does not exist at a commit
+	ErrFileNotFound = errors.New("file not found")
+	// ErrFileTooLarge is returned when a file exceeds the size limit it is fetched with
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// GithubPullRequestFileChanges is a file changed by a pull request. Patch is empty if GitHub has no
+// textual diff of the file, e.g. because it is binary or its diff is too large. Status is one of GitHub's
+// file statuses, e.g. "added", "removed", "modified" or "renamed", and PreviousFilename is set for renamed
+// files. SHA is the blob SHA and RawURL the download URL of the file as reported by GitHub.
+type GithubPullRequestFileChanges struct {
+	Filename         string    `json:"filename"`
+	PreviousFilename string    `json:"previous_filename,omitempty"`
+	Status           string    `json:"status"`
+	SHA              string    `json:"sha,omitempty"`
+	RawURL           string    `json:"raw_url,omitempty"`
+	Language         string    `json:"language,omitempty"`
+	Class            FileClass `json:"class"`
+	Patch            string    `json:"patch"`
+	Additions        int       `json:"additions"`
+	Deletions        int       `json:"deletions"`
+	Changes          int       `json:"changes"`
+}
+
+// GitHub File Status Constants
+const (
+	FileStatusAdded     = "added"
+	FileStatusRemoved   = "removed"
+	FileStatusModified  = "modified"
+	FileStatusRenamed   = "renamed"
+	FileStatusCopied    = "copied"
+	FileStatusChanged   = "changed"
+	FileStatusUnchanged = "unchanged"
+)
+
+// GithubClient is safe for concurrent use. The requests of all clients share a bounded number of
+// request slots, see ConfigureGithubRequests. Clients of a GitHub App installation have app set.
+type GithubClient struct {
+	client *github.Client
+	app    *GithubApp
+
+	mutex sync.Mutex
+	user  *github.User
+}
+
+// NewGithubClientWithToken creates a GitHub client authenticated with an access token, e.g. the
+// token of a user who signed in with GitHub
+func NewGithubClientWithToken(ctx context.Context, token string) (*GithubClient, error) {
+	client := GithubClient{}
 
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
+	if err := client.connect(ctx, ts, "token:"+HashToken(token)); err != nil {
+		return nil, fmt.Errorf("failed to initialize GitHub client: %v", err)
+	}
+
+	return &client, nil
+}
+
+// connect creates the underlying client. Cached responses are only shared between clients of the same
+// cacheNamespace, i.e. the same credential.
+func (c *GithubClient) connect(ctx context.Context, ts oauth2.TokenSource, cacheNamespace string) error {
+	// rate limit beneath the OAuth2 transport, so that fetching a token does not wait for a request slot
+	// held by the request that needs the token
+	transport := newCachingTransport(newRateLimitTransport(http.DefaultTransport), cacheNamespace)
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
 	tc := oauth2.NewClient(ctx, ts)
 	if tc == nil {
 		log.Fatal("Failed to initialize OAuth2 client")
@@ -63,32 +163,37 @@ func (c *GithubClient) connect(ctx context.Context) error {
 	if client == nil {
 		log.Fatalf("Failed to initialize GitHub client")
 	}
+
+	// GITHUB_API_URL points the client at another API server, e.g. GitHub Enterprise or a local stub
+	if apiURL := os.Getenv("GITHUB_API_URL"); apiURL != "" {
+		baseURL, err := githubBaseURL(apiURL)
+		if err != nil {
+			return fmt.Errorf("invalid GITHUB_API_URL: %v", err)
+		}
+		client.BaseURL = baseURL
+	}
 	c.client = client
 
-	log.Printf("Initialized GitHub client")
 	return nil
 }
 
-func (c *GithubClient) ListPullRequests(ctx context.Context, repoName, repoOwner string, userID uint) ([]*GithubPullRequest, error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
+func (c *GithubClient) ListPullRequests(ctx context.Context, repoName, repoOwner string) ([]*GithubPullRequest, error) {
 	log.Printf("Fetching PRs for %s/%s", repoOwner, repoName)
 	// fetch PR's by page
 	opts := &github.PullRequestListOptions{
 		State:       "open",
-		ListOptions: github.ListOptions{Page: 0, PerPage: 30},
+		ListOptions: github.ListOptions{Page: 0, PerPage: 100},
 	}
 
 	var prs []*GithubPullRequest
 	for {
 		fetchedPRs, resp, err := c.client.PullRequests.List(ctx, repoOwner, repoName, opts)
 		if err != nil {
-			if r, _ := err.(*github.ErrorResponse); r.Response.StatusCode == 404 {
-				fetchedPRs = []*github.PullRequest{}
-			} else {
-				return nil, err
+			var errorResponse *github.ErrorResponse
+			if errors.As(err, &errorResponse) && errorResponse.Response.StatusCode == http.StatusNotFound {
+				break
 			}
+			return nil, githubError(err)
 		}
 
 		for _, pr := range fetchedPRs {
@@ -98,17 +203,13 @@ func (c *GithubClient) ListPullRequests(ctx context.Context, repoName, repoOwner
 			}
 			uint_number := uint(number)
 
-			commits, _, err := c.client.PullRequests.ListCommits(ctx, repoOwner, repoName, *pr.Number, nil)
-			if err != nil {
-				return nil, err
-			}
-
 			prs = append(prs, &GithubPullRequest{
 				Number:     uint_number,
 				Title:      *pr.Title,
 				URL:        *pr.URL,
 				State:      *pr.State,
-				LastCommit: *commits[len(commits)-1].SHA,
+				LastCommit: pr.GetHead().GetSHA(),
+				UpdatedAt:  pr.GetUpdatedAt().Time,
 			})
 			log.Printf("#%d %s (%s)\n", *pr.Number, *pr.Title, *pr.URL)
 		}
@@ -125,26 +226,296 @@ func (c *GithubClient) ListPullRequests(ctx context.Context, repoName, repoOwner
 	return prs, nil
 }
 
-func (c *GithubClient) FetchFileDiffs(ctx context.Context, repoName, repoOwner string, prNumber uint, userID uint) ([]*GithubPullRequestFileChanges, error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+// HasRepositoryAccess reports whether the client can see a repository. GitHub answers 404 for private
+// repositories the client has no access to.
+func (c *GithubClient) HasRepositoryAccess(ctx context.Context, repoName, repoOwner string) (bool, error) {
+	_, resp, err := c.client.Repositories.Get(ctx, repoOwner, repoName)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, githubError(err)
+	}
+
+	return true, nil
+}
+
+// GetPullRequestRefs returns the current head and base commits of a pull request
+func (c *GithubClient) GetPullRequestRefs(ctx context.Context, repoName, repoOwner string, prNumber uint) (*GithubPullRequestRefs, error) {
+	pr, _, err := c.client.PullRequests.Get(ctx, repoOwner, repoName, int(prNumber))
+	if err != nil {
+		return nil, githubError(err)
+	}
+
+	return &GithubPullRequestRefs{
+		HeadSHA: pr.GetHead().GetSHA(),
+		BaseSHA: pr.GetBase().GetSHA(),
+	}, nil
+}
+
+// FetchFileDiffs returns the files a pull request changes at headSHA, up to the MaxPullRequestFiles GitHub
+// lists. Like GitHub's pull request diff, the files are compared from the merge base. GitHub lists the
+// files at the current head of the pull request, so ErrPullRequestHeadMoved is returned if the head moved
+// away from headSHA.
+func (c *GithubClient) FetchFileDiffs(ctx context.Context, repoName, repoOwner string, prNumber uint, headSHA string) ([]*GithubPullRequestFileChanges, error) {
+	opts := &github.ListOptions{PerPage: 100}
+
+	var files []*github.CommitFile
+	for {
+		page, resp, err := c.client.PullRequests.ListFiles(ctx, repoOwner, repoName, int(prNumber), opts)
+		if err != nil {
+			return nil, githubError(err)
+		}
+		files = append(files, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
 
-	files, _, err := c.client.PullRequests.ListFiles(ctx, repoOwner, repoName, int(prNumber), nil)
+	refs, err := c.GetPullRequestRefs(ctx, repoName, repoOwner, prNumber)
 	if err != nil {
 		return nil, err
 	}
+	if refs.HeadSHA != headSHA {
+		return nil, fmt.Errorf("%w: expected %s, found %s", ErrPullRequestHeadMoved, headSHA, refs.HeadSHA)
+	}
+
+	return toFileChanges(files), nil
+}
+
+// CompareFileDiffs returns the files changed between two commits, along with how headSHA relates to
+// baseSHA: "ahead", "behind", "diverged" or "identical". GitHub lists up to MaxComparisonFiles files of
+// a comparison; Truncated is set when the comparison may have more.
+func (c *GithubClient) CompareFileDiffs(ctx context.Context, repoName, repoOwner, baseSHA, headSHA string) (*GithubComparison, error) {
+	comparison, _, err := c.client.Repositories.CompareCommits(ctx, repoOwner, repoName, baseSHA, headSHA, nil)
+	if err != nil {
+		return nil, githubError(err)
+	}
+
+	return &GithubComparison{
+		Status:       comparison.GetStatus(),
+		MergeBaseSHA: comparison.GetMergeBaseCommit().GetSHA(),
+		Files:        toFileChanges(comparison.Files),
+		Truncated:    len(comparison.Files) >= MaxComparisonFiles,
+	}, nil
+}
+
+// GetMergeBase returns the commit from which headSHA diverged from baseSHA, which is the base version of
+// the files of a pull request diff
+func (c *GithubClient) GetMergeBase(ctx context.Context, repoName, repoOwner, baseSHA, headSHA string) (string, error) {
+	comparison, _, err := c.client.Repositories.CompareCommits(ctx, repoOwner, repoName, baseSHA, headSHA, &github.ListOptions{PerPage: 1})
+	if err != nil {
+		return "", githubError(err)
+	}
+
+	return comparison.GetMergeBaseCommit().GetSHA(), nil
+}
+
+// GetFileContent returns the content of a file at a commit. It returns ErrFileNotFound if the file does not
+// exist at the commit, and ErrFileTooLarge without downloading the file if it is larger than maxBytes.
+// Files over the 1 MB the contents API serves are downloaded as blobs.
+func (c *GithubClient) GetFileContent(ctx context.Context, repoName, repoOwner, path, ref string, maxBytes int) ([]byte, error) {
+	file, _, resp, err := c.client.Repositories.GetContents(ctx, repoOwner, repoName, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, ErrFileNotFound
+		}
+		return nil, githubError(err)
+	}
+	if file == nil || file.GetType() != "file" {
+		return nil, ErrFileNotFound
+	}
+	if file.GetSize() > maxBytes {
+		return nil, ErrFileTooLarge
+	}
+
+	if file.GetEncoding() == "none" {
+		content, _, err := c.client.Git.GetBlobRaw(ctx, repoOwner, repoName, file.GetSHA())
+		if err != nil {
+			return nil, githubError(err)
+		}
+		return content, nil
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode content of %s: %v", path, err)
+	}
+	return []byte(content), nil
+}
+
+// PublishReview publishes a review of commitSHA to a pull request and returns the ID of the GitHub review.
+// If githubReviewID is set, or the pull request already has a review with the marker of review, that
+// review is updated instead: its body is replaced and its comments are edited by anchor. GitHub does not
+// allow adding comments to a submitted review, so new comments are dropped.
+func (c *GithubClient) PublishReview(ctx context.Context, repoName, repoOwner string, prNumber uint, commitSHA string, review *GithubReview, githubReviewID int64) (int64, error) {
+	if githubReviewID == 0 && review.Marker != "" {
+		var err error
+		githubReviewID, err = c.findReview(ctx, repoName, repoOwner, prNumber, review.Marker)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if githubReviewID == 0 {
+		comments := make([]*github.DraftReviewComment, 0, len(review.Comments))
+		for _, comment := range review.Comments {
+			draft := &github.DraftReviewComment{
+				Path: github.String(comment.Path),
+				Body: github.String(comment.Body),
+			}
+			if comment.Line == 0 {
+				draft.Position = github.Int(comment.Position)
+			} else {
+				draft.Side = github.String(comment.Side)
+				draft.Line = github.Int(comment.Line)
+				if comment.StartLine != 0 && comment.StartLine != comment.Line {
+					draft.StartSide = github.String(comment.Side)
+					draft.StartLine = github.Int(comment.StartLine)
+				}
+			}
+			comments = append(comments, draft)
+		}
+
+		published, _, err := c.client.PullRequests.CreateReview(ctx, repoOwner, repoName, int(prNumber), &github.PullRequestReviewRequest{
+			CommitID: github.String(commitSHA),
+			Body:     github.String(review.body()),
+			Event:    github.String("COMMENT"),
+			Comments: comments,
+		})
+		if err != nil {
+			return 0, githubError(err)
+		}
+		return published.GetID(), nil
+	}
+
+	if _, _, err := c.client.PullRequests.UpdateReview(ctx, repoOwner, repoName, int(prNumber), githubReviewID, review.body()); err != nil {
+		return 0, githubError(err)
+	}
+
+	bodies := make(map[string]string, len(review.Comments))
+	for _, comment := range review.Comments {
+		bodies[comment.key()] = comment.Body
+	}
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		existing, resp, err := c.client.PullRequests.ListReviewComments(ctx, repoOwner, repoName, int(prNumber), githubReviewID, opts)
+		if err != nil {
+			return 0, githubError(err)
+		}
+
+		for _, comment := range existing {
+			anchor := &GithubReviewComment{
+				Path:     comment.GetPath(),
+				Position: comment.GetOriginalPosition(),
+				Side:     comment.GetSide(),
+				Line:     comment.GetOriginalLine(),
+			}
+			body, ok := bodies[anchor.key()]
+			if !ok {
+				anchor.Line = 0
+				body, ok = bodies[anchor.key()]
+			}
+			if !ok || body == comment.GetBody() {
+				continue
+			}
+			if _, _, err := c.client.PullRequests.EditComment(ctx, repoOwner, repoName, comment.GetID(), &github.PullRequestComment{Body: github.String(body)}); err != nil {
+				return 0, githubError(err)
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return githubReviewID, nil
+}
+
+// findReview returns the ID of the review of a pull request whose body holds marker, or 0 if there is
+// none. Anyone taking part in the pull request can put the marker in a review, so only reviews by the
+// account the client is authenticated as are considered.
+func (c *GithubClient) findReview(ctx context.Context, repoName, repoOwner string, prNumber uint, marker string) (int64, error) {
+	authored, err := c.authoredBy(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := c.client.PullRequests.ListReviews(ctx, repoOwner, repoName, int(prNumber), opts)
+		if err != nil {
+			return 0, githubError(err)
+		}
+		for _, review := range reviews {
+			if authored(review.GetUser()) && strings.Contains(review.GetBody(), "<!-- "+marker+" -->") {
+				return review.GetID(), nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return 0, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// authoredBy returns a function reporting whether a GitHub user is the account the client is
+// authenticated as: the bot user of the app for installation clients, and the user of the token otherwise
+func (c *GithubClient) authoredBy(ctx context.Context) (func(user *github.User) bool, error) {
+	if c.app != nil {
+		botLogin, err := c.app.BotLogin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return func(user *github.User) bool {
+			return strings.EqualFold(user.GetLogin(), botLogin) && user.GetType() == "Bot"
+		}, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.user == nil {
+		user, _, err := c.client.Users.Get(ctx, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch authenticated GitHub user: %w", githubError(err))
+		}
+		c.user = user
+	}
+	userID := c.user.GetID()
+	return func(user *github.User) bool {
+		return user.GetID() == userID
+	}, nil
+}
+
+// githubBaseURL parses the URL of a GitHub API server into a base URL for go-github, which requires a
+// trailing slash
+func githubBaseURL(apiURL string) (*url.URL, error) {
+	return url.Parse(strings.TrimSuffix(apiURL, "/") + "/")
+}
 
+func toFileChanges(files []*github.CommitFile) []*GithubPullRequestFileChanges {
 	var fc []*GithubPullRequestFileChanges
 	for _, file := range files {
 		diff := &GithubPullRequestFileChanges{
-			Filename:  *file.Filename,
-			Patch:     SafeString(file.Patch, "Cannot display patch for binary file"),
-			Additions: *file.Additions,
-			Deletions: *file.Deletions,
-			Changes:   *file.Changes,
+			Filename:         file.GetFilename(),
+			PreviousFilename: file.GetPreviousFilename(),
+			Status:           file.GetStatus(),
+			SHA:              file.GetSHA(),
+			RawURL:           file.GetRawURL(),
+			Language:         DetectLanguage(file.GetFilename()),
+			Class:            ClassifyFile(file.GetFilename()),
+			Patch:            file.GetPatch(),
+			Additions:        file.GetAdditions(),
+			Deletions:        file.GetDeletions(),
+			Changes:          file.GetChanges(),
 		}
 		fc = append(fc, diff)
 	}
 
-	return fc, nil
+	return fc
 }
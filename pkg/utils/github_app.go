@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/go-github/v64/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// githubAppJWTLifetime is how long a JWT of the app is valid. GitHub accepts at most 10 minutes.
+	githubAppJWTLifetime = 9 * time.Minute
+	// githubAppClockDrift backdates the JWTs of the app to allow for clock drift between us and GitHub
+	githubAppClockDrift = time.Minute
+	// installationTokenRefreshMargin is how long before it expires an installation token is replaced
+	installationTokenRefreshMargin = 5 * time.Minute
+)
+
+// ErrGithubAppNotInstalled is returned when the GitHub App is not installed on a repository
+var ErrGithubAppNotInstalled = errors.New("GitHub App is not installed on the repository")
+
+// GithubApp authenticates as a GitHub App. It signs JWTs with the app's private key and exchanges them
+// for installation access tokens, which are cached until shortly before they expire.
+type GithubApp struct {
+	appID      int64
+	privateKey *rsa.PrivateKey
+	client     *github.Client
+
+	mutex    sync.Mutex
+	tokens   map[int64]*oauth2.Token
+	botLogin string
+}
+
+// NewGithubApp creates a GitHub App from its ID and PEM encoded private key. An empty apiURL defaults
+// to api.github.com.
+func NewGithubApp(appID int64, privateKeyPEM []byte, apiURL string) (*GithubApp, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %v", err)
+	}
+
+	app := &GithubApp{
+		appID:      appID,
+		privateKey: privateKey,
+		tokens:     make(map[int64]*oauth2.Token),
+	}
+
+	app.client = github.NewClient(&http.Client{Transport: &githubAppTransport{app: app, base: newRateLimitTransport(http.DefaultTransport)}})
+	if apiURL != "" {
+		baseURL, err := githubBaseURL(apiURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub API URL: %v", err)
+		}
+		app.client.BaseURL = baseURL
+	}
+
+	return app, nil
+}
+
+// FindRepositoryInstallation returns the ID of the installation of the app on a repository, or
+// ErrGithubAppNotInstalled if the app is not installed on it
+func (a *GithubApp) FindRepositoryInstallation(ctx context.Context, repoName, repoOwner string) (int64, error) {
+	installation, resp, err := a.client.Apps.FindRepositoryInstallation(ctx, repoOwner, repoName)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return 0, ErrGithubAppNotInstalled
+		}
+		return 0, githubError(err)
+	}
+
+	return installation.GetID(), nil
+}
+
+// InstallationToken returns an access token of an installation of the app, reusing the cached token
+// until shortly before it expires
+func (a *GithubApp) InstallationToken(ctx context.Context, installationID int64) (*oauth2.Token, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if token, ok := a.tokens[installationID]; ok && time.Until(token.Expiry) > installationTokenRefreshMargin {
+		return token, nil
+	}
+
+	installationToken, _, err := a.client.Apps.CreateInstallationToken(ctx, installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token for installation %d: %w", installationID, githubError(err))
+	}
+
+	token := &oauth2.Token{
+		AccessToken: installationToken.GetToken(),
+		TokenType:   "token",
+		Expiry:      installationToken.GetExpiresAt().Time,
+	}
+	a.tokens[installationID] = token
+
+	return token, nil
+}
+
+// BotLogin returns the login of the bot user the installations of the app act as
+func (a *GithubApp) BotLogin(ctx context.Context) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.botLogin != "" {
+		return a.botLogin, nil
+	}
+
+	app, _, err := a.client.Apps.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch GitHub App: %w", githubError(err))
+	}
+	a.botLogin = app.GetSlug() + "[bot]"
+
+	return a.botLogin, nil
+}
+
+// NewGithubClientForInstallation creates a GitHub client authenticated as an installation of the app.
+// The installation token is renewed whenever it is about to expire.
+func NewGithubClientForInstallation(ctx context.Context, app *GithubApp, installationID int64) (*GithubClient, error) {
+	client := GithubClient{app: app}
+
+	ts := &installationTokenSource{app: app, installationID: installationID}
+	if err := client.connect(ctx, ts, fmt.Sprintf("installation:%d", installationID)); err != nil {
+		return nil, fmt.Errorf("failed to initialize GitHub client for installation %d: %v", installationID, err)
+	}
+
+	return &client, nil
+}
+
+// jwt signs a JWT identifying the app, as required by the GitHub App endpoints
+func (a *GithubApp) jwt() (string, error) {
+	now := time.Now()
+	claims := &jwt.StandardClaims{
+		Issuer:    strconv.FormatInt(a.appID, 10),
+		IssuedAt:  now.Add(-githubAppClockDrift).Unix(),
+		ExpiresAt: now.Add(githubAppJWTLifetime).Unix(),
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(a.privateKey)
+}
+
+// githubAppTransport authenticates requests as the app itself
+type githubAppTransport struct {
+	app  *GithubApp
+	base http.RoundTripper
+}
+
+func (t *githubAppTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.app.jwt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign GitHub App JWT: %v", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// installationTokenSource supplies the cached access token of an installation
+type installationTokenSource struct {
+	app            *GithubApp
+	installationID int64
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	return s.app.InstallationToken(context.Background(), s.installationID)
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxCachedBodySize is the largest GitHub response body that is cached
+const maxCachedBodySize = 10 << 20
+
+// GithubCacheEntry is a cached GitHub response, along with the validators to revalidate it with
+type GithubCacheEntry struct {
+	ETag         string
+	LastModified string
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+}
+
+// GithubCache stores GitHub responses for conditional requests. Get returns nil if a key is not cached.
+type GithubCache interface {
+	Get(ctx context.Context, key string) (*GithubCacheEntry, error)
+	Set(ctx context.Context, key string, entry *GithubCacheEntry) error
+}
+
+var githubCache GithubCache
+
+// SetGithubCache makes all GitHub clients send conditional requests and serve unchanged responses from
+// cache. GitHub does not count 304 responses against the rate limit. It must be called before any client
+// is created; a nil cache disables caching.
+func SetGithubCache(cache GithubCache) {
+	githubCache = cache
+}
+
+// cachingTransport revalidates GET requests with the ETag or Last-Modified of the cached response, and
+// serves the cached response when GitHub answers 304 Not Modified. It sits beneath the OAuth2 transport
+// and keys entries by namespace, so that a response is never served to another credential.
+type cachingTransport struct {
+	base      http.RoundTripper
+	cache     GithubCache
+	namespace string
+}
+
+// newCachingTransport returns base unchanged if caching is disabled
+func newCachingTransport(base http.RoundTripper, namespace string) http.RoundTripper {
+	if githubCache == nil {
+		return base
+	}
+	return &cachingTransport{base: base, cache: githubCache, namespace: namespace}
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := t.key(req)
+	entry, err := t.cache.Get(req.Context(), key)
+	if err != nil {
+		log.Printf("Could not read GitHub cache: %v", err)
+		entry = nil
+	}
+
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return cachedResponse(req, resp, entry), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || (resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "") {
+		return resp, nil
+	}
+	if resp.ContentLength > maxCachedBodySize {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBodySize+1))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) > maxCachedBodySize {
+		return resp, nil
+	}
+
+	if err := t.cache.Set(req.Context(), key, &GithubCacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+	}); err != nil {
+		log.Printf("Could not write GitHub cache: %v", err)
+	}
+
+	return resp, nil
+}
+
+// key identifies a request within the namespace of the client. The Accept header is part of the key,
+// since GitHub serves e.g. diffs and JSON from the same URL.
+func (t *cachingTransport) key(req *http.Request) string {
+	hash := sha256.Sum256([]byte(t.namespace + "\n" + req.Header.Get("Accept") + "\n" + req.URL.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+// cachedResponse builds the response to a revalidated request from the cache, keeping the rate limit
+// headers of the 304 response
+func cachedResponse(req *http.Request, notModified *http.Response, entry *GithubCacheEntry) *http.Response {
+	header := entry.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	for name, values := range notModified.Header {
+		if strings.HasPrefix(name, "X-Ratelimit-") {
+			header[name] = values
+		}
+	}
+	header.Set("X-From-Cache", "1")
+
+	return &http.Response{
+		Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+// MemoryGithubCache is a GithubCache held in memory. When it holds more than its maximum number of
+// entries or bytes, the least recently used entries are evicted.
+type MemoryGithubCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxBytes   int
+	size       int
+	entries    map[string]*list.Element
+	// recent orders the entries from most to least recently used
+	recent *list.List
+}
+
+type memoryGithubCacheEntry struct {
+	key   string
+	entry *GithubCacheEntry
+	size  int
+}
+
+// NewMemoryGithubCache creates an in-memory GitHub cache of at most maxEntries responses taking up at
+// most maxBytes. Non-positive limits are not enforced.
+func NewMemoryGithubCache(maxEntries, maxBytes int) *MemoryGithubCache {
+	return &MemoryGithubCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+func (c *MemoryGithubCache) Get(ctx context.Context, key string) (*GithubCacheEntry, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	c.recent.MoveToFront(element)
+
+	return element.Value.(*memoryGithubCacheEntry).entry, nil
+}
+
+func (c *MemoryGithubCache) Set(ctx context.Context, key string, entry *GithubCacheEntry) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	size := cacheEntrySize(key, entry)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return nil
+	}
+
+	c.entries[key] = c.recent.PushFront(&memoryGithubCacheEntry{key: key, entry: entry, size: size})
+	c.size += size
+
+	for (c.maxEntries > 0 && len(c.entries) > c.maxEntries) || (c.maxBytes > 0 && c.size > c.maxBytes) {
+		c.remove(c.recent.Back())
+	}
+
+	return nil
+}
+
+func (c *MemoryGithubCache) remove(element *list.Element) {
+	cached := c.recent.Remove(element).(*memoryGithubCacheEntry)
+	delete(c.entries, cached.key)
+	c.size -= cached.size
+}
+
+// cacheEntrySize approximates the memory an entry takes up by the length of its key, body and headers
+func cacheEntrySize(key string, entry *GithubCacheEntry) int {
+	size := len(key) + len(entry.ETag) + len(entry.LastModified) + len(entry.Body)
+	for name, values := range entry.Header {
+		size += len(name)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMemoryGithubCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	body := func(n int) *GithubCacheEntry {
+		return &GithubCacheEntry{Body: []byte(strings.Repeat("x", n))}
+	}
+	cached := func(cache *MemoryGithubCache, key string) bool {
+		entry, _ := cache.Get(ctx, key)
+		return entry != nil
+	}
+
+	// every entry takes up one byte for its key and 99 for its body
+	cache := NewMemoryGithubCache(0, 300)
+	_ = cache.Set(ctx, "a", body(99))
+	_ = cache.Set(ctx, "b", body(99))
+	_ = cache.Set(ctx, "c", body(99))
+	cached(cache, "a")
+	_ = cache.Set(ctx, "d", body(99))
+	if !cached(cache, "a") || cached(cache, "b") || !cached(cache, "c") || !cached(cache, "d") {
+		t.Errorf("expected b to be evicted as least recently used")
+	}
+
+	_ = cache.Set(ctx, "e", body(199))
+	if cached(cache, "c") || cached(cache, "a") || !cached(cache, "d") || !cached(cache, "e") {
+		t.Errorf("expected a and c to be evicted to make room for e")
+	}
+	if cache.size != 300 {
+		t.Errorf("cache holds %d bytes, want 300", cache.size)
+	}
+
+	_ = cache.Set(ctx, "f", body(300))
+	if cached(cache, "f") || !cached(cache, "d") {
+		t.Errorf("expected an entry larger than the cache not to be cached")
+	}
+
+	cache = NewMemoryGithubCache(2, 0)
+	_ = cache.Set(ctx, "a", body(1))
+	_ = cache.Set(ctx, "b", body(1))
+	_ = cache.Set(ctx, "a", body(2))
+	_ = cache.Set(ctx, "c", body(1))
+	if !cached(cache, "a") || cached(cache, "b") || !cached(cache, "c") {
+		t.Errorf("expected b to be evicted once the cache holds more than 2 entries")
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v64/github"
+	"golang.org/x/oauth2"
+)
+
+// GithubOAuthScopes are the scopes requested when signing in with GitHub: private repositories and
+// the user's verified email addresses
+var GithubOAuthScopes = []string{"repo", "read:user", "user:email"}
+
+// GithubUser is the GitHub account of a user signing in with GitHub
+type GithubUser struct {
+	ID    int64
+	Login string
+	Email string
+}
+
+// GithubOAuth runs the OAuth authorization code flow against GitHub, or any server implementing the
+// same endpoints
+type GithubOAuth struct {
+	config *oauth2.Config
+	apiURL string
+}
+
+// NewGithubOAuth creates a new GitHub OAuth flow. Empty URLs default to github.com.
+func NewGithubOAuth(clientID, clientSecret, redirectURL, authURL, tokenURL, apiURL string) *GithubOAuth {
+	if authURL == "" {
+		authURL = "https://github.com/login/oauth/authorize"
+	}
+	if tokenURL == "" {
+		tokenURL = "https://github.com/login/oauth/access_token"
+	}
+
+	return &GithubOAuth{
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       GithubOAuthScopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  authURL,
+				TokenURL: tokenURL,
+			},
+		},
+		apiURL: apiURL,
+	}
+}
+
+// Configured reports whether a client ID and secret are set
+func (o *GithubOAuth) Configured() bool {
+	return o.config.ClientID != "" && o.config.ClientSecret != ""
+}
+
+// AuthCodeURL returns the URL to send the user to for authorizing the app
+func (o *GithubOAuth) AuthCodeURL(state string) string {
+	return o.config.AuthCodeURL(state)
+}
+
+// Exchange exchanges an authorization code for an access token
+func (o *GithubOAuth) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return o.config.Exchange(ctx, code)
+}
+
+// Refresh exchanges a refresh token for a new access token. The returned token holds the refresh token
+// to use next time, since GitHub rotates refresh tokens.
+func (o *GithubOAuth) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return o.config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+}
+
+// GetUser returns the account the access token belongs to, with its primary email address if verified
+func (o *GithubOAuth) GetUser(ctx context.Context, token *oauth2.Token) (*GithubUser, error) {
+	client := github.NewClient(o.config.Client(ctx, token))
+	if o.apiURL != "" {
+		baseURL, err := githubBaseURL(o.apiURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub API URL: %v", err)
+		}
+		client.BaseURL = baseURL
+	}
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	githubUser := &GithubUser{
+		ID:    user.GetID(),
+		Login: user.GetLogin(),
+	}
+
+	emails, _, err := client.Users.ListEmails(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		if email.GetPrimary() && email.GetVerified() {
+			githubUser.Email = email.GetEmail()
+		}
+	}
+
+	return githubUser, nil
+}
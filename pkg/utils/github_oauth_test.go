@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newFakeOAuthServer serves the authorize, token and user endpoints of GitHub for a single account. The
+// authorize endpoint grants access right away.
+func newFakeOAuthServer(t *testing.T, emails []map[string]interface{}) *httptest.Server {
+	const code, accessToken = "the-code", "the-token"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != "client" {
+			t.Errorf("authorize got client ID %q", query.Get("client_id"))
+		}
+		if query.Get("scope") != "repo read:user user:email" {
+			t.Errorf("authorize got scopes %q", query.Get("scope"))
+		}
+		redirectURL, err := url.Parse(query.Get("redirect_uri"))
+		if err != nil {
+			t.Fatalf("invalid redirect URL: %v", err)
+		}
+		redirectURL.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientID, clientSecret = r.FormValue("client_id"), r.FormValue("client_secret")
+		}
+		if clientID == "client" && clientSecret == "secret" && r.FormValue("grant_type") == "refresh_token" && r.FormValue("refresh_token") == "the-refresh-token" {
+			writeJSON(w, map[string]interface{}{"access_token": accessToken, "token_type": "bearer", "refresh_token": "the-next-refresh-token", "expires_in": 28800})
+			return
+		}
+		if clientID != "client" || clientSecret != "secret" || r.FormValue("code") != code {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"access_token": accessToken, "token_type": "bearer", "scope": "repo,read:user,user:email"})
+	})
+	authorized := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+accessToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				writeJSON(w, map[string]string{"message": "Bad credentials"})
+				return
+			}
+			handler(w, r)
+		}
+	}
+	mux.HandleFunc("GET /user", authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"id": 1234, "login": "octocat"})
+	}))
+	mux.HandleFunc("GET /user/emails", authorized(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(emails)
+	}))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// authorize follows the authorize URL of an OAuth flow and returns the code and state of the redirect
+func authorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("could not authorize: %v", err)
+	}
+	defer resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize did not redirect: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestGithubOAuthFlow(t *testing.T) {
+	tests := []struct {
+		name      string
+		emails    []map[string]interface{}
+		wantEmail string
+	}{
+		{
+			name: "verified primary email",
+			emails: []map[string]interface{}{
+				{"email": "other@example.com", "primary": false, "verified": true},
+				{"email": "octocat@example.com", "primary": true, "verified": true},
+			},
+			wantEmail: "octocat@example.com",
+		},
+		{
+			name: "unverified primary email",
+			emails: []map[string]interface{}{
+				{"email": "victim@example.com", "primary": true, "verified": false},
+				{"email": "other@example.com", "primary": false, "verified": true},
+			},
+			wantEmail: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeOAuthServer(t, tt.emails)
+			ctx := context.Background()
+			oauth := NewGithubOAuth("client", "secret", "http://localhost/callback", server.URL+"/login/oauth/authorize", server.URL+"/login/oauth/access_token", server.URL)
+
+			code, state := authorize(t, oauth.AuthCodeURL("the-state"))
+			if state != "the-state" {
+				t.Errorf("authorize returned state %q, want the-state", state)
+			}
+
+			token, err := oauth.Exchange(ctx, code)
+			if err != nil {
+				t.Fatalf("could not exchange code: %v", err)
+			}
+
+			githubUser, err := oauth.GetUser(ctx, token)
+			if err != nil {
+				t.Fatalf("could not fetch user: %v", err)
+			}
+			if githubUser.ID != 1234 || githubUser.Login != "octocat" || githubUser.Email != tt.wantEmail {
+				t.Errorf("GetUser() = %+v, want 1234, octocat and %q", githubUser, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestGithubOAuthRefresh(t *testing.T) {
+	server := newFakeOAuthServer(t, nil)
+	oauth := NewGithubOAuth("client", "secret", "http://localhost/callback", server.URL+"/login/oauth/authorize", server.URL+"/login/oauth/access_token", server.URL)
+
+	token, err := oauth.Refresh(context.Background(), "the-refresh-token")
+	if err != nil {
+		t.Fatalf("could not refresh token: %v", err)
+	}
+	if token.AccessToken != "the-token" || token.RefreshToken != "the-next-refresh-token" || token.Expiry.IsZero() {
+		t.Errorf("Refresh() = %+v, want a new access token, refresh token and expiry", token)
+	}
+
+	if _, err := oauth.Refresh(context.Background(), "revoked-refresh-token"); err == nil {
+		t.Error("Refresh() accepted an unknown refresh token")
+	}
+}
+
+func TestGithubOAuthExchangeRejectsUnknownCode(t *testing.T) {
+	server := newFakeOAuthServer(t, nil)
+	oauth := NewGithubOAuth("client", "secret", "http://localhost/callback", server.URL+"/login/oauth/authorize", server.URL+"/login/oauth/access_token", server.URL)
+
+	if _, err := oauth.Exchange(context.Background(), "forged-code"); err == nil {
+		t.Error("Exchange() accepted an unknown code")
+	}
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+)
+
+const (
+	defaultGithubMaxConcurrentRequests = 8
+	defaultGithubMaxRateLimitWait      = 10 * time.Second
+	// defaultSecondaryRateLimitWait is how long to back off from a secondary rate limit without a
+	// Retry-After header, as recommended by GitHub
+	defaultSecondaryRateLimitWait = time.Minute
+	// maxSecondaryRateLimitRetries is how often a request is retried after hitting a secondary rate limit
+	maxSecondaryRateLimitRetries = 3
+)
+
+var (
+	githubRequestSlots     = make(chan struct{}, defaultGithubMaxConcurrentRequests)
+	githubMaxRateLimitWait = defaultGithubMaxRateLimitWait
+)
+
+// ConfigureGithubRequests bounds the number of concurrent GitHub requests of all clients, and sets how
+// long a request may wait out a secondary rate limit before failing. It must be called before any
+// client is created; non-positive values keep the defaults.
+func ConfigureGithubRequests(maxConcurrentRequests int, maxRateLimitWait time.Duration) {
+	if maxConcurrentRequests > 0 {
+		githubRequestSlots = make(chan struct{}, maxConcurrentRequests)
+	}
+	if maxRateLimitWait > 0 {
+		githubMaxRateLimitWait = maxRateLimitWait
+	}
+}
+
+// RateLimitedError is returned when GitHub rate limits a request. It can be retried at RetryAt.
+type RateLimitedError struct {
+	RetryAt time.Time
+	// Secondary reports whether a secondary rate limit was hit rather than the hourly quota
+	Secondary bool
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("GitHub rate limit exceeded, retry at %s", e.RetryAt.Format(time.RFC3339))
+}
+
+// githubError turns the rate limit errors of go-github into a RateLimitedError and returns other
+// errors unchanged
+func githubError(err error) error {
+	var rateLimitErr *github.RateLimitError
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	var errorResponse *github.ErrorResponse
+
+	switch {
+	case errors.As(err, &rateLimitErr):
+		return &RateLimitedError{RetryAt: rateLimitErr.Rate.Reset.Time}
+	case errors.As(err, &abuseRateLimitErr):
+		wait := defaultSecondaryRateLimitWait
+		if abuseRateLimitErr.RetryAfter != nil {
+			wait = *abuseRateLimitErr.RetryAfter
+		}
+		return &RateLimitedError{RetryAt: time.Now().Add(wait), Secondary: true}
+	case errors.As(err, &errorResponse) && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusTooManyRequests:
+		wait, ok := retryAfter(errorResponse.Response)
+		if !ok {
+			wait = defaultSecondaryRateLimitWait
+		}
+		return &RateLimitedError{RetryAt: time.Now().Add(wait), Secondary: true}
+	default:
+		return err
+	}
+}
+
+// rateLimitTransport bounds the number of concurrent GitHub requests, and retries requests that hit a
+// secondary rate limit when GitHub asks to wait no longer than githubMaxRateLimitWait. Primary rate
+// limits are left to go-github, which stops sending requests until the quota resets.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+func newRateLimitTransport(base http.RoundTripper) *rateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{
+		base:    base,
+		slots:   githubRequestSlots,
+		maxWait: githubMaxRateLimitWait,
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.roundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		wait, limited := secondaryRateLimitWait(resp, attempt)
+		if !limited || wait > t.maxWait || attempt >= maxSecondaryRateLimitRetries {
+			return resp, nil
+		}
+
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		// drain the body so that the connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTrip sends a request once a request slot is free
+func (t *rateLimitTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if err := acquire(req.Context(), t.slots); err != nil {
+		return nil, err
+	}
+	defer func() { <-t.slots }()
+
+	return t.base.RoundTrip(req)
+}
+
+func acquire(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// secondaryRateLimitWait returns how long to wait before retrying a response that hit a secondary rate
+// limit. Responses that exhausted the primary rate limit are not retried.
+func secondaryRateLimitWait(resp *http.Response, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		return 0, false
+	}
+
+	if wait, ok := retryAfter(resp); ok {
+		return wait, true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return time.Second << uint(attempt), true
+	}
+
+	// a 403 without Retry-After is a permission error, not a rate limit
+	return 0, false
+}
+
+// retryAfter reads the Retry-After header of a response, in seconds
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
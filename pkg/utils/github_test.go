@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeReviewsServer serves the review endpoints of a single pull request o/r#1 to the user with ID 1.
+// Reviews with an ID below 42 are by another user.
+type fakeReviewsServer struct {
+	mu       sync.Mutex
+	reviews  map[int64]string
+	comments map[int64]map[string]interface{}
+	created  int
+	updated  int
+	edited   int
+}
+
+func newFakeReviewsServer(t *testing.T) *fakeReviewsServer {
+	s := &fakeReviewsServer{
+		reviews:  map[int64]string{},
+		comments: map[int64]map[string]interface{}{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"id": 1, "login": "approved"})
+	})
+	mux.HandleFunc("GET /repos/o/r/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var reviews []map[string]interface{}
+		for id, body := range s.reviews {
+			user := map[string]interface{}{"id": 1, "login": "approved"}
+			if id < 42 {
+				user = map[string]interface{}{"id": 2, "login": "mallory"}
+			}
+			reviews = append(reviews, map[string]interface{}{"id": id, "body": body, "user": user})
+		}
+		writeJSON(w, reviews)
+	})
+	mux.HandleFunc("POST /repos/o/r/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Body     string `json:"body"`
+			Comments []struct {
+				Path string `json:"path"`
+				Side string `json:"side"`
+				Line int    `json:"line"`
+				Body string `json:"body"`
+			} `json:"comments"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("could not decode created review: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.created++
+		id := int64(41 + s.created)
+		s.reviews[id] = req.Body
+		for i, comment := range req.Comments {
+			s.comments[int64(100+i)] = map[string]interface{}{
+				"id":            100 + i,
+				"path":          comment.Path,
+				"side":          comment.Side,
+				"original_line": comment.Line,
+				"body":          comment.Body,
+			}
+		}
+		writeJSON(w, map[string]interface{}{"id": id, "body": req.Body})
+	})
+	mux.HandleFunc("PUT /repos/o/r/pulls/1/reviews/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("could not decode updated review: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.reviews[42]; !ok || r.PathValue("id") != "42" {
+			http.NotFound(w, r)
+			return
+		}
+		s.updated++
+		s.reviews[42] = req.Body
+		writeJSON(w, map[string]interface{}{"id": 42, "body": req.Body})
+	})
+	mux.HandleFunc("GET /repos/o/r/pulls/1/reviews/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var comments []map[string]interface{}
+		for _, comment := range s.comments {
+			comments = append(comments, comment)
+		}
+		writeJSON(w, comments)
+	})
+	mux.HandleFunc("PATCH /repos/o/r/pulls/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("could not decode edited comment: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, comment := range s.comments {
+			if r.PathValue("id") == "100" && comment["id"] == 100 {
+				s.edited++
+				comment["body"] = req.Body
+				writeJSON(w, comment)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("GITHUB_API_URL", server.URL)
+
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestPublishReviewCreatesThenUpdates(t *testing.T) {
+	server := newFakeReviewsServer(t)
+	ctx := context.Background()
+	// a review by someone else holding the marker is not taken for ours
+	server.reviews[7] = "planted\n<!-- approved-review-7 -->"
+
+	client, err := NewGithubClientWithToken(ctx, "token")
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+
+	review := &GithubReview{
+		Body:   "first",
+		Marker: "approved-review-7",
+		Comments: []*GithubReviewComment{
+			{Path: "main.go", Side: "RIGHT", Line: 3, Body: "first comment"},
+		},
+	}
+
+	githubReviewID, err := client.PublishReview(ctx, "r", "o", 1, "abc", review, 0)
+	if err != nil {
+		t.Fatalf("could not create review: %v", err)
+	}
+	if githubReviewID != 42 {
+		t.Fatalf("created review %d, want 42", githubReviewID)
+	}
+	if !strings.Contains(server.reviews[42], "<!-- approved-review-7 -->") {
+		t.Errorf("created review body %q does not hold the marker", server.reviews[42])
+	}
+
+	review.Body = "second"
+	review.Comments[0].Body = "second comment"
+	githubReviewID, err = client.PublishReview(ctx, "r", "o", 1, "abc", review, githubReviewID)
+	if err != nil {
+		t.Fatalf("could not update review: %v", err)
+	}
+	if githubReviewID != 42 {
+		t.Errorf("updated review %d, want 42", githubReviewID)
+	}
+	if !strings.HasPrefix(server.reviews[42], "second") || !strings.Contains(server.reviews[42], "<!-- approved-review-7 -->") {
+		t.Errorf("updated review body is %q", server.reviews[42])
+	}
+	if server.comments[100]["body"] != "second comment" {
+		t.Errorf("updated comment body is %q", server.comments[100]["body"])
+	}
+
+	// publishing without the ID, e.g. because storing it failed, finds the review by its marker
+	review.Body = "third"
+	githubReviewID, err = client.PublishReview(ctx, "r", "o", 1, "abc", review, 0)
+	if err != nil {
+		t.Fatalf("could not publish review again: %v", err)
+	}
+	if githubReviewID != 42 {
+		t.Errorf("published review %d, want 42", githubReviewID)
+	}
+	if server.created != 1 || server.updated != 2 || server.edited != 1 {
+		t.Errorf("created %d, updated %d and edited %d, want 1, 2 and 1", server.created, server.updated, server.edited)
+	}
+	if !strings.HasPrefix(server.reviews[7], "planted") {
+		t.Errorf("review by another user was changed to %q", server.reviews[7])
+	}
+}
+
+// newFakeFilesServer serves the files of a pull request o/r#1 changing totalFiles files the way GitHub
+// does: the files of a pull request are paged up to MaxPullRequestFiles, while a comparison lists at most
+// MaxComparisonFiles files, only on its first page
+func newFakeFilesServer(t *testing.T, totalFiles int) {
+	files := func(from, to int) []map[string]interface{} {
+		var files []map[string]interface{}
+		for i := from; i < to && i < totalFiles; i++ {
+			files = append(files, map[string]interface{}{"filename": fmt.Sprintf("file%d.go", i), "status": "modified", "additions": 1})
+		}
+		return files
+	}
+	paging := func(r *http.Request) (int, int) {
+		page, perPage := 1, 30
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		fmt.Sscan(r.URL.Query().Get("per_page"), &perPage)
+		return page, perPage
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"number": 1, "head": map[string]string{"sha": "head"}, "base": map[string]string{"sha": "base"}})
+	})
+	mux.HandleFunc("GET /repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		page, perPage := paging(r)
+		last := min(totalFiles, MaxPullRequestFiles)
+		if page*perPage < last {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d&per_page=%d>; rel="next"`, r.URL.Path, page+1, perPage))
+		}
+		writeJSON(w, files((page-1)*perPage, min(page*perPage, last)))
+	})
+	mux.HandleFunc("GET /repos/o/r/compare/{basehead}", func(w http.ResponseWriter, r *http.Request) {
+		comparison := map[string]interface{}{
+			"status":            "ahead",
+			"merge_base_commit": map[string]interface{}{"sha": "merge-base"},
+		}
+		if page, _ := paging(r); page == 1 {
+			comparison["files"] = files(0, MaxComparisonFiles)
+		}
+		writeJSON(w, comparison)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("GITHUB_API_URL", server.URL)
+}
+
+func TestFetchFileDiffsPaginates(t *testing.T) {
+	newFakeFilesServer(t, MaxPullRequestFiles+5)
+	ctx := context.Background()
+	client, err := NewGithubClientWithToken(ctx, "token")
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+
+	files, err := client.FetchFileDiffs(ctx, "r", "o", 1, "head")
+	if err != nil {
+		t.Fatalf("could not fetch file diffs: %v", err)
+	}
+	if len(files) != MaxPullRequestFiles || files[len(files)-1].Filename != fmt.Sprintf("file%d.go", MaxPullRequestFiles-1) {
+		t.Errorf("FetchFileDiffs() has %d files, want %d", len(files), MaxPullRequestFiles)
+	}
+
+	if _, err := client.FetchFileDiffs(ctx, "r", "o", 1, "old-head"); !errors.Is(err, ErrPullRequestHeadMoved) {
+		t.Errorf("FetchFileDiffs() at a previous head returned %v, want ErrPullRequestHeadMoved", err)
+	}
+}
+
+func TestCompareFileDiffsTruncated(t *testing.T) {
+	tests := []struct {
+		name          string
+		totalFiles    int
+		wantFiles     int
+		wantTruncated bool
+	}{
+		{name: "small comparison", totalFiles: 12, wantFiles: 12},
+		{name: "large comparison", totalFiles: MaxComparisonFiles + 5, wantFiles: MaxComparisonFiles, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newFakeFilesServer(t, tt.totalFiles)
+			ctx := context.Background()
+			client, err := NewGithubClientWithToken(ctx, "token")
+			if err != nil {
+				t.Fatalf("could not create client: %v", err)
+			}
+
+			comparison, err := client.CompareFileDiffs(ctx, "r", "o", "base", "head")
+			if err != nil {
+				t.Fatalf("could not compare commits: %v", err)
+			}
+			if comparison.Status != "ahead" || comparison.MergeBaseSHA != "merge-base" {
+				t.Errorf("CompareFileDiffs() = %s at %s, want ahead at merge-base", comparison.Status, comparison.MergeBaseSHA)
+			}
+			if len(comparison.Files) != tt.wantFiles || comparison.Truncated != tt.wantTruncated {
+				t.Errorf("CompareFileDiffs() has %d files, truncated %v, want %d, %v", len(comparison.Files), comparison.Truncated, tt.wantFiles, tt.wantTruncated)
+			}
+		})
+	}
+}
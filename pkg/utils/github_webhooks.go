@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v64/github"
+)
+
+const (
+	// GithubEventHeader holds the type of a GitHub webhook event
+	GithubEventHeader = "X-GitHub-Event"
+	// GithubSignatureHeader holds the HMAC-SHA256 signature of a GitHub webhook payload
+	GithubSignatureHeader = "X-Hub-Signature-256"
+)
+
+type GithubPullRequestEvent struct {
+	Action      string
+	RepoOwner   string
+	RepoName    string
+	PullRequest *GithubPullRequest
+}
+
+// GithubRepositoryRef identifies a repository by owner and name
+type GithubRepositoryRef struct {
+	Owner string
+	Name  string
+}
+
+// GithubInstallationEvent is an installation or installation_repositories event: the GitHub App was
+// installed, uninstalled, or gained or lost access to repositories. AccountID is the GitHub ID of the user
+// or organization the app is installed on, and SenderID the ID of the user who changed the installation.
+type GithubInstallationEvent struct {
+	Action         string
+	InstallationID int64
+	AccountID      int64
+	SenderID       int64
+	Added          []*GithubRepositoryRef
+	Removed        []*GithubRepositoryRef
+}
+
+// Uninstalled reports whether the installation lost access to all of its repositories
+func (e *GithubInstallationEvent) Uninstalled() bool {
+	return e.Action == "deleted" || e.Action == "suspend"
+}
+
+// ValidateGithubWebhookSignature checks the X-Hub-Signature-256 signature of a webhook payload
+func ValidateGithubWebhookSignature(signature string, payload []byte, secret string) error {
+	return github.ValidateSignature(signature, payload, []byte(secret))
+}
+
+// ParseGithubPullRequestEvent parses the payload of a pull_request webhook event
+func ParseGithubPullRequestEvent(payload []byte) (*GithubPullRequestEvent, error) {
+	event, err := github.ParseWebHook("pull_request", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	prEvent, ok := event.(*github.PullRequestEvent)
+	if !ok || prEvent.PullRequest == nil || prEvent.Repo == nil {
+		return nil, fmt.Errorf("malformed pull_request event")
+	}
+
+	pr := prEvent.PullRequest
+	number := pr.GetNumber()
+	if number < 0 {
+		number = 0
+	}
+
+	return &GithubPullRequestEvent{
+		Action:    prEvent.GetAction(),
+		RepoOwner: prEvent.Repo.GetOwner().GetLogin(),
+		RepoName:  prEvent.Repo.GetName(),
+		PullRequest: &GithubPullRequest{
+			Number:     uint(number),
+			Title:      pr.GetTitle(),
+			URL:        pr.GetURL(),
+			State:      pr.GetState(),
+			LastCommit: pr.GetHead().GetSHA(),
+			UpdatedAt:  pr.GetUpdatedAt().Time,
+		},
+	}, nil
+}
+
+// ParseGithubInstallationEvent parses the payload of an installation or installation_repositories
+// webhook event
+func ParseGithubInstallationEvent(eventType string, payload []byte) (*GithubInstallationEvent, error) {
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e := event.(type) {
+	case *github.InstallationEvent:
+		if e.Installation == nil {
+			return nil, fmt.Errorf("malformed installation event")
+		}
+		installationEvent := &GithubInstallationEvent{
+			Action:         e.GetAction(),
+			InstallationID: e.Installation.GetID(),
+			AccountID:      e.Installation.GetAccount().GetID(),
+			SenderID:       e.GetSender().GetID(),
+		}
+		if !installationEvent.Uninstalled() {
+			installationEvent.Added = toRepositoryRefs(e.Repositories)
+		}
+		return installationEvent, nil
+	case *github.InstallationRepositoriesEvent:
+		if e.Installation == nil {
+			return nil, fmt.Errorf("malformed installation_repositories event")
+		}
+		return &GithubInstallationEvent{
+			Action:         e.GetAction(),
+			InstallationID: e.Installation.GetID(),
+			AccountID:      e.Installation.GetAccount().GetID(),
+			SenderID:       e.GetSender().GetID(),
+			Added:          toRepositoryRefs(e.RepositoriesAdded),
+			Removed:        toRepositoryRefs(e.RepositoriesRemoved),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s event", eventType)
+	}
+}
+
+// toRepositoryRefs reads the repositories of an installation event, which only carry the full name
+func toRepositoryRefs(repos []*github.Repository) []*GithubRepositoryRef {
+	var refs []*GithubRepositoryRef
+	for _, repo := range repos {
+		owner, name, ok := strings.Cut(repo.GetFullName(), "/")
+		if !ok {
+			continue
+		}
+		refs = append(refs, &GithubRepositoryRef{Owner: owner, Name: name})
+	}
+	return refs
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGithubInstallationEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		payload   string
+		want      *GithubInstallationEvent
+		wantErr   bool
+	}{
+		{
+			name:      "installed on an organization",
+			eventType: "installation",
+			payload: `{"action": "created", "installation": {"id": 7, "account": {"id": 100, "login": "org"}},
+				"sender": {"id": 200, "login": "octocat"}, "repositories": [{"full_name": "org/repo"}, {"full_name": "invalid"}]}`,
+			want: &GithubInstallationEvent{
+				Action:         "created",
+				InstallationID: 7,
+				AccountID:      100,
+				SenderID:       200,
+				Added:          []*GithubRepositoryRef{{Owner: "org", Name: "repo"}},
+			},
+		},
+		{
+			name:      "uninstalled",
+			eventType: "installation",
+			payload:   `{"action": "deleted", "installation": {"id": 7, "account": {"id": 100}}, "sender": {"id": 200}, "repositories": [{"full_name": "org/repo"}]}`,
+			want:      &GithubInstallationEvent{Action: "deleted", InstallationID: 7, AccountID: 100, SenderID: 200},
+		},
+		{
+			name:      "repositories changed",
+			eventType: "installation_repositories",
+			payload: `{"action": "added", "installation": {"id": 7, "account": {"id": 100}}, "sender": {"id": 200},
+				"repositories_added": [{"full_name": "org/a"}], "repositories_removed": [{"full_name": "org/b"}]}`,
+			want: &GithubInstallationEvent{
+				Action:         "added",
+				InstallationID: 7,
+				AccountID:      100,
+				SenderID:       200,
+				Added:          []*GithubRepositoryRef{{Owner: "org", Name: "a"}},
+				Removed:        []*GithubRepositoryRef{{Owner: "org", Name: "b"}},
+			},
+		},
+		{
+			name:      "no installation",
+			eventType: "installation",
+			payload:   `{"action": "created"}`,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ParseGithubInstallationEvent(tt.eventType, []byte(tt.payload))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseGithubInstallationEvent() = %+v, want an error", event)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGithubInstallationEvent() failed: %v", err)
+			}
+			if !reflect.DeepEqual(event, tt.want) {
+				t.Errorf("ParseGithubInstallationEvent() = %+v, want %+v", event, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const signaturePrefix = "sha256="
+
+// SignServiceRequest returns the signature of a service-to-service request, computed as the
+// HMAC-SHA256 of the timestamp, method, path and body, each separated by a newline.
+func SignServiceRequest(secret, timestamp, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n"))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyServiceRequest checks the signature of a service-to-service request in constant time
+func VerifyServiceRequest(secret, signature, timestamp, method, path string, body []byte) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	expected := SignServiceRequest(secret, timestamp, method, path, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -17,13 +21,20 @@ func SetJWTKey(key string) {
 	jwtKey = []byte(key)
 }
 
-// CreateJWTToken creates a JWT token with the given user ID
-func CreateJWTToken(userID uint) (string, error) {
-	expirationTime := time.Now().Add(1 * time.Hour)
+// CreateJWTToken creates a JWT token with the given user ID that expires at expiresAt. Each token
+// gets a unique ID (jti), so that it can be revoked before it expires.
+func CreateJWTToken(userID uint, expiresAt time.Time) (string, error) {
+	tokenID, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &JWTClaims{
 		UserID: userID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        tokenID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
 		},
 	}
 
@@ -51,3 +62,18 @@ func ParseJWTToken(token string) (*JWTClaims, error) {
 
 	return claims, nil
 }
+
+// GenerateRandomToken returns n random bytes, URL-safe base64 encoded
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hash of an opaque token, for storing tokens without storing their value
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
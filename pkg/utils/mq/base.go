@@ -2,14 +2,45 @@ package mq
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/simondanielsson/apPRoved/cmd/config"
 )
 
+// MessageHandler processes the body of a consumed message. Returning nil acknowledges the message.
+// Returning an error negatively acknowledges it so that it is redelivered, unless the error is a
+// PermanentError, in which case the message is dropped.
+type MessageHandler func(ctx context.Context, body []byte) error
+
 type MessageQueue interface {
 	Close()
 	Publish(ctx context.Context, queue config.QueueName, message interface{}) error
+	// Subscribe consumes messages from the queue until ctx is cancelled or the connection is lost.
+	Subscribe(ctx context.Context, queue config.QueueName, handler MessageHandler) error
+}
+
+// PermanentError marks a message that can never be processed successfully, e.g. because it is malformed.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent error: %v", e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func NewPermanentError(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err should cause the message to be dropped rather than redelivered
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
 }
 
 func NewMessageQueue(cfg *config.Config) (MessageQueue, error) {
@@ -12,21 +12,26 @@ import (
 	"github.com/simondanielsson/apPRoved/cmd/config"
 )
 
+// maxRedeliveryBackoff caps how long a consumer waits before handing back a message it failed to handle
+const maxRedeliveryBackoff = time.Minute
+
 type RabbitMQ struct {
-	conn         *amqp.Connection
-	channel      *amqp.Channel
-	connStr      string
-	mutex        sync.Mutex
-	connected    bool
-	reconnectDur time.Duration
+	conn          *amqp.Connection
+	channel       *amqp.Channel
+	connStr       string
+	mutex         sync.Mutex
+	connected     bool
+	reconnectDur  time.Duration
+	prefetchCount int
 }
 
 // NewRabbitMQ creates a new RabbitMQ
 func NewRabbitMQ(cfg interface{}) (*RabbitMQ, error) {
 	cfgMQ := cfg.(*config.RabbitMQConfig)
 	queue := &RabbitMQ{
-		connStr:      cfgMQ.Url,
-		reconnectDur: 5 * time.Second,
+		connStr:       cfgMQ.Url,
+		reconnectDur:  5 * time.Second,
+		prefetchCount: 10,
 	}
 	if err := queue.connect(); err != nil {
 		log.Fatalf("error initializing RabbitMQ: %v", err)
@@ -138,3 +143,81 @@ func (r *RabbitMQ) Publish(ctx context.Context, queue config.QueueName, message
 
 	return err
 }
+
+func (r *RabbitMQ) Subscribe(ctx context.Context, queue config.QueueName, handler MessageHandler) error {
+	// consumers get their own channel so that acks do not contend with publishing
+	r.mutex.Lock()
+	if !r.connected {
+		r.mutex.Unlock()
+		return amqp.ErrClosed
+	}
+	channel, err := r.conn.Channel()
+	r.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	if err := channel.Qos(r.prefetchCount, 0, false); err != nil {
+		return err
+	}
+
+	deliveries, err := channel.Consume(
+		string(queue),
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return err
+	}
+	log.Printf("Consuming messages from queue %s", queue)
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return fmt.Errorf("delivery channel for queue %s was closed", queue)
+			}
+
+			if err := handler(ctx, delivery.Body); err != nil {
+				requeue := !IsPermanent(err)
+				log.Printf("Could not handle message from queue %s (requeue: %t): %v", queue, requeue, err)
+				if requeue {
+					// a requeued message is delivered again right away, so back off while the failures
+					// last instead of retrying it in a tight loop
+					failures++
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(redeliveryBackoff(failures)):
+					}
+				}
+				if err := delivery.Nack(false, requeue); err != nil {
+					return err
+				}
+				continue
+			}
+			failures = 0
+
+			if err := delivery.Ack(false); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// redeliveryBackoff returns how long to wait before requeueing a message after consecutive failures
+func redeliveryBackoff(failures int) time.Duration {
+	backoff := time.Second << uint(failures-1)
+	if backoff <= 0 || backoff > maxRedeliveryBackoff {
+		return maxRedeliveryBackoff
+	}
+	return backoff
+}
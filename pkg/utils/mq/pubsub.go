@@ -12,11 +12,12 @@ import (
 )
 
 type PubSub struct {
-	client      *pubsub.Client
-	topics      map[string]*pubsub.Topic
-	mutex       sync.Mutex
-	projectID   string
-	isConnected bool
+	client        *pubsub.Client
+	topics        map[string]*pubsub.Topic
+	subscriptions map[string]string
+	mutex         sync.Mutex
+	projectID     string
+	isConnected   bool
 }
 
 // NewPubSub creates a new PubSub
@@ -24,8 +25,9 @@ func NewPubSub(cfg interface{}) (*PubSub, error) {
 	cfgPB := cfg.(*config.PubSubConfig)
 
 	ps := &PubSub{
-		projectID: cfgPB.ProjectID,
-		topics:    make(map[string]*pubsub.Topic),
+		projectID:     cfgPB.ProjectID,
+		topics:        make(map[string]*pubsub.Topic),
+		subscriptions: make(map[string]string),
 	}
 
 	if err := ps.connect(); err != nil {
@@ -37,6 +39,9 @@ func NewPubSub(cfg interface{}) (*PubSub, error) {
 		}
 	}
 	fmt.Println("Connected to all declared topics")
+	for _, subscription := range cfgPB.Subscriptions {
+		ps.subscriptions[subscription.Topic] = subscription.Subscription
+	}
 
 	return ps, nil
 }
@@ -121,3 +126,33 @@ func (ps *PubSub) Publish(ctx context.Context, queue config.QueueName, message i
 	log.Printf("Published a message to topic %s; msg ID: %v\n", queue, id)
 	return nil
 }
+
+func (ps *PubSub) Subscribe(ctx context.Context, queue config.QueueName, handler MessageHandler) error {
+	ps.mutex.Lock()
+	if !ps.isConnected {
+		ps.mutex.Unlock()
+		return fmt.Errorf("tried to subscribe to a PubSub that is not connected")
+	}
+	subscriptionID, exists := ps.subscriptions[string(queue)]
+	if !exists {
+		ps.mutex.Unlock()
+		return fmt.Errorf("no subscription for topic %s found in configuration", queue)
+	}
+	subscription := ps.client.Subscription(subscriptionID)
+	ps.mutex.Unlock()
+
+	log.Printf("Receiving messages from subscription %s on topic %s", subscriptionID, queue)
+	return subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		if err := handler(ctx, msg.Data); err != nil {
+			if IsPermanent(err) {
+				log.Printf("Dropping message %s from topic %s: %v", msg.ID, queue, err)
+				msg.Ack()
+				return
+			}
+			log.Printf("Could not handle message %s from topic %s: %v", msg.ID, queue, err)
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	customerrors "github.com/simondanielsson/apPRoved/pkg/custom_errors"
+)
+
+var structValidator = newStructValidator()
+
+// newStructValidator creates a validator that names fields after their JSON keys
+func newStructValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// ValidateStruct checks the validate tags of a request or message. The first violation is returned as a
+// validation error on its JSON field.
+func ValidateStruct(s interface{}) error {
+	err := structValidator.Struct(s)
+	var fieldErrs validator.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		fieldErr := fieldErrs[0]
+		msg := fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+		if fieldErr.Param() != "" {
+			msg = fmt.Sprintf("failed the %s=%s rule", fieldErr.Tag(), fieldErr.Param())
+		}
+		// the namespace starts with the name of the struct, which means nothing to clients
+		field := fieldErr.Namespace()
+		if i := strings.Index(field, "."); i >= 0 {
+			field = field[i+1:]
+		}
+		return customerrors.NewValidationError(field, msg)
+	}
+	return err
+}